@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// accessCacheSyncInterval is how often the access cache checks the change
+// feed, which bounds how long it can miss a write made by another replica.
+const accessCacheSyncInterval = 5 * time.Second
+
+// accessCacheTTLFromEnv reads ACCESS_CACHE_TTL, e.g. "30s". The cache is off
+// unless it's set.
+func accessCacheTTLFromEnv() time.Duration {
+	return durationFromEnv("ACCESS_CACHE_TTL", 0)
+}
+
+// runAccessCacheSync periodically drops cached access checks whose leases
+// have changed. It runs until ctx is cancelled.
+func (s *server) runAccessCacheSync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.client.SyncAccessCache(ctx); err != nil {
+			log.Printf("Failed to sync access cache: %v", err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const activatorInterval = time.Minute
+
+// runLeaseActivator periodically turns scheduled leases whose window has
+// opened into active leases. It runs until ctx is cancelled.
+func (s *server) runLeaseActivator(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		leases, err := s.client.ActivateScheduledLeases(ctx, time.Now())
+		if err != nil {
+			log.Printf("Failed to activate scheduled leases: %v", err)
+		}
+		for _, lease := range leases {
+			log.Printf("Activated scheduled lease %s", lease.Id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const campaignInterval = 5 * time.Minute
+
+type startCampaignRequest struct {
+	Name string `json:"name"`
+	// MinDurationHours is the shortest lease the campaign covers. Leave it
+	// empty for a week.
+	MinDurationHours float64   `json:"minDurationHours"`
+	ClosesAt         time.Time `json:"closesAt"`
+}
+
+// confirmCampaignItemRequest is the body of the confirm action.
+type confirmCampaignItemRequest struct {
+	Owner   string `json:"owner"`
+	Comment string `json:"comment"`
+}
+
+// runCampaigns periodically closes recertification campaigns whose close time
+// has passed and sends reminders for the others. It runs until ctx is
+// cancelled.
+func (s *server) runCampaigns(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		closed, err := s.client.RunCampaigns(ctx, time.Now())
+		if err != nil {
+			log.Printf("Failed to run campaigns: %v", err)
+		}
+		for _, progress := range closed {
+			log.Printf("Closed campaign %q: %d confirmed, %d revoked", progress.Campaign.Name, progress.Confirmed, progress.Revoked)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleCampaigns serves GET /campaigns, which lists every campaign, and POST
+// /campaigns, which starts one.
+func (s *server) handleCampaigns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		campaigns, err := s.client.ListCampaigns(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(campaigns)
+	case http.MethodPost:
+		var req startCampaignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		minDuration := time.Duration(req.MinDurationHours * float64(time.Hour))
+		campaign, err := s.client.StartCampaign(r.Context(), req.Name, minDuration, req.ClosesAt)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(campaign)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCampaign serves:
+//
+//	GET  /campaigns/{id}                           the campaign and its progress
+//	GET  /campaigns/{id}/items?owner={id}          its leases, optionally just one owner's
+//	POST /campaigns/{id}/items/{leaseId}/confirm   an owner confirming a lease
+//	POST /campaigns/{id}/close                     closing it early
+func (s *server) handleCampaign(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(r.URL.Path[len("/campaigns/"):], "/")
+	campaignID, err := fromStatelyUUID(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid campaign ID format %s (%s)", err.Error(), idStr), http.StatusBadRequest)
+		return
+	}
+	action, leaseIDStr, _ := strings.Cut(action, "/")
+	leaseIDStr, subAction, _ := strings.Cut(leaseIDStr, "/")
+
+	method := http.MethodGet
+	if action == "close" || subAction != "" {
+		method = http.MethodPost
+	}
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result any
+	switch {
+	case action == "" && leaseIDStr == "":
+		result, err = s.client.GetCampaign(r.Context(), campaignID)
+	case action == "items" && leaseIDStr == "":
+		var owner uuid.UUID
+		if o := r.URL.Query().Get("owner"); o != "" {
+			if owner, err = fromStatelyUUID(o); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid owner ID format %s", err.Error()), http.StatusBadRequest)
+				return
+			}
+		}
+		result, err = s.client.ListCampaignItems(r.Context(), campaignID, owner)
+	case action == "items" && subAction == "confirm":
+		leaseID, err := fromStatelyUUID(leaseIDStr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid lease ID format %s (%s)", err.Error(), leaseIDStr), http.StatusBadRequest)
+			return
+		}
+		var req confirmCampaignItemRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		owner, err := fromStatelyUUID(req.Owner)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid owner ID format %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		result, err = s.client.ConfirmCampaignItem(r.Context(), campaignID, leaseID, owner, req.Comment)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+	case action == "close" && leaseIDStr == "":
+		result, err = s.client.CloseCampaign(r.Context(), campaignID)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,861 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/client"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+)
+
+// admin is what the CLI subcommands need. *client.Client implements it by
+// talking to the store directly, and remoteAdmin by calling a running
+// server's HTTP API.
+type admin interface {
+	CreateUser(ctx context.Context, displayName, email string) (*schema.User, error)
+	GetUser(ctx context.Context, userID uuid.UUID) (*schema.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*schema.User, error)
+	UpdateUserEmail(ctx context.Context, userID uuid.UUID, email string) (*schema.User, error)
+	ListUsers(ctx context.Context) ([]*schema.User, error)
+	CreateResource(ctx context.Context, name string, owner uuid.UUID) (*schema.Resource, error)
+	ListResources(ctx context.Context) ([]*schema.Resource, error)
+	GetResourceByName(ctx context.Context, name string) (*schema.Resource, error)
+	CreateLease(ctx context.Context, userID, resourceID uuid.UUID, reason string, duration time.Duration, approver uuid.UUID) (*schema.Lease, error)
+	CreateEmergencyLease(ctx context.Context, userID, resourceID uuid.UUID, reason, incidentRef string, duration time.Duration) (*schema.Lease, error)
+	ListLeases(ctx context.Context) ([]*schema.Lease, error)
+	GetLeasesForUser(ctx context.Context, userID uuid.UUID) ([]*schema.Lease, error)
+	GetLeasesForResource(ctx context.Context, resourceID uuid.UUID) ([]*schema.Lease, error)
+	ApproveLease(ctx context.Context, leaseID, approver uuid.UUID, comment, ifMatch string) (*schema.Lease, error)
+	DenyLease(ctx context.Context, leaseID, approver uuid.UUID, comment, ifMatch string) (*schema.Lease, error)
+	GetPendingApprovals(ctx context.Context, ownerID uuid.UUID) ([]*schema.Lease, error)
+	SearchLeases(ctx context.Context, filter client.LeaseFilter) ([]*schema.Lease, error)
+	TouchLease(ctx context.Context, leaseID uuid.UUID, ifMatch string) (*schema.Lease, error)
+	DeleteLease(ctx context.Context, leaseID uuid.UUID, ifMatch string) error
+	CheckAccess(ctx context.Context, userID, resourceID uuid.UUID) (*schema.Lease, error)
+	ListEmergencyReviews(ctx context.Context, resourceID uuid.UUID) ([]*schema.EmergencyReview, error)
+	AcknowledgeEmergencyReview(ctx context.Context, leaseID, reviewer uuid.UUID, comment string) (*schema.EmergencyReview, error)
+	ReportAccess(ctx context.Context, by string, from, to time.Time) ([]client.AccessSummary, error)
+	StartCampaign(ctx context.Context, name string, minDuration time.Duration, closesAt time.Time) (*schema.Campaign, error)
+	ListCampaigns(ctx context.Context) ([]*schema.Campaign, error)
+	GetCampaign(ctx context.Context, campaignID uuid.UUID) (*client.CampaignProgress, error)
+	ListCampaignItems(ctx context.Context, campaignID, owner uuid.UUID) ([]*schema.CampaignItem, error)
+	ConfirmCampaignItem(ctx context.Context, campaignID, leaseID, owner uuid.UUID, comment string) (*schema.CampaignItem, error)
+	CloseCampaign(ctx context.Context, campaignID uuid.UUID) (*client.CampaignProgress, error)
+	PutTemplate(ctx context.Context, template *schema.LeaseTemplate) (*schema.LeaseTemplate, error)
+	GetTemplate(ctx context.Context, name string) (*schema.LeaseTemplate, error)
+	ListTemplates(ctx context.Context) ([]*schema.LeaseTemplate, error)
+	DeleteTemplate(ctx context.Context, name string) error
+	RequestTemplate(ctx context.Context, name string, userID uuid.UUID, reason string, duration time.Duration, approver uuid.UUID) ([]*schema.Lease, error)
+}
+
+// cliFlags are the flags every admin subcommand takes.
+type cliFlags struct {
+	fs     *flag.FlagSet
+	server *string
+	output *string
+	// csv allows -o csv, for commands that support it.
+	csv bool
+}
+
+func newCLIFlags(name, usage string) *cliFlags {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: demo-w %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return &cliFlags{
+		fs:     fs,
+		server: fs.String("server", os.Getenv("DEMO_W_SERVER"), "Base URL of a running server to call, e.g. http://localhost:8080. Defaults to talking to the store directly"),
+		output: fs.String("o", "table", "Output format: table or json"),
+	}
+}
+
+// parse parses flags and positional arguments in any order, and returns the
+// positional ones.
+func (f *cliFlags) parse(args []string) []string {
+	var positional []string
+	for {
+		f.fs.Parse(args)
+		if f.fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, f.fs.Arg(0))
+		args = f.fs.Args()[1:]
+	}
+	if *f.output != "table" && *f.output != "json" && (*f.output != "csv" || !f.csv) {
+		f.fs.Usage()
+		os.Exit(2)
+	}
+	return positional
+}
+
+// arg returns the only positional argument, exiting with usage if there isn't
+// exactly one.
+func (f *cliFlags) arg(args []string) string {
+	if len(args) != 1 {
+		f.fs.Usage()
+		os.Exit(2)
+	}
+	return args[0]
+}
+
+// admin connects to the server given by -server, or else to the store.
+func (f *cliFlags) admin(ctx context.Context) admin {
+	if *f.server != "" {
+		return newRemoteAdmin(*f.server)
+	}
+	c := newClientFromEnv(ctx)
+	c.SetNotifier(notifierFromEnv())
+	c.SetLimits(limitsFromEnv())
+	return c
+}
+
+// runUser implements `demo-w user create|get|list|set-email|normalize-emails`.
+func runUser(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: demo-w user create|get|list|set-email|normalize-emails [flags]")
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "create":
+		f := newCLIFlags("user create", "user create -name NAME -email EMAIL [flags]")
+		name := f.fs.String("name", "", "Display name")
+		email := f.fs.String("email", "", "Email address")
+		f.parse(args[1:])
+		user, err := f.admin(ctx).CreateUser(ctx, *name, *email)
+		if err != nil {
+			log.Fatalf("Failed to create user: %v", err)
+		}
+		f.printUsers(user)
+	case "get":
+		f := newCLIFlags("user get", "user get (ID | -email EMAIL) [flags]")
+		email := f.fs.String("email", "", "Look the user up by email instead of ID")
+		rest := f.parse(args[1:])
+		a := f.admin(ctx)
+		var user *schema.User
+		var err error
+		if *email != "" {
+			user, err = a.GetUserByEmail(ctx, *email)
+		} else {
+			user, err = a.GetUser(ctx, parseCLIID(f.arg(rest)))
+		}
+		if err != nil {
+			log.Fatalf("Failed to get user: %v", err)
+		}
+		if user == nil {
+			log.Fatal("User not found")
+		}
+		f.printUsers(user)
+	case "list":
+		f := newCLIFlags("user list", "user list [flags]")
+		f.parse(args[1:])
+		users, err := f.admin(ctx).ListUsers(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list users: %v", err)
+		}
+		f.printUsers(users...)
+	case "set-email":
+		f := newCLIFlags("user set-email", "user set-email ID -email EMAIL [flags]")
+		email := f.fs.String("email", "", "New email address")
+		rest := f.parse(args[1:])
+		user, err := f.admin(ctx).UpdateUserEmail(ctx, parseCLIID(f.arg(rest)), *email)
+		if err != nil {
+			log.Fatalf("Failed to change email: %v", err)
+		}
+		f.printUsers(user)
+	case "normalize-emails":
+		f := newCLIFlags("user normalize-emails", "user normalize-emails")
+		f.parse(args[1:])
+		if *f.server != "" {
+			log.Fatal("normalize-emails talks to the store directly, so it doesn't take -server")
+		}
+		normalized, conflicts, err := newClientFromEnv(ctx).NormalizeUserEmails(ctx)
+		if err != nil {
+			log.Fatalf("Failed to normalize emails after normalizing %d: %v", normalized, err)
+		}
+		log.Printf("Normalized %d emails", normalized)
+		if len(conflicts) > 0 {
+			log.Printf("%d users have an email that differs only in case from another user's, and kept it as it was:", len(conflicts))
+			f.printUsers(conflicts...)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown user command %q\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// runResource implements `demo-w resource create|get|list|claim-names`.
+func runResource(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: demo-w resource create|get|list|claim-names [flags]")
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "create":
+		f := newCLIFlags("resource create", "resource create -name NAME [-owner ID] [flags]")
+		name := f.fs.String("name", "", "Resource name")
+		owner := f.fs.String("owner", "", "User who approves leases for the resource")
+		f.parse(args[1:])
+		ownerID := uuid.Nil
+		if *owner != "" {
+			ownerID = parseCLIID(*owner)
+		}
+		resource, err := f.admin(ctx).CreateResource(ctx, *name, ownerID)
+		if err != nil {
+			log.Fatalf("Failed to create resource: %v", err)
+		}
+		f.printResources(resource)
+	case "list":
+		f := newCLIFlags("resource list", "resource list [flags]")
+		f.parse(args[1:])
+		resources, err := f.admin(ctx).ListResources(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list resources: %v", err)
+		}
+		f.printResources(resources...)
+	case "get":
+		f := newCLIFlags("resource get", "resource get NAME [flags]")
+		rest := f.parse(args[1:])
+		resource, err := f.admin(ctx).GetResourceByName(ctx, f.arg(rest))
+		if err != nil {
+			log.Fatalf("Failed to get resource: %v", err)
+		}
+		if resource == nil {
+			log.Fatal("Resource not found")
+		}
+		f.printResources(resource)
+	case "claim-names":
+		f := newCLIFlags("resource claim-names", "resource claim-names")
+		f.parse(args[1:])
+		if *f.server != "" {
+			log.Fatal("claim-names talks to the store directly, so it doesn't take -server")
+		}
+		claimed, conflicts, err := newClientFromEnv(ctx).ClaimResourceNames(ctx)
+		if err != nil {
+			log.Fatalf("Failed to claim resource names after claiming %d: %v", claimed, err)
+		}
+		log.Printf("Claimed %d resource names", claimed)
+		if len(conflicts) > 0 {
+			log.Printf("%d resources share a name with another resource, and can't be looked up by name:", len(conflicts))
+			f.printResources(conflicts...)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown resource command %q\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// runLease implements `demo-w lease grant|list|pending|revoke|touch|approve|deny`.
+func runLease(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: demo-w lease grant|list|search|reindex|pending|revoke|touch|approve|deny [flags]")
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "grant":
+		f := newCLIFlags("lease grant", "lease grant -user ID -resource (ID | NAME) -duration DURATION [flags]")
+		user := f.fs.String("user", "", "User to grant the lease to")
+		resource := f.fs.String("resource", "", "Resource the lease is for, by ID or name")
+		reason := f.fs.String("reason", "", "Why the lease is needed")
+		duration := f.fs.Duration("duration", time.Hour, "How long the lease lasts, e.g. 30m or 8h")
+		approver := f.fs.String("approver", "", "Approve the lease as this user straight away")
+		emergency := f.fs.Bool("emergency", false, "Break glass: skip approval, for a capped duration. Needs -reason and -incident")
+		incident := f.fs.String("incident", "", "Incident reference for an -emergency lease")
+		f.parse(args[1:])
+		approverID := uuid.Nil
+		if *approver != "" {
+			approverID = parseCLIID(*approver)
+		}
+		a := f.admin(ctx)
+		resourceID := resourceArg(ctx, a, *resource)
+		var lease *schema.Lease
+		var err error
+		if *emergency {
+			lease, err = a.CreateEmergencyLease(ctx, parseCLIID(*user), resourceID, *reason, *incident, *duration)
+		} else {
+			lease, err = a.CreateLease(ctx, parseCLIID(*user), resourceID, *reason, *duration, approverID)
+		}
+		if err != nil {
+			log.Fatalf("Failed to grant lease: %v", err)
+		}
+		f.printLeases(lease)
+	case "list":
+		f := newCLIFlags("lease list", "lease list [-user ID | -resource (ID | NAME)] [flags]")
+		user := f.fs.String("user", "", "Only list this user's leases")
+		resource := f.fs.String("resource", "", "Only list leases for this resource, by ID or name")
+		f.parse(args[1:])
+		a := f.admin(ctx)
+		var leases []*schema.Lease
+		var err error
+		switch {
+		case *user != "" && *resource != "":
+			log.Fatal("Pass -user or -resource, not both")
+		case *user != "":
+			leases, err = a.GetLeasesForUser(ctx, parseCLIID(*user))
+		case *resource != "":
+			leases, err = a.GetLeasesForResource(ctx, resourceArg(ctx, a, *resource))
+		default:
+			leases, err = a.ListLeases(ctx)
+		}
+		if err != nil {
+			log.Fatalf("Failed to list leases: %v", err)
+		}
+		f.printLeases(leases...)
+	case "search":
+		f := newCLIFlags("lease search", "lease search [-state STATE] [-approver ID] [-reason WORDS] [-expires-before WHEN] [-created-after WHEN] [flags]")
+		state := f.fs.String("state", "", "pending, approved, denied or emergency")
+		approver := f.fs.String("approver", "", "Only leases approved by this user")
+		reason := f.fs.String("reason", "", "Only leases whose reason has these words, e.g. INC-")
+		expiresAfter := f.fs.String("expires-after", "", "Only leases expiring after this time (RFC 3339) or offset from now, e.g. 30m")
+		expiresBefore := f.fs.String("expires-before", "", "Only leases expiring before this time or offset from now, e.g. 1h")
+		createdAfter := f.fs.String("created-after", "", "Only leases created after this time or offset from now, e.g. -24h")
+		createdBefore := f.fs.String("created-before", "", "Only leases created before this time or offset from now")
+		limit := f.fs.Int("limit", client.DefaultSearchLimit, "Most leases to list")
+		f.parse(args[1:])
+		query := url.Values{
+			"state":         {*state},
+			"reason":        {*reason},
+			"expiresAfter":  {*expiresAfter},
+			"expiresBefore": {*expiresBefore},
+			"createdAfter":  {*createdAfter},
+			"createdBefore": {*createdBefore},
+			"limit":         {strconv.Itoa(*limit)},
+		}
+		if *approver != "" {
+			query.Set("approver", cliID(parseCLIID(*approver)))
+		}
+		filter, err := leaseFilterFromQuery(query, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		leases, err := f.admin(ctx).SearchLeases(ctx, filter)
+		if err != nil {
+			log.Fatalf("Failed to search leases: %v", err)
+		}
+		f.printLeases(leases...)
+	case "reindex":
+		f := newCLIFlags("lease reindex", "lease reindex")
+		f.parse(args[1:])
+		if *f.server != "" {
+			log.Fatal("reindex talks to the store directly, so it doesn't take -server")
+		}
+		n, err := newClientFromEnv(ctx).ReindexLeases(ctx)
+		if err != nil {
+			log.Fatalf("Failed to reindex leases after indexing %d: %v", n, err)
+		}
+		log.Printf("Indexed %d leases", n)
+	case "pending":
+		f := newCLIFlags("lease pending", "lease pending -owner ID [flags]")
+		owner := f.fs.String("owner", "", "List leases waiting for this user's approval")
+		f.parse(args[1:])
+		leases, err := f.admin(ctx).GetPendingApprovals(ctx, parseCLIID(*owner))
+		if err != nil {
+			log.Fatalf("Failed to list pending approvals: %v", err)
+		}
+		f.printLeases(leases...)
+	case "revoke":
+		f := newCLIFlags("lease revoke", "lease revoke ID [flags]")
+		ifMatch := f.fs.String("if-match", "", "Only revoke the lease if this is still its ETag")
+		leaseID := parseCLIID(f.arg(f.parse(args[1:])))
+		if err := f.admin(ctx).DeleteLease(ctx, leaseID, *ifMatch); err != nil {
+			log.Fatalf("Failed to revoke lease: %v", err)
+		}
+	case "touch":
+		f := newCLIFlags("lease touch", "lease touch ID [flags]")
+		ifMatch := f.fs.String("if-match", "", "Only extend the lease if this is still its ETag")
+		leaseID := parseCLIID(f.arg(f.parse(args[1:])))
+		lease, err := f.admin(ctx).TouchLease(ctx, leaseID, *ifMatch)
+		if err != nil {
+			log.Fatalf("Failed to extend lease: %v", err)
+		}
+		f.printLeases(lease)
+	case "approve", "deny":
+		f := newCLIFlags("lease "+args[0], "lease "+args[0]+" ID -approver ID [flags]")
+		approver := f.fs.String("approver", "", "User deciding on the lease")
+		comment := f.fs.String("comment", "", "Note recorded with the decision")
+		ifMatch := f.fs.String("if-match", "", "Only decide if this is still the lease's ETag")
+		leaseID := parseCLIID(f.arg(f.parse(args[1:])))
+		a := f.admin(ctx)
+		var lease *schema.Lease
+		var err error
+		if args[0] == "approve" {
+			lease, err = a.ApproveLease(ctx, leaseID, parseCLIID(*approver), *comment, *ifMatch)
+		} else {
+			lease, err = a.DenyLease(ctx, leaseID, parseCLIID(*approver), *comment, *ifMatch)
+		}
+		if err != nil {
+			log.Fatalf("Failed to %s lease: %v", args[0], err)
+		}
+		f.printLeases(lease)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown lease command %q\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// runReview implements `demo-w review list|ack`, for signing off on
+// break-glass leases.
+func runReview(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: demo-w review list|ack [flags]")
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "list":
+		f := newCLIFlags("review list", "review list -resource ID [-unacknowledged] [flags]")
+		resource := f.fs.String("resource", "", "Resource to list emergency reviews for")
+		unacked := f.fs.Bool("unacknowledged", false, "Only list reviews nobody has acknowledged yet")
+		f.parse(args[1:])
+		reviews, err := f.admin(ctx).ListEmergencyReviews(ctx, parseCLIID(*resource))
+		if err != nil {
+			log.Fatalf("Failed to list reviews: %v", err)
+		}
+		if *unacked {
+			reviews = slices.DeleteFunc(reviews, func(r *schema.EmergencyReview) bool { return r.AcknowledgedBy != uuid.Nil })
+		}
+		f.printReviews(reviews...)
+	case "ack":
+		f := newCLIFlags("review ack", "review ack LEASE_ID -reviewer ID [flags]")
+		reviewer := f.fs.String("reviewer", "", "User acknowledging the review")
+		comment := f.fs.String("comment", "", "Note recorded with the acknowledgement")
+		leaseID := parseCLIID(f.arg(f.parse(args[1:])))
+		review, err := f.admin(ctx).AcknowledgeEmergencyReview(ctx, leaseID, parseCLIID(*reviewer), *comment)
+		if err != nil {
+			log.Fatalf("Failed to acknowledge review: %v", err)
+		}
+		f.printReviews(review)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown review command %q\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// runReport implements `demo-w report access`.
+func runReport(ctx context.Context, args []string) {
+	if len(args) == 0 || args[0] != "access" {
+		fmt.Fprintln(os.Stderr, "Usage: demo-w report access [flags]")
+		os.Exit(2)
+	}
+	f := newCLIFlags("report access", "report access [-by resource|user] [-from WHEN] [-to WHEN] [flags]")
+	f.csv = true
+	f.fs.Lookup("o").Usage = "Output format: table, json or csv"
+	by := f.fs.String("by", client.ReportByResource, "Summarize by resource or by user")
+	from := f.fs.String("from", "", "Start of the report, as a time (RFC 3339) or offset from now, e.g. -720h. Defaults to the beginning")
+	to := f.fs.String("to", "", "End of the report, likewise. Defaults to now")
+	f.parse(args[1:])
+	_, start, end, err := reportRangeFromQuery(url.Values{"from": {*from}, "to": {*to}}, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	rows, err := f.admin(ctx).ReportAccess(ctx, *by, start, end)
+	if err != nil {
+		log.Fatalf("Failed to build report: %v", err)
+	}
+	switch *f.output {
+	case "json":
+		printJSON(rows)
+	case "csv":
+		if err := writeAccessCSV(os.Stdout, *by, rows); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		distinct := "USERS"
+		if *by == client.ReportByUser {
+			distinct = "RESOURCES"
+		}
+		printTable(func(w io.Writer) {
+			fmt.Fprintf(w, "ID\tNAME\tLEASES\tHOURS\t%s\tAPPROVED\tSELF-SERVICE\n", distinct)
+			for _, row := range rows {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%.1f\t%d\t%d\t%d\n", base64.StdEncoding.EncodeToString(row.ID), row.Name, row.Leases,
+					row.LeaseHours, row.DistinctUsers+row.DistinctResources, row.Approved, row.SelfService)
+			}
+		})
+	}
+}
+
+// runCampaign implements `demo-w campaign start|list|get|items|confirm|close`.
+func runCampaign(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: demo-w campaign start|list|get|items|confirm|close [flags]")
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "start":
+		f := newCLIFlags("campaign start", "campaign start -name NAME -closes WHEN [-min-duration DURATION] [flags]")
+		name := f.fs.String("name", "", "Name of the campaign, e.g. \"2026 Q4 recertification\"")
+		closes := f.fs.String("closes", "", "When unconfirmed leases are revoked, as a time (RFC 3339) or offset from now, e.g. 336h")
+		minDuration := f.fs.Duration("min-duration", client.DefaultCampaignMinDuration, "Shortest lease to recertify. Leases without a duration are always included")
+		f.parse(args[1:])
+		closesAt, err := parseWhen("closes", *closes, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		campaign, err := f.admin(ctx).StartCampaign(ctx, *name, *minDuration, closesAt)
+		if err != nil {
+			log.Fatalf("Failed to start campaign: %v", err)
+		}
+		f.printCampaigns(campaign)
+	case "list":
+		f := newCLIFlags("campaign list", "campaign list [flags]")
+		f.parse(args[1:])
+		campaigns, err := f.admin(ctx).ListCampaigns(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list campaigns: %v", err)
+		}
+		f.printCampaigns(campaigns...)
+	case "get":
+		f := newCLIFlags("campaign get", "campaign get ID [flags]")
+		campaignID := parseCLIID(f.arg(f.parse(args[1:])))
+		progress, err := f.admin(ctx).GetCampaign(ctx, campaignID)
+		if err != nil {
+			log.Fatalf("Failed to get campaign: %v", err)
+		}
+		f.printCampaignProgress(progress)
+	case "items":
+		f := newCLIFlags("campaign items", "campaign items ID [-owner ID] [flags]")
+		owner := f.fs.String("owner", "", "Only list the leases this user has to confirm")
+		campaignID := parseCLIID(f.arg(f.parse(args[1:])))
+		items, err := f.admin(ctx).ListCampaignItems(ctx, campaignID, parseCLIID(*owner))
+		if err != nil {
+			log.Fatalf("Failed to list campaign items: %v", err)
+		}
+		f.printCampaignItems(items...)
+	case "confirm":
+		f := newCLIFlags("campaign confirm", "campaign confirm ID LEASE_ID -owner ID [flags]")
+		owner := f.fs.String("owner", "", "Owner confirming the lease")
+		comment := f.fs.String("comment", "", "Note recorded with the confirmation")
+		rest := f.parse(args[1:])
+		if len(rest) != 2 {
+			f.fs.Usage()
+			os.Exit(2)
+		}
+		item, err := f.admin(ctx).ConfirmCampaignItem(ctx, parseCLIID(rest[0]), parseCLIID(rest[1]), parseCLIID(*owner), *comment)
+		if err != nil {
+			log.Fatalf("Failed to confirm lease: %v", err)
+		}
+		f.printCampaignItems(item)
+	case "close":
+		f := newCLIFlags("campaign close", "campaign close ID [flags]")
+		campaignID := parseCLIID(f.arg(f.parse(args[1:])))
+		progress, err := f.admin(ctx).CloseCampaign(ctx, campaignID)
+		if err != nil {
+			log.Fatalf("Failed to close campaign: %v", err)
+		}
+		f.printCampaignProgress(progress)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown campaign command %q\n", args[0])
+		os.Exit(2)
+	}
+}
+
+func runTemplate(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: demo-w template put|list|get|delete|request [flags]")
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "put":
+		f := newCLIFlags("template put", "template put -name NAME -resources NAME,NAME,... [-duration DURATION] [-reason REASON] [flags]")
+		name := f.fs.String("name", "", "Name of the template, e.g. oncall-db")
+		description := f.fs.String("description", "", "What the template is for")
+		resources := f.fs.String("resources", "", "Comma-separated names of the resources to bundle")
+		duration := f.fs.Duration("duration", time.Hour, "Default lease duration, e.g. 30m or 8h")
+		reason := f.fs.String("reason", "", "Default reason for the leases")
+		f.parse(args[1:])
+		var names []string
+		for _, name := range strings.Split(*resources, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		template, err := f.admin(ctx).PutTemplate(ctx, &schema.LeaseTemplate{
+			Name:            *name,
+			Description:     *description,
+			Resources:       names,
+			DurationSeconds: *duration,
+			Reason:          *reason,
+		})
+		if err != nil {
+			log.Fatalf("Failed to save template: %v", err)
+		}
+		f.printTemplates(template)
+	case "list":
+		f := newCLIFlags("template list", "template list [flags]")
+		f.parse(args[1:])
+		templates, err := f.admin(ctx).ListTemplates(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list templates: %v", err)
+		}
+		f.printTemplates(templates...)
+	case "get":
+		f := newCLIFlags("template get", "template get NAME [flags]")
+		name := f.arg(f.parse(args[1:]))
+		template, err := f.admin(ctx).GetTemplate(ctx, name)
+		if err != nil {
+			log.Fatalf("Failed to get template: %v", err)
+		}
+		f.printTemplates(template)
+	case "delete":
+		f := newCLIFlags("template delete", "template delete NAME [flags]")
+		name := f.arg(f.parse(args[1:]))
+		if err := f.admin(ctx).DeleteTemplate(ctx, name); err != nil {
+			log.Fatalf("Failed to delete template: %v", err)
+		}
+	case "request":
+		f := newCLIFlags("template request", "template request NAME -user ID [-duration DURATION] [-reason REASON] [flags]")
+		user := f.fs.String("user", "", "User to request the leases for")
+		reason := f.fs.String("reason", "", "Why the leases are needed. Defaults to the template's reason")
+		duration := f.fs.Duration("duration", 0, "How long the leases last. Defaults to the template's duration")
+		approver := f.fs.String("approver", "", "Approve the leases as this user straight away")
+		name := f.arg(f.parse(args[1:]))
+		approverID := uuid.Nil
+		if *approver != "" {
+			approverID = parseCLIID(*approver)
+		}
+		leases, err := f.admin(ctx).RequestTemplate(ctx, name, parseCLIID(*user), *reason, *duration, approverID)
+		if err != nil {
+			log.Fatalf("Failed to request template: %v", err)
+		}
+		f.printLeases(leases...)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown template command %q\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// runCheck implements `demo-w check`, which exits with status 1 if the user
+// doesn't currently have access to the resource.
+func runCheck(ctx context.Context, args []string) {
+	f := newCLIFlags("check", "check -user ID -resource ID [flags]")
+	user := f.fs.String("user", "", "User to check")
+	resource := f.fs.String("resource", "", "Resource to check")
+	f.parse(args)
+	lease, err := f.admin(ctx).CheckAccess(ctx, parseCLIID(*user), parseCLIID(*resource))
+	if err != nil {
+		log.Fatalf("Failed to check access: %v", err)
+	}
+
+	if *f.output == "json" {
+		printJSON(checkResponse{Allowed: lease != nil, Lease: lease})
+	} else if lease == nil {
+		fmt.Println("Denied")
+	} else {
+		fmt.Printf("Allowed by lease %s until %s\n", cliID(lease.Id), formatExpiry(lease))
+	}
+	if lease == nil {
+		os.Exit(1)
+	}
+}
+
+func (f *cliFlags) printUsers(users ...*schema.User) {
+	if *f.output == "json" {
+		printJSON(users)
+		return
+	}
+	printTable(func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tEMAIL\tNAME\tCREATED")
+		for _, u := range users {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cliID(u.Id), u.Email, u.DisplayName, formatTime(u.CreatedAt))
+		}
+	})
+}
+
+func (f *cliFlags) printResources(resources ...*schema.Resource) {
+	if *f.output == "json" {
+		printJSON(resources)
+		return
+	}
+	printTable(func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tOWNER\tCREATED")
+		for _, r := range resources {
+			owner := "-"
+			if r.OwnerId != uuid.Nil {
+				owner = cliID(r.OwnerId)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cliID(r.Id), r.Name, owner, formatTime(r.CreatedAt))
+		}
+	})
+}
+
+func (f *cliFlags) printLeases(leases ...*schema.Lease) {
+	if *f.output == "json" {
+		printJSON(leases)
+		return
+	}
+	now := time.Now()
+	printTable(func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tUSER\tRESOURCE\tSTATUS\tEXPIRES\tREASON")
+		for _, l := range leases {
+			status := "active"
+			switch {
+			case client.LeaseDenied(l):
+				status = "denied"
+			case client.LeasePending(l):
+				status = "pending"
+			case !client.LeaseActive(l, now):
+				status = "expired"
+			case l.Emergency:
+				status = "emergency"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", cliID(l.Id), cliID(l.UserId), cliID(l.ResourceId), status, formatExpiry(l), l.Reason)
+		}
+	})
+}
+
+func (f *cliFlags) printReviews(reviews ...*schema.EmergencyReview) {
+	if *f.output == "json" {
+		printJSON(reviews)
+		return
+	}
+	printTable(func(w io.Writer) {
+		fmt.Fprintln(w, "LEASE\tUSER\tINCIDENT\tCREATED\tACKNOWLEDGED BY\tREASON")
+		for _, r := range reviews {
+			acked := "-"
+			if r.AcknowledgedBy != uuid.Nil {
+				acked = cliID(r.AcknowledgedBy)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", cliID(r.LeaseId), cliID(r.UserId), r.IncidentRef, formatTime(r.CreatedAt), acked, r.Reason)
+		}
+	})
+}
+
+func (f *cliFlags) printCampaigns(campaigns ...*schema.Campaign) {
+	if *f.output == "json" {
+		printJSON(campaigns)
+		return
+	}
+	printTable(func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tMIN DURATION\tCLOSES\tCLOSED")
+		for _, c := range campaigns {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", cliID(c.Id), c.Name, c.MinDurationSeconds, formatTime(c.ClosesAt), formatTime(c.ClosedAt))
+		}
+	})
+}
+
+func (f *cliFlags) printCampaignProgress(progress *client.CampaignProgress) {
+	if *f.output == "json" {
+		printJSON(progress)
+		return
+	}
+	c := progress.Campaign
+	printTable(func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tCLOSES\tTOTAL\tPENDING\tCONFIRMED\tREVOKED\tGONE")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n", cliID(c.Id), c.Name, formatTime(c.ClosesAt),
+			progress.Total, progress.Pending, progress.Confirmed, progress.Revoked, progress.Gone)
+	})
+}
+
+func (f *cliFlags) printCampaignItems(items ...*schema.CampaignItem) {
+	if *f.output == "json" {
+		printJSON(items)
+		return
+	}
+	printTable(func(w io.Writer) {
+		fmt.Fprintln(w, "LEASE\tUSER\tRESOURCE\tOWNER\tSTATUS\tDECIDED\tCOMMENT")
+		for _, i := range items {
+			owner := "-"
+			if i.OwnerId != uuid.Nil {
+				owner = cliID(i.OwnerId)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", cliID(i.LeaseId), cliID(i.UserId), cliID(i.ResourceId), owner, i.Status, formatTime(i.DecidedAt), i.Comment)
+		}
+	})
+}
+
+func (f *cliFlags) printTemplates(templates ...*schema.LeaseTemplate) {
+	if *f.output == "json" {
+		printJSON(templates)
+		return
+	}
+	printTable(func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tRESOURCES\tDURATION\tREASON\tDESCRIPTION")
+		for _, t := range templates {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Name, strings.Join(t.Resources, ","), t.DurationSeconds, t.Reason, t.Description)
+		}
+	})
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printTable(write func(io.Writer)) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	write(w)
+	w.Flush()
+}
+
+// cliID formats an ID the way the HTTP API does, so it can be pasted into
+// either.
+func cliID(id uuid.UUID) string {
+	return base64.StdEncoding.EncodeToString(id[:])
+}
+
+// parseCLIID accepts an ID in the API's base64 form or as a regular UUID.
+func parseCLIID(s string) uuid.UUID {
+	if s == "" {
+		log.Fatal("Missing ID")
+	}
+	if id, err := fromStatelyUUID(s); err == nil {
+		return id
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		log.Fatalf("Invalid ID %q: %v", s, err)
+	}
+	return id
+}
+
+// resourceArg accepts a resource's ID, in either form parseCLIID does, or its
+// name.
+func resourceArg(ctx context.Context, a admin, s string) uuid.UUID {
+	if s == "" {
+		log.Fatal("Missing resource")
+	}
+	if id, err := fromStatelyUUID(s); err == nil {
+		return id
+	}
+	if id, err := uuid.Parse(s); err == nil {
+		return id
+	}
+	resource, err := a.GetResourceByName(ctx, s)
+	if err != nil {
+		log.Fatalf("Failed to look up resource %q: %v", s, err)
+	}
+	if resource == nil {
+		log.Fatalf("No resource is named %q", s)
+	}
+	return resource.Id
+}
+
+func formatExpiry(lease *schema.Lease) string {
+	expiry := client.LeaseExpiry(lease)
+	if expiry.IsZero() {
+		return "never"
+	}
+	return formatTime(expiry)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
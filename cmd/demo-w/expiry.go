@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/client"
+	"github.com/StatelyCloud/demo-w/pkg/ddb"
+	"github.com/StatelyCloud/demo-w/pkg/notify"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+)
+
+const (
+	expiryInterval = time.Minute
+	// expiryWarning is how far ahead of expiry we send "expiring soon" events.
+	expiryWarning = 15 * time.Minute
+)
+
+// expiryProcessor watches leases approach their expiry and reports them to a
+// notifier. Stately's TTL deletes leases silently, so the processor remembers
+// what it saw on the previous pass to notice leases that have disappeared.
+type expiryProcessor struct {
+	client   *client.Client
+	notifier notify.Notifier
+	warning  time.Duration
+
+	// warned maps lease IDs to the expiry time we last warned about. Touching
+	// a lease moves its expiry, which makes it eligible for another warning.
+	warned map[uuid.UUID]time.Time
+	// expired holds leases we've already sent an "expired" event for.
+	expired map[uuid.UUID]bool
+	// seen holds the leases from the previous pass.
+	seen map[uuid.UUID]*schema.Lease
+}
+
+func newExpiryProcessor(c *client.Client, notifier notify.Notifier, warning time.Duration) *expiryProcessor {
+	return &expiryProcessor{
+		client:   c,
+		notifier: notifier,
+		warning:  warning,
+		warned:   map[uuid.UUID]time.Time{},
+		expired:  map[uuid.UUID]bool{},
+		seen:     map[uuid.UUID]*schema.Lease{},
+	}
+}
+
+func (p *expiryProcessor) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.process(ctx, time.Now()); err != nil {
+			log.Printf("Failed to process lease expiry: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *expiryProcessor) process(ctx context.Context, now time.Time) error {
+	leases, err := p.client.ListLeases(ctx)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[uuid.UUID]*schema.Lease, len(leases))
+	for _, lease := range leases {
+		current[lease.Id] = lease
+		expiresAt := client.LeaseExpiry(lease)
+		switch {
+		case expiresAt.IsZero():
+			// Leases without a duration never expire.
+		case client.LeaseDenied(lease):
+			// Denied leases never granted access, so their expiry isn't news.
+		case !expiresAt.After(now):
+			p.notifyExpired(ctx, lease, expiresAt, now)
+		case expiresAt.Sub(now) <= p.warning && !p.warned[lease.Id].Equal(expiresAt):
+			p.warned[lease.Id] = expiresAt
+			p.notify(ctx, notify.Event{Type: notify.LeaseExpiringSoon, Time: now, Lease: lease, ExpiresAt: expiresAt})
+		}
+	}
+
+	for id, lease := range p.seen {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		// A lease that vanished before its expiry was deleted on purpose, so
+		// only report the ones the TTL took.
+		if expiresAt := client.LeaseExpiry(lease); !expiresAt.IsZero() && !expiresAt.After(now) {
+			p.notifyExpired(ctx, lease, expiresAt, now)
+		}
+		delete(p.warned, id)
+		delete(p.expired, id)
+	}
+	p.seen = current
+	return nil
+}
+
+func (p *expiryProcessor) notifyExpired(ctx context.Context, lease *schema.Lease, expiresAt, now time.Time) {
+	if p.expired[lease.Id] {
+		return
+	}
+	p.expired[lease.Id] = true
+	p.notify(ctx, notify.Event{Type: notify.LeaseExpired, Time: now, Lease: lease, ExpiresAt: expiresAt})
+}
+
+func (p *expiryProcessor) notify(ctx context.Context, event notify.Event) {
+	if err := p.notifier.Notify(ctx, event); err != nil {
+		log.Printf("Failed to send %s for lease %s: %v", event.Type, event.Lease.Id, err)
+	}
+}
+
+// runDDBLeaseReaper deletes expired leases from the DynamoDB backend rather
+// than waiting (up to 48 hours) for DynamoDB's TTL to catch up.
+func runDDBLeaseReaper(ctx context.Context, d *ddb.DynamoDBClient, notifier notify.Notifier, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		deleted, err := d.DeleteExpiredLeases(ctx, now)
+		if err != nil {
+			log.Printf("Failed to delete expired DynamoDB leases: %v", err)
+		}
+		for _, lease := range deleted {
+			event := notify.Event{
+				Type: notify.LeaseExpired,
+				Time: now,
+				Lease: &schema.Lease{
+					Id:              lease.ID,
+					UserId:          lease.UserId,
+					ResourceId:      lease.ResId,
+					Reason:          lease.Reason,
+					DurationSeconds: lease.Duration,
+					Approver:        lease.Approver,
+					CreatedAt:       lease.CreatedAt,
+					LastTouched:     lease.LastModified,
+				},
+				ExpiresAt: time.Unix(lease.TTL, 0),
+			}
+			if err := notifier.Notify(ctx, event); err != nil {
+				log.Printf("Failed to send %s for lease %s: %v", event.Type, lease.ID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// readyTimeout bounds how long /readyz waits on the stores, so that a hung
+// sidecar fails the probe instead of stalling it.
+const readyTimeout = 2 * time.Second
+
+// handleHealthz reports that the process is up and serving. It deliberately
+// doesn't touch the store: a store outage should take the pod out of the load
+// balancer (see handleReadyz), not get it restarted.
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports whether the server can take traffic: it isn't shutting
+// down, and its stores are reachable.
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if err := s.client.Ping(ctx); err != nil {
+		http.Error(w, "stately: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if s.ddb != nil {
+		if err := s.ddb.Ping(ctx); err != nil {
+			http.Error(w, "dynamodb: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// idempotent lets clients safely retry a POST to h by sending an
+// Idempotency-Key header. The first request with a key runs as usual and its
+// response is saved; retries with the same key and body get that response
+// back, marked with an Idempotent-Replayed header, instead of running again.
+// Keys are scoped to the endpoint and API version.
+func (s *server) idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method != http.MethodPost {
+			h(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength), http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+		key = fmt.Sprintf("%s v%d %s", r.URL.Path, requestAPIVersion(r), key)
+
+		existing, err := s.client.ReserveIdempotencyKey(r.Context(), key, hash, writeTimeout)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.RequestHash != hash:
+				http.Error(w, "Idempotency-Key has already been used for a different request", http.StatusUnprocessableEntity)
+			case existing.Status == 0:
+				http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+			default:
+				if existing.ContentType != "" {
+					w.Header().Set("Content-Type", existing.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(int(existing.Status))
+				io.WriteString(w, existing.Body)
+			}
+			return
+		}
+
+		// The key is only reserved for writeTimeout, so the request mustn't
+		// run for longer or a retry could run it again.
+		ctx, cancel := context.WithTimeout(r.Context(), writeTimeout)
+		defer cancel()
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r.WithContext(ctx))
+
+		// Save the response even if the client has gone away, since it's the
+		// client's retry that needs it.
+		ctx = context.WithoutCancel(r.Context())
+		if rec.status >= http.StatusInternalServerError || rec.status == http.StatusTooManyRequests {
+			// These might succeed next time, so let the key be retried.
+			if err := s.client.ReleaseIdempotencyKey(ctx, key); err != nil {
+				log.Printf("Failed to release idempotency key %q: %v", key, err)
+			}
+			return
+		}
+		err = s.client.CompleteIdempotencyKey(ctx, &schema.IdempotencyRecord{
+			Key:         key,
+			RequestHash: hash,
+			Status:      uint32(rec.status),
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body.String(),
+		})
+		if err != nil {
+			log.Printf("Failed to save response for idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// recordingWriter passes a response through while keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -4,19 +4,36 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/StatelyCloud/demo-w/pkg/client"
+	"github.com/StatelyCloud/demo-w/pkg/ddb"
+	"github.com/StatelyCloud/demo-w/pkg/metrics"
+	"github.com/StatelyCloud/demo-w/pkg/notify"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/demo-w/pkg/tracing"
+	"github.com/StatelyCloud/demo-w/pkg/webhook"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 type server struct {
 	client *client.Client
+	// ddb is only set when DDB_TABLE_NAME is.
+	ddb *ddb.DynamoDBClient
+	// draining is set once we've been told to shut down, so that /readyz
+	// fails and the load balancer stops sending us new requests.
+	draining atomic.Bool
 }
 
 type createUserRequest struct {
@@ -26,20 +43,109 @@ type createUserRequest struct {
 
 type createResourceRequest struct {
 	Name string `json:"name"`
+	// Owner is the user who approves leases for the resource. Leave it empty
+	// to let any other user approve them.
+	Owner string `json:"owner"`
 }
 
 type createLeaseRequest struct {
-	UserID      string  `json:"userId"`
-	ResourceID  string  `json:"resourceId"`
-	DurationHrs float64 `json:"durationHours"`
-	Approver    string  `json:"approver"`
+	UserID     string `json:"userId"`
+	ResourceID string `json:"resourceId"`
+	// ResourceName can be given instead of ResourceID.
+	ResourceName string  `json:"resourceName,omitempty"`
+	Reason       string  `json:"reason"`
+	DurationHrs  float64 `json:"durationHours"`
+	Approver     string  `json:"approver"`
+	// StartTime schedules the lease for a future window. Leave it empty to
+	// start the lease immediately.
+	StartTime time.Time `json:"startTime"`
+	// Emergency asks for a break-glass lease, which skips approval but needs
+	// a reason and an IncidentRef, and is reviewed afterwards.
+	Emergency   bool   `json:"emergency"`
+	IncidentRef string `json:"incidentRef"`
 }
 
-const PORT = "8080"
+// approveLeaseRequest is the body of both the approve and deny actions.
+type approveLeaseRequest struct {
+	Approver string `json:"approver"`
+	Comment  string `json:"comment"`
+}
+
+type checkResponse struct {
+	Allowed bool          `json:"allowed"`
+	Lease   *schema.Lease `json:"lease,omitempty"`
+}
+
+const defaultPort = "8080"
+
+// Server timeouts. The write timeout is long enough for /admin/export to
+// stream a good-sized store.
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 5 * time.Minute
+	idleTimeout       = 2 * time.Minute
+)
+
+// On SIGTERM we keep serving for drainDelay with /readyz failing, so that the
+// load balancer notices before we stop accepting connections, then give
+// in-flight requests up to shutdownTimeout to finish. Together they fit in
+// Kubernetes' default 30s termination grace period.
+const (
+	drainDelay      = 5 * time.Second
+	shutdownTimeout = 20 * time.Second
+)
 
 func main() {
 	ctx := context.Background()
 
+	// With no arguments we run the server, as we always have.
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(ctx)
+
+	switch cmd {
+	case "serve":
+		serve(ctx)
+	case "user":
+		runUser(ctx, args)
+	case "resource":
+		runResource(ctx, args)
+	case "lease":
+		runLease(ctx, args)
+	case "review":
+		runReview(ctx, args)
+	case "report":
+		runReport(ctx, args)
+	case "campaign":
+		runCampaign(ctx, args)
+	case "template":
+		runTemplate(ctx, args)
+	case "check":
+		runCheck(ctx, args)
+	case "export":
+		runExport(ctx, args)
+	case "import":
+		runImport(ctx, args)
+	case "migrate-ddb":
+		runMigrateDDB(ctx, args)
+	case "backfill-ddb":
+		runBackfillDDB(ctx, args)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\nUsage: demo-w [serve|user|resource|lease|review|report|campaign|template|check|export|import|migrate-ddb|backfill-ddb] [flags]\n", cmd)
+		os.Exit(2)
+	}
+}
+
+// newClientFromEnv connects to the store named by STATELY_STORE_ID.
+func newClientFromEnv(ctx context.Context) *client.Client {
 	storeStr := os.Getenv("STATELY_STORE_ID")
 	if storeStr == "" {
 		log.Fatal("STATELY_STORE_ID environment variable is required")
@@ -53,28 +159,235 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create client: %v", err)
 	}
+	return c
+}
+
+func serve(ctx context.Context) {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = defaultPort
+	}
 
+	// Background workers outlive the signal, so that requests still being
+	// drained can notify webhooks; they stop once the server has.
+	ctx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+
+	c := newClientFromEnv(ctx)
+	c.SetLimits(limitsFromEnv())
 	s := &server{client: c}
 
-	// Register routes
-	http.HandleFunc("/users", s.handleCreateUser)
-	http.HandleFunc("/resources", s.handleCreateResource)
-	http.HandleFunc("/leases", s.handleCreateLease)
-	http.HandleFunc("/users/", s.handleGetUserLeases)
-	http.HandleFunc("/resources/", s.handleGetResourceLeases)
+	go s.runLeaseActivator(ctx, activatorInterval)
+	go s.runCampaigns(ctx, campaignInterval)
+
+	if ttl := accessCacheTTLFromEnv(); ttl > 0 {
+		c.EnableAccessCache(ttl)
+		go s.runAccessCacheSync(ctx, accessCacheSyncInterval)
+	}
+
+	// The client calls its notifier inline with every lease write, so the
+	// notifiers that talk to the network are queued and sent in the
+	// background.
+	envNotifier := notify.NewAsync(notifierFromEnv(), notifyQueueSize)
+	go envNotifier.Run(ctx)
+
+	// Lease events also go out to webhook subscribers, who can register and
+	// unregister at runtime.
+	dispatcher := webhook.NewDispatcher(c)
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		dispatcher.Run(ctx, webhookWorkers)
+	}()
+	notifier := notify.Multi{envNotifier, dispatcher}
+	c.SetNotifier(notifier)
+
+	go s.runDomainMetrics(ctx, domainMetricsInterval)
+	go newExpiryProcessor(c, notifier, expiryWarning).run(ctx, expiryInterval)
+
+	// Optionally keep expired leases from lingering in the DynamoDB backend.
+	if table := os.Getenv("DDB_TABLE_NAME"); table != "" {
+		d, err := ddb.NewDynamoDBClient(ctx, table, ddbOptionsFromEnv()...)
+		if err != nil {
+			log.Fatalf("Failed to create DynamoDB client: %v", err)
+		}
+		s.ddb = d
+		go runDDBLeaseReaper(ctx, d, notifier, expiryInterval)
+	}
+
+	// Register routes. The API routes are served at both versions - see
+	// versions.go.
+	api := http.NewServeMux()
+	handle(api, "/users", s.idempotent(s.handleUsers))
+	handle(api, "/resources", s.idempotent(s.handleResources))
+	handle(api, "/leases", s.idempotent(s.handleLeases))
+	handle(api, "/leases/", s.handleLease)
+	handle(api, "/leases/search", s.handleSearchLeases)
+	handle(api, "/users/", s.handleUser)
+	handle(api, "/resources/", s.handleGetResourceLeases)
+	handle(api, "/check", s.handleCheckAccess)
+	handle(api, "/approvals/pending", s.handleApprovalsPending)
+	handle(api, "/reviews", s.handleListReviews)
+	handle(api, "/reviews/", s.handleAcknowledgeReview)
+	handle(api, "/reports/access", s.handleAccessReport)
+	handle(api, "/campaigns", s.handleCampaigns)
+	handle(api, "/campaigns/", s.handleCampaign)
+	handle(api, "/templates", s.handleTemplates)
+	handle(api, "/templates/", s.idempotent(s.handleTemplate))
+	limiter := rateLimiterFromEnv()
+	go limiter.run(ctx)
+	limited := limiter.wrap(api)
+	defaultVersion := defaultAPIVersionFromEnv()
+	http.Handle("/v1/", http.StripPrefix("/v1", withAPIVersion(apiV1, defaultVersion, limited)))
+	http.Handle("/v2/", http.StripPrefix("/v2", withAPIVersion(apiV2, defaultVersion, limited)))
+	http.Handle("/", withAPIVersion(0, defaultVersion, limited))
+	http.Handle("/metrics", metrics.Handler())
+	http.HandleFunc("/healthz", s.handleHealthz)
+	http.HandleFunc("/readyz", s.handleReadyz)
+
+	// The bulk endpoints can read and overwrite everything, and webhook
+	// subscriptions get a copy of every lease event and make the server send
+	// requests wherever they point, so they're only served when there's a
+	// token to protect them with.
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		handle(http.DefaultServeMux, "/webhooks", requireAdmin(token, s.handleWebhooks))
+		handle(http.DefaultServeMux, "/webhooks/", requireAdmin(token, s.handleWebhook))
+		handle(http.DefaultServeMux, "/admin/export", requireAdmin(token, s.handleExport))
+		handle(http.DefaultServeMux, "/admin/import", requireAdmin(token, s.handleImport))
+	}
 
-	log.Printf("Server starting on port %s", PORT)
-	if err := http.ListenAndServe(":"+PORT, nil); err != nil {
+	srv := &http.Server{
+		Addr:              ":" + port,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var sig os.Signal
+	select {
+	case err := <-serveErr:
 		log.Fatal(err)
+	case sig = <-signals:
+	}
+	// A second signal kills us without waiting.
+	signal.Reset(syscall.SIGTERM, os.Interrupt)
+
+	log.Printf("Received %v, shutting down", sig)
+	s.draining.Store(true)
+	if sig == syscall.SIGTERM {
+		time.Sleep(drainDelay)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to drain in-flight requests: %v", err)
 	}
+	log.Print("Server stopped")
+
+	// Webhook deliveries that are still being retried are dead-lettered as
+	// the workers stop, so wait for that rather than lose them.
+	stopWorkers()
+	<-dispatcherDone
 }
 
-func (s *server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// handle registers h on mux, recording request metrics and a server span
+// (continuing any trace context the caller sent) under its pattern.
+func handle(mux *http.ServeMux, pattern string, h http.HandlerFunc) {
+	mux.Handle(pattern, metrics.InstrumentHandler(pattern, otelhttp.NewHandler(h, pattern)))
+}
+
+// notifyQueueSize is how many events can wait for the notifiers from
+// notifierFromEnv before new ones are dropped.
+const notifyQueueSize = 1000
+
+// notifierFromEnv builds the notifier for lease events. Events are always
+// logged, and can also be sent to a webhook (NOTIFY_WEBHOOK_URL) or emailed
+// through an SMTP relay (NOTIFY_SMTP_ADDR, NOTIFY_EMAIL_FROM, NOTIFY_EMAIL_TO).
+func notifierFromEnv() notify.Notifier {
+	notifiers := notify.Multi{notify.Log{}}
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, &notify.Webhook{URL: url})
+	}
+	if addr := os.Getenv("NOTIFY_SMTP_ADDR"); addr != "" {
+		notifiers = append(notifiers, &notify.SMTP{
+			Addr: addr,
+			From: os.Getenv("NOTIFY_EMAIL_FROM"),
+			To:   strings.Split(os.Getenv("NOTIFY_EMAIL_TO"), ","),
+		})
+	}
+	return notifiers
+}
+
+// handleUsers serves:
+//
+//	POST /users              create a user
+//	GET  /users              list every user
+//	GET  /users?id={id}      get one user
+//	GET  /users?email={email}
+func (s *server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.handleCreateUser(w, r)
+	case http.MethodGet:
+		s.handleGetUsers(w, r)
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
 	}
+}
 
+func (s *server) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var body any
+	switch {
+	case query.Has("id"):
+		userID, err := fromStatelyUUID(query.Get("id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid user ID format %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		user, err := s.client.GetUser(r.Context(), userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		body = user
+	case query.Has("email"):
+		user, err := s.client.GetUserByEmail(r.Context(), query.Get("email"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		body = user
+	default:
+		users, err := s.client.ListUsers(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body = users
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	var req createUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -83,7 +396,7 @@ func (s *server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 
 	user, err := s.client.CreateUser(r.Context(), req.Name, req.Email)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
@@ -91,21 +404,62 @@ func (s *server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
-func (s *server) handleCreateResource(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// handleResources serves:
+//
+//	POST /resources         create a resource
+//	GET  /resources         list every resource
+//	GET  /resources?name=   the resource with that name
+func (s *server) handleResources(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.handleCreateResource(w, r)
+	case http.MethodGet:
+		if query := r.URL.Query(); query.Has("name") {
+			resource, err := s.client.GetResourceByName(r.Context(), query.Get("name"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if resource == nil {
+				http.Error(w, "resource not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resource)
+			return
+		}
+		resources, err := s.client.ListResources(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resources)
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
 	}
+}
 
+func (s *server) handleCreateResource(w http.ResponseWriter, r *http.Request) {
 	var req createResourceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	resource, err := s.client.CreateResource(r.Context(), req.Name)
+	var ownerID uuid.UUID
+	if req.Owner != "" {
+		var err error
+		ownerID, err = fromStatelyUUID(req.Owner)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid owner ID format %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resource, err := s.client.CreateResource(r.Context(), req.Name, ownerID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
@@ -113,11 +467,30 @@ func (s *server) handleCreateResource(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resource)
 }
 
-func (s *server) handleCreateLease(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// handleLeases serves:
+//
+//	POST /leases  request a lease
+//	GET  /leases  list every lease
+//
+// Leases for one user or resource are at /users/{id} and /resources/{id}.
+func (s *server) handleLeases(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.handleCreateLease(w, r)
+	case http.MethodGet:
+		leases, err := s.client.ListLeases(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(versioned(r, leases))
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
 	}
+}
+
+func (s *server) handleCreateLease(w http.ResponseWriter, r *http.Request) {
 
 	var req createLeaseRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -131,8 +504,19 @@ func (s *server) handleCreateLease(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resourceID, err := fromStatelyUUID(req.ResourceID)
-	if err != nil {
+	var resourceID uuid.UUID
+	if req.ResourceID == "" && req.ResourceName != "" {
+		resource, err := s.client.GetResourceByName(r.Context(), req.ResourceName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if resource == nil {
+			http.Error(w, fmt.Sprintf("No resource is named %q", req.ResourceName), http.StatusBadRequest)
+			return
+		}
+		resourceID = resource.Id
+	} else if resourceID, err = fromStatelyUUID(req.ResourceID); err != nil {
 		http.Error(w, fmt.Sprintf("Invalid resource ID format %s", err.Error()), http.StatusBadRequest)
 		return
 	}
@@ -141,20 +525,124 @@ func (s *server) handleCreateLease(w http.ResponseWriter, r *http.Request) {
 	if req.Approver != "" {
 		approverID, err = fromStatelyUUID(req.Approver)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid resource ID format %s", err.Error()), http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("Invalid approver ID format %s", err.Error()), http.StatusBadRequest)
 			return
 		}
 	}
 
-	lease, err := s.client.CreateLease(r.Context(), userID, resourceID,
-		time.Duration(req.DurationHrs*float64(time.Hour)), approverID)
+	duration := time.Duration(req.DurationHrs * float64(time.Hour))
+	if req.Emergency {
+		if !req.StartTime.IsZero() || approverID != uuid.Nil {
+			http.Error(w, "Emergency leases start immediately and can't have an approver", http.StatusBadRequest)
+			return
+		}
+		lease, err := s.client.CreateEmergencyLease(r.Context(), userID, resourceID, req.Reason, req.IncidentRef, duration)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("ETag", client.LeaseETag(lease))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(versioned(r, lease))
+		return
+	}
+	if req.StartTime.After(time.Now()) {
+		scheduled, err := s.client.ScheduleLease(r.Context(), userID, resourceID, req.Reason, duration, approverID, req.StartTime)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(versioned(r, scheduled))
+		return
+	}
+
+	lease, err := s.client.CreateLease(r.Context(), userID, resourceID, req.Reason, duration, approverID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
+	w.Header().Set("ETag", client.LeaseETag(lease))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(lease)
+	json.NewEncoder(w).Encode(versioned(r, lease))
+}
+
+// handleLease serves the routes for a single lease:
+//
+//	GET    /leases/{id}
+//	DELETE /leases/{id}
+//	POST   /leases/{id}/approve
+//	POST   /leases/{id}/deny
+//	POST   /leases/{id}/touch
+//
+// Lease responses carry an ETag. Sending it back in an If-Match header makes
+// a DELETE, approve, deny or touch fail with 412 if the lease has changed since.
+func (s *server) handleLease(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(r.URL.Path[len("/leases/"):], "/")
+	leaseID, err := fromStatelyUUID(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid lease ID format %s (%s)", err.Error(), idStr), http.StatusBadRequest)
+		return
+	}
+	// "*" matches any version, which is the same as not checking, since
+	// updates to a missing lease fail anyway.
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "*" {
+		ifMatch = ""
+	}
+
+	var lease *schema.Lease
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		lease, err = s.client.GetLease(r.Context(), leaseID)
+	case action == "" && r.Method == http.MethodDelete:
+		err = s.client.DeleteLease(r.Context(), leaseID, ifMatch)
+	case (action == "approve" || action == "deny") && r.Method == http.MethodPost:
+		var req approveLeaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		approverID, idErr := fromStatelyUUID(req.Approver)
+		if idErr != nil {
+			http.Error(w, fmt.Sprintf("Invalid approver ID format %s", idErr.Error()), http.StatusBadRequest)
+			return
+		}
+		if action == "approve" {
+			lease, err = s.client.ApproveLease(r.Context(), leaseID, approverID, req.Comment, ifMatch)
+		} else {
+			lease, err = s.client.DenyLease(r.Context(), leaseID, approverID, req.Comment, ifMatch)
+		}
+	case action == "touch" && r.Method == http.MethodPost:
+		lease, err = s.client.TouchLease(r.Context(), leaseID, ifMatch)
+	case action == "" || action == "approve" || action == "deny" || action == "touch":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	if lease == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	etag := client.LeaseETag(lease)
+	w.Header().Set("ETag", etag)
+	if r.Method == http.MethodGet && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versioned(r, lease))
 }
 
 func (s *server) handleGetUserLeases(w http.ResponseWriter, r *http.Request) {
@@ -176,7 +664,7 @@ func (s *server) handleGetUserLeases(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(leases)
+	json.NewEncoder(w).Encode(versioned(r, leases))
 }
 
 func (s *server) handleGetResourceLeases(w http.ResponseWriter, r *http.Request) {
@@ -198,14 +686,100 @@ func (s *server) handleGetResourceLeases(w http.ResponseWriter, r *http.Request)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(leases)
+	json.NewEncoder(w).Encode(versioned(r, leases))
+}
+
+// handleApprovalsPending serves GET /approvals/pending?userId={id}, the
+// leases waiting for that user to approve or deny them.
+func (s *server) handleApprovalsPending(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := fromStatelyUUID(r.URL.Query().Get("userId"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid user ID format %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	leases, err := s.client.GetPendingApprovals(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versioned(r, leases))
+}
+
+func (s *server) handleCheckAccess(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := fromStatelyUUID(r.URL.Query().Get("userId"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid user ID format %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	resourceID, err := fromStatelyUUID(r.URL.Query().Get("resourceId"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid resource ID format %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	lease, err := s.client.CheckAccess(r.Context(), userID, resourceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if lease == nil {
+		w.WriteHeader(http.StatusForbidden)
+	}
+	json.NewEncoder(w).Encode(versioned(r, checkResponse{Allowed: lease != nil, Lease: lease}))
+}
+
+// errorStatus maps errors from the client to HTTP status codes.
+func errorStatus(err error) int {
+	var quotaErr *client.QuotaExceededError
+	switch {
+	case errors.Is(err, client.ErrLeaseNotFound), errors.Is(err, client.ErrReviewNotFound), errors.Is(err, client.ErrUserNotFound),
+		errors.Is(err, client.ErrCampaignNotFound), errors.Is(err, client.ErrCampaignItemNotFound), errors.Is(err, client.ErrTemplateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, client.ErrSelfApproval), errors.Is(err, client.ErrNotApprover):
+		return http.StatusForbidden
+	case errors.Is(err, client.ErrNotPending), errors.Is(err, client.ErrAlreadyReviewed), errors.Is(err, client.ErrEmergencyExtension),
+		errors.Is(err, client.ErrEmailTaken), errors.Is(err, client.ErrResourceNameTaken), errors.Is(err, client.ErrCampaignClosed),
+		errors.Is(err, client.ErrAlreadyDecided):
+		return http.StatusConflict
+	case errors.Is(err, client.ErrEmergencyDetails), errors.Is(err, client.ErrUnindexedSearch), errors.Is(err, client.ErrInvalidState),
+		errors.Is(err, client.ErrInvalidReport), errors.Is(err, client.ErrInvalidRange), errors.Is(err, client.ErrInvalidCampaign),
+		errors.Is(err, client.ErrInvalidTemplate), errors.Is(err, client.ErrInvalidEmail):
+		return http.StatusBadRequest
+	case errors.Is(err, client.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.As(err, &quotaErr):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
 func fromStatelyUUID(b64id string) (uuid.UUID, error) {
 	// decode the b64id to a byte slice
 	id, err := base64.StdEncoding.DecodeString(b64id)
 	if err != nil {
-		return uuid.Nil, err
+		// IDs in paths can also be URL-safe base64, since standard base64
+		// can contain a "/".
+		var urlErr error
+		if id, urlErr = base64.URLEncoding.DecodeString(b64id); urlErr != nil {
+			return uuid.Nil, err
+		}
 	}
 	// convert the byte slice to a UUID
 	u, err := uuid.FromBytes(id)
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/client"
+	"github.com/StatelyCloud/demo-w/pkg/metrics"
+)
+
+const domainMetricsInterval = time.Minute
+
+// runDomainMetrics periodically recomputes the lease gauges. They need a scan
+// of every lease, so they're refreshed on a timer rather than per scrape.
+func (s *server) runDomainMetrics(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.updateDomainMetrics(ctx, time.Now()); err != nil {
+			log.Printf("Failed to update lease metrics: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *server) updateDomainMetrics(ctx context.Context, now time.Time) error {
+	leases, err := s.client.ListLeases(ctx)
+	if err != nil {
+		return err
+	}
+
+	var active, pending int
+	perResource := map[string]int{}
+	for _, lease := range leases {
+		// The TTL may not have removed expired leases yet.
+		if expiresAt := client.LeaseExpiry(lease); !expiresAt.IsZero() && !now.Before(expiresAt) {
+			continue
+		}
+		switch {
+		case client.LeaseActive(lease, now):
+			active++
+		case client.LeasePending(lease):
+			pending++
+		}
+		perResource[base64.StdEncoding.EncodeToString(lease.ResourceId[:])]++
+	}
+
+	metrics.ActiveLeases.Set(float64(active))
+	metrics.PendingApprovals.Set(float64(pending))
+	// Reset so resources whose leases have all gone drop out.
+	metrics.LeasesPerResource.Reset()
+	for resourceID, n := range perResource {
+		metrics.LeasesPerResource.WithLabelValues(resourceID).Set(float64(n))
+	}
+	return nil
+}
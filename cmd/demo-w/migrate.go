@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/StatelyCloud/demo-w/pkg/ddb"
+	"github.com/StatelyCloud/demo-w/pkg/migrate"
+)
+
+// runMigrateDDB implements `demo-w migrate-ddb`, which copies the pkg/ddb
+// table into the Stately store and then checks the result.
+func runMigrateDDB(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("migrate-ddb", flag.ExitOnError)
+	table := fs.String("table", os.Getenv("DDB_TABLE_NAME"), "DynamoDB table to migrate from")
+	checkpoint := fs.String("checkpoint", "migrate-ddb.checkpoint.json", "File to save progress to, so the migration can be resumed")
+	pageSize := fs.Int("page-size", 100, "DynamoDB items to read per page")
+	spotChecks := fs.Int("spot-checks", 20, "How many of each kind of item to compare after migrating")
+	verifyOnly := fs.Bool("verify-only", false, "Skip the migration and only verify")
+	fs.Parse(args)
+
+	if *table == "" {
+		log.Fatal("-table or DDB_TABLE_NAME is required")
+	}
+	d, err := ddb.NewDynamoDBClient(ctx, *table, ddbOptionsFromEnv()...)
+	if err != nil {
+		log.Fatalf("Failed to create DynamoDB client: %v", err)
+	}
+
+	m := &migrate.Migrator{
+		Source:         d,
+		Target:         newClientFromEnv(ctx),
+		CheckpointPath: *checkpoint,
+		PageSize:       int32(*pageSize),
+	}
+
+	if !*verifyOnly {
+		if _, err := m.Run(ctx); err != nil {
+			log.Fatalf("Migration failed (re-run to resume from %s): %v", *checkpoint, err)
+		}
+	}
+
+	v, err := m.Verify(ctx, *spotChecks)
+	if err != nil {
+		log.Fatalf("Verification failed: %v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+	if !v.OK() {
+		os.Exit(1)
+	}
+}
+
+// runBackfillDDB implements `demo-w backfill-ddb`, which rewrites the GSI sort
+// keys of leases written before they included the lease's user and resource,
+// and lowercases the emails of users created before emails were normalized.
+func runBackfillDDB(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("backfill-ddb", flag.ExitOnError)
+	table := fs.String("table", os.Getenv("DDB_TABLE_NAME"), "DynamoDB table to backfill")
+	fs.Parse(args)
+
+	if *table == "" {
+		log.Fatal("-table or DDB_TABLE_NAME is required")
+	}
+	d, err := ddb.NewDynamoDBClient(ctx, *table, ddbOptionsFromEnv()...)
+	if err != nil {
+		log.Fatalf("Failed to create DynamoDB client: %v", err)
+	}
+	n, err := d.BackfillLeaseIndexKeys(ctx)
+	if err != nil {
+		log.Fatalf("Backfill failed after updating %d leases (re-run to finish): %v", n, err)
+	}
+	log.Printf("Updated %d leases", n)
+
+	normalized, conflicts, err := d.NormalizeUserEmails(ctx)
+	if err != nil {
+		log.Fatalf("Backfill failed after normalizing %d emails (re-run to finish): %v", normalized, err)
+	}
+	log.Printf("Normalized %d emails", normalized)
+	if len(conflicts) > 0 {
+		log.Printf("%d users have an email that differs only in case from another user's, and kept it as it was:", len(conflicts))
+		for _, user := range conflicts {
+			log.Printf("  %s %s", user.ID, user.Email)
+		}
+	}
+}
+
+// ddbOptionsFromEnv points the DynamoDB client at DDB_ENDPOINT, if it's set,
+// e.g. http://localhost:8000 for DynamoDB Local.
+func ddbOptionsFromEnv() []ddb.Option {
+	if endpoint := os.Getenv("DDB_ENDPOINT"); endpoint != "" {
+		return []ddb.Option{ddb.WithEndpoint(endpoint)}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/client"
+	"github.com/StatelyCloud/demo-w/pkg/metrics"
+	"golang.org/x/time/rate"
+)
+
+// Callers we haven't heard from in rateLimitIdle are forgotten, so the set of
+// buckets doesn't grow without bound.
+const rateLimitIdle = 10 * time.Minute
+
+// rateLimiter gives each caller a token bucket of API requests. Callers are
+// told apart by IP address; behind a load balancer set TRUST_X_FORWARDED_FOR
+// so that it's the client's address rather than the load balancer's.
+type rateLimiter struct {
+	limit          rate.Limit
+	burst          int
+	trustForwarded bool
+
+	mu      sync.Mutex
+	callers map[string]*rateLimitedCaller
+}
+
+type rateLimitedCaller struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiterFromEnv reads RATE_LIMIT_RPS (default 10) and RATE_LIMIT_BURST
+// (default 20). It returns nil, meaning no limit, if RATE_LIMIT_RPS is 0.
+func rateLimiterFromEnv() *rateLimiter {
+	rps := floatFromEnv("RATE_LIMIT_RPS", 10)
+	if rps <= 0 {
+		return nil
+	}
+	trust, _ := strconv.ParseBool(os.Getenv("TRUST_X_FORWARDED_FOR"))
+	return &rateLimiter{
+		limit:          rate.Limit(rps),
+		burst:          int(floatFromEnv("RATE_LIMIT_BURST", 20)),
+		trustForwarded: trust,
+		callers:        map[string]*rateLimitedCaller{},
+	}
+}
+
+// limitsFromEnv reads the lease limits from MAX_LEASES_PER_USER and
+// MAX_LEASES_PER_RESOURCE. Both default to 0, meaning no limit.
+func limitsFromEnv() client.Limits {
+	return client.Limits{
+		MaxLeasesPerUser:     int(floatFromEnv("MAX_LEASES_PER_USER", 0)),
+		MaxLeasesPerResource: int(floatFromEnv("MAX_LEASES_PER_RESOURCE", 0)),
+		MaxEmergencyDuration: durationFromEnv("EMERGENCY_MAX_DURATION", client.DefaultMaxEmergencyDuration),
+	}
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	s := os.Getenv(name)
+	if s == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		log.Fatalf("Invalid %s %q", name, s)
+	}
+	return d
+}
+
+func floatFromEnv(name string, fallback float64) float64 {
+	s := os.Getenv(name)
+	if s == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		log.Fatalf("Invalid %s %q", name, s)
+	}
+	return f
+}
+
+// wrap rejects requests from callers who have run out of tokens with a 429
+// and a Retry-After header. A nil rateLimiter lets everything through.
+func (l *rateLimiter) wrap(h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reservation := l.reserve(l.callerKey(r), time.Now())
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			metrics.RateLimitedRequests.Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (l *rateLimiter) reserve(key string, now time.Time) *rate.Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.callers[key]
+	if !ok {
+		c = &rateLimitedCaller{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.callers[key] = c
+	}
+	c.lastSeen = now
+	return c.limiter.ReserveN(now, 1)
+}
+
+// callerKey returns the address of whoever made the request. Only the last
+// X-Forwarded-For entry is used, since that's the one our load balancer
+// added; earlier entries come from the client and can't be trusted.
+func (l *rateLimiter) callerKey(r *http.Request) string {
+	if l.trustForwarded {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			last := forwarded[len(forwarded)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if addr := strings.TrimSpace(last); addr != "" {
+				return addr
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// run forgets idle callers until ctx is cancelled.
+func (l *rateLimiter) run(ctx context.Context) {
+	if l == nil {
+		return
+	}
+	ticker := time.NewTicker(rateLimitIdle)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for key, c := range l.callers {
+				if now.Sub(c.lastSeen) > rateLimitIdle {
+					delete(l.callers, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
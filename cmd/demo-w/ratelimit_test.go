@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func newTestRateLimiter(limit rate.Limit, burst int, trustForwarded bool) *rateLimiter {
+	return &rateLimiter{limit: limit, burst: burst, trustForwarded: trustForwarded, callers: map[string]*rateLimitedCaller{}}
+}
+
+func TestRateLimiterWrap(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		name    string
+		limiter *rateLimiter
+		// remoteAddrs are the callers of each request, in order.
+		remoteAddrs []string
+		want        []int
+	}{
+		{"no limit", nil, []string{"10.0.0.1:1", "10.0.0.1:1", "10.0.0.1:1"}, []int{200, 200, 200}},
+		{"within the burst", newTestRateLimiter(1, 3, false), []string{"10.0.0.1:1", "10.0.0.1:2", "10.0.0.1:3"}, []int{200, 200, 200}},
+		{"past the burst", newTestRateLimiter(1, 2, false), []string{"10.0.0.1:1", "10.0.0.1:2", "10.0.0.1:3"}, []int{200, 200, 429}},
+		{"callers have their own buckets", newTestRateLimiter(1, 1, false), []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.1:2"}, []int{200, 200, 429}},
+	} {
+		h := tc.limiter.wrap(ok)
+		for i, addr := range tc.remoteAddrs {
+			r := httptest.NewRequest(http.MethodGet, "/leases", nil)
+			r.RemoteAddr = addr
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.want[i] {
+				t.Errorf("%s: request %d = %d, want %d", tc.name, i, w.Code, tc.want[i])
+			}
+			if retryAfter := w.Header().Get("Retry-After"); (w.Code == http.StatusTooManyRequests) != (retryAfter != "") {
+				t.Errorf("%s: request %d got %d with Retry-After %q", tc.name, i, w.Code, retryAfter)
+			} else if retryAfter != "" && retryAfter != "1" {
+				t.Errorf("%s: request %d Retry-After = %q, want 1", tc.name, i, retryAfter)
+			}
+		}
+	}
+}
+
+func TestRateLimiterCallerKey(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		trustForwarded bool
+		forwarded      []string
+		want           string
+	}{
+		{"remote address", false, nil, "192.0.2.1"},
+		{"untrusted X-Forwarded-For", false, []string{"203.0.113.7"}, "192.0.2.1"},
+		{"trusted X-Forwarded-For", true, []string{"203.0.113.7"}, "203.0.113.7"},
+		{"last entry of a list", true, []string{"198.51.100.9, 203.0.113.7"}, "203.0.113.7"},
+		{"last of several headers", true, []string{"198.51.100.9", "203.0.113.7"}, "203.0.113.7"},
+		{"empty last entry", true, []string{"203.0.113.7, "}, "192.0.2.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/leases", nil)
+		r.RemoteAddr = "192.0.2.1:4321"
+		for _, v := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		l := newTestRateLimiter(1, 1, tc.trustForwarded)
+		if got := l.callerKey(r); got != tc.want {
+			t.Errorf("%s: callerKey = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/client"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+)
+
+// remoteAdmin implements admin by calling a server's v2 HTTP API.
+type remoteAdmin struct {
+	base string
+	http *http.Client
+}
+
+func newRemoteAdmin(server string) *remoteAdmin {
+	return &remoteAdmin{
+		base: strings.TrimSuffix(server, "/") + "/v2",
+		http: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends a request and decodes a successful JSON response into out. Error
+// statuses that pkg/client has an error for are turned back into that error.
+func (a *remoteAdmin) do(ctx context.Context, method, path string, headers map[string]string, body, out any) (int, error) {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.base+path, reqBody)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300 || (resp.StatusCode == http.StatusForbidden && strings.HasPrefix(path, "/check")):
+		// A denied access check is still a successful answer.
+		if out != nil && resp.StatusCode != http.StatusNoContent {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return resp.StatusCode, fmt.Errorf("failed to decode response: %w", err)
+			}
+		}
+		return resp.StatusCode, nil
+	case resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/leases/"):
+		return resp.StatusCode, client.ErrLeaseNotFound
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return resp.StatusCode, client.ErrPreconditionFailed
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return resp.StatusCode, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// pathID encodes an ID for a URL path. Standard base64 can contain "/", so
+// paths use the URL-safe alphabet, which the server also accepts.
+func pathID(id uuid.UUID) string {
+	return base64.URLEncoding.EncodeToString(id[:])
+}
+
+func ifMatchHeader(ifMatch string) map[string]string {
+	if ifMatch == "" {
+		return nil
+	}
+	return map[string]string{"If-Match": ifMatch}
+}
+
+func (a *remoteAdmin) CreateUser(ctx context.Context, displayName, email string) (*schema.User, error) {
+	var user schema.User
+	_, err := a.do(ctx, http.MethodPost, "/users", nil, createUserRequest{Name: displayName, Email: email}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (a *remoteAdmin) GetUser(ctx context.Context, userID uuid.UUID) (*schema.User, error) {
+	return a.getUser(ctx, url.Values{"id": {cliID(userID)}})
+}
+
+func (a *remoteAdmin) GetUserByEmail(ctx context.Context, email string) (*schema.User, error) {
+	return a.getUser(ctx, url.Values{"email": {email}})
+}
+
+func (a *remoteAdmin) UpdateUserEmail(ctx context.Context, userID uuid.UUID, email string) (*schema.User, error) {
+	var user schema.User
+	_, err := a.do(ctx, http.MethodPut, "/users/"+pathID(userID)+"/email", nil, updateUserEmailRequest{Email: email}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (a *remoteAdmin) getUser(ctx context.Context, query url.Values) (*schema.User, error) {
+	var user schema.User
+	status, err := a.do(ctx, http.MethodGet, "/users?"+query.Encode(), nil, nil, &user)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (a *remoteAdmin) ListUsers(ctx context.Context) ([]*schema.User, error) {
+	var users []*schema.User
+	_, err := a.do(ctx, http.MethodGet, "/users", nil, nil, &users)
+	return users, err
+}
+
+func (a *remoteAdmin) CreateResource(ctx context.Context, name string, owner uuid.UUID) (*schema.Resource, error) {
+	req := createResourceRequest{Name: name}
+	if owner != uuid.Nil {
+		req.Owner = cliID(owner)
+	}
+	var resource schema.Resource
+	_, err := a.do(ctx, http.MethodPost, "/resources", nil, req, &resource)
+	if err != nil {
+		return nil, err
+	}
+	return &resource, nil
+}
+
+func (a *remoteAdmin) GetResourceByName(ctx context.Context, name string) (*schema.Resource, error) {
+	var resource schema.Resource
+	status, err := a.do(ctx, http.MethodGet, "/resources?"+url.Values{"name": {name}}.Encode(), nil, nil, &resource)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resource, nil
+}
+
+func (a *remoteAdmin) ListResources(ctx context.Context) ([]*schema.Resource, error) {
+	var resources []*schema.Resource
+	_, err := a.do(ctx, http.MethodGet, "/resources", nil, nil, &resources)
+	return resources, err
+}
+
+func (a *remoteAdmin) CreateLease(ctx context.Context, userID, resourceID uuid.UUID, reason string, duration time.Duration, approver uuid.UUID) (*schema.Lease, error) {
+	req := createLeaseRequest{
+		UserID:      cliID(userID),
+		ResourceID:  cliID(resourceID),
+		Reason:      reason,
+		DurationHrs: duration.Hours(),
+	}
+	if approver != uuid.Nil {
+		req.Approver = cliID(approver)
+	}
+	var lease schema.Lease
+	if _, err := a.do(ctx, http.MethodPost, "/leases", nil, req, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+func (a *remoteAdmin) CreateEmergencyLease(ctx context.Context, userID, resourceID uuid.UUID, reason, incidentRef string, duration time.Duration) (*schema.Lease, error) {
+	req := createLeaseRequest{
+		UserID:      cliID(userID),
+		ResourceID:  cliID(resourceID),
+		Reason:      reason,
+		DurationHrs: duration.Hours(),
+		Emergency:   true,
+		IncidentRef: incidentRef,
+	}
+	var lease schema.Lease
+	if _, err := a.do(ctx, http.MethodPost, "/leases", nil, req, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+func (a *remoteAdmin) ListLeases(ctx context.Context) ([]*schema.Lease, error) {
+	var leases []*schema.Lease
+	_, err := a.do(ctx, http.MethodGet, "/leases", nil, nil, &leases)
+	return leases, err
+}
+
+func (a *remoteAdmin) GetLeasesForUser(ctx context.Context, userID uuid.UUID) ([]*schema.Lease, error) {
+	var leases []*schema.Lease
+	_, err := a.do(ctx, http.MethodGet, "/users/"+pathID(userID), nil, nil, &leases)
+	return leases, err
+}
+
+func (a *remoteAdmin) GetLeasesForResource(ctx context.Context, resourceID uuid.UUID) ([]*schema.Lease, error) {
+	var leases []*schema.Lease
+	_, err := a.do(ctx, http.MethodGet, "/resources/"+pathID(resourceID), nil, nil, &leases)
+	return leases, err
+}
+
+func (a *remoteAdmin) ApproveLease(ctx context.Context, leaseID, approver uuid.UUID, comment, ifMatch string) (*schema.Lease, error) {
+	return a.decideLease(ctx, "approve", leaseID, approver, comment, ifMatch)
+}
+
+func (a *remoteAdmin) DenyLease(ctx context.Context, leaseID, approver uuid.UUID, comment, ifMatch string) (*schema.Lease, error) {
+	return a.decideLease(ctx, "deny", leaseID, approver, comment, ifMatch)
+}
+
+func (a *remoteAdmin) decideLease(ctx context.Context, action string, leaseID, approver uuid.UUID, comment, ifMatch string) (*schema.Lease, error) {
+	req := approveLeaseRequest{Approver: cliID(approver), Comment: comment}
+	var lease schema.Lease
+	_, err := a.do(ctx, http.MethodPost, "/leases/"+pathID(leaseID)+"/"+action, ifMatchHeader(ifMatch), req, &lease)
+	if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+func (a *remoteAdmin) GetPendingApprovals(ctx context.Context, ownerID uuid.UUID) ([]*schema.Lease, error) {
+	query := url.Values{"userId": {cliID(ownerID)}}
+	var leases []*schema.Lease
+	_, err := a.do(ctx, http.MethodGet, "/approvals/pending?"+query.Encode(), nil, nil, &leases)
+	return leases, err
+}
+
+func (a *remoteAdmin) SearchLeases(ctx context.Context, filter client.LeaseFilter) ([]*schema.Lease, error) {
+	var leases []*schema.Lease
+	_, err := a.do(ctx, http.MethodGet, "/leases/search?"+leaseFilterQuery(filter).Encode(), nil, nil, &leases)
+	return leases, err
+}
+
+func (a *remoteAdmin) ReportAccess(ctx context.Context, by string, from, to time.Time) ([]client.AccessSummary, error) {
+	var rows []client.AccessSummary
+	_, err := a.do(ctx, http.MethodGet, "/reports/access?"+reportQuery(by, from, to).Encode(), nil, nil, &rows)
+	return rows, err
+}
+
+func (a *remoteAdmin) TouchLease(ctx context.Context, leaseID uuid.UUID, ifMatch string) (*schema.Lease, error) {
+	var lease schema.Lease
+	_, err := a.do(ctx, http.MethodPost, "/leases/"+pathID(leaseID)+"/touch", ifMatchHeader(ifMatch), nil, &lease)
+	if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+func (a *remoteAdmin) DeleteLease(ctx context.Context, leaseID uuid.UUID, ifMatch string) error {
+	_, err := a.do(ctx, http.MethodDelete, "/leases/"+pathID(leaseID), ifMatchHeader(ifMatch), nil, nil)
+	return err
+}
+
+func (a *remoteAdmin) CheckAccess(ctx context.Context, userID, resourceID uuid.UUID) (*schema.Lease, error) {
+	query := url.Values{"userId": {cliID(userID)}, "resourceId": {cliID(resourceID)}}
+	var resp checkResponse
+	if _, err := a.do(ctx, http.MethodGet, "/check?"+query.Encode(), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Lease, nil
+}
+
+func (a *remoteAdmin) ListEmergencyReviews(ctx context.Context, resourceID uuid.UUID) ([]*schema.EmergencyReview, error) {
+	query := url.Values{"resourceId": {cliID(resourceID)}}
+	var reviews []*schema.EmergencyReview
+	_, err := a.do(ctx, http.MethodGet, "/reviews?"+query.Encode(), nil, nil, &reviews)
+	return reviews, err
+}
+
+func (a *remoteAdmin) AcknowledgeEmergencyReview(ctx context.Context, leaseID, reviewer uuid.UUID, comment string) (*schema.EmergencyReview, error) {
+	req := acknowledgeReviewRequest{Reviewer: cliID(reviewer), Comment: comment}
+	var review schema.EmergencyReview
+	if _, err := a.do(ctx, http.MethodPost, "/reviews/"+pathID(leaseID)+"/acknowledge", nil, req, &review); err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+func (a *remoteAdmin) StartCampaign(ctx context.Context, name string, minDuration time.Duration, closesAt time.Time) (*schema.Campaign, error) {
+	req := startCampaignRequest{Name: name, MinDurationHours: minDuration.Hours(), ClosesAt: closesAt}
+	var campaign schema.Campaign
+	if _, err := a.do(ctx, http.MethodPost, "/campaigns", nil, req, &campaign); err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func (a *remoteAdmin) ListCampaigns(ctx context.Context) ([]*schema.Campaign, error) {
+	var campaigns []*schema.Campaign
+	_, err := a.do(ctx, http.MethodGet, "/campaigns", nil, nil, &campaigns)
+	return campaigns, err
+}
+
+func (a *remoteAdmin) GetCampaign(ctx context.Context, campaignID uuid.UUID) (*client.CampaignProgress, error) {
+	var progress client.CampaignProgress
+	if _, err := a.do(ctx, http.MethodGet, "/campaigns/"+pathID(campaignID), nil, nil, &progress); err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+func (a *remoteAdmin) ListCampaignItems(ctx context.Context, campaignID, owner uuid.UUID) ([]*schema.CampaignItem, error) {
+	path := "/campaigns/" + pathID(campaignID) + "/items"
+	if owner != uuid.Nil {
+		path += "?" + url.Values{"owner": {cliID(owner)}}.Encode()
+	}
+	var items []*schema.CampaignItem
+	_, err := a.do(ctx, http.MethodGet, path, nil, nil, &items)
+	return items, err
+}
+
+func (a *remoteAdmin) ConfirmCampaignItem(ctx context.Context, campaignID, leaseID, owner uuid.UUID, comment string) (*schema.CampaignItem, error) {
+	req := confirmCampaignItemRequest{Owner: cliID(owner), Comment: comment}
+	var item schema.CampaignItem
+	if _, err := a.do(ctx, http.MethodPost, "/campaigns/"+pathID(campaignID)+"/items/"+pathID(leaseID)+"/confirm", nil, req, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (a *remoteAdmin) CloseCampaign(ctx context.Context, campaignID uuid.UUID) (*client.CampaignProgress, error) {
+	var progress client.CampaignProgress
+	if _, err := a.do(ctx, http.MethodPost, "/campaigns/"+pathID(campaignID)+"/close", nil, nil, &progress); err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+func (a *remoteAdmin) PutTemplate(ctx context.Context, template *schema.LeaseTemplate) (*schema.LeaseTemplate, error) {
+	req := putTemplateRequest{
+		Name:        template.Name,
+		Description: template.Description,
+		Resources:   template.Resources,
+		DurationHrs: template.DurationSeconds.Hours(),
+		Reason:      template.Reason,
+	}
+	var saved schema.LeaseTemplate
+	if _, err := a.do(ctx, http.MethodPost, "/templates", nil, req, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+func (a *remoteAdmin) GetTemplate(ctx context.Context, name string) (*schema.LeaseTemplate, error) {
+	var template schema.LeaseTemplate
+	if _, err := a.do(ctx, http.MethodGet, "/templates/"+url.PathEscape(name), nil, nil, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (a *remoteAdmin) ListTemplates(ctx context.Context) ([]*schema.LeaseTemplate, error) {
+	var templates []*schema.LeaseTemplate
+	_, err := a.do(ctx, http.MethodGet, "/templates", nil, nil, &templates)
+	return templates, err
+}
+
+func (a *remoteAdmin) DeleteTemplate(ctx context.Context, name string) error {
+	_, err := a.do(ctx, http.MethodDelete, "/templates/"+url.PathEscape(name), nil, nil, nil)
+	return err
+}
+
+func (a *remoteAdmin) RequestTemplate(ctx context.Context, name string, userID uuid.UUID, reason string, duration time.Duration, approver uuid.UUID) ([]*schema.Lease, error) {
+	req := requestTemplateRequest{
+		UserID:      cliID(userID),
+		Reason:      reason,
+		DurationHrs: duration.Hours(),
+	}
+	if approver != uuid.Nil {
+		req.Approver = cliID(approver)
+	}
+	var leases []*schema.Lease
+	_, err := a.do(ctx, http.MethodPost, "/templates/"+url.PathEscape(name)+"/request", nil, req, &leases)
+	return leases, err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/client"
+)
+
+// handleAccessReport serves GET /reports/access, which takes:
+//
+//	by      resource (the default) or user
+//	from    a time (RFC 3339) or an offset from now (e.g. -720h). Defaults to
+//	        the beginning
+//	to      likewise. Defaults to now
+//	format  json (the default) or csv
+func (s *server) handleAccessReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	by, from, to, err := reportRangeFromQuery(query, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := s.client.ReportAccess(r.Context(), by, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=access-by-%s.csv", by))
+		writeAccessCSV(w, by, rows)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+func reportRangeFromQuery(query url.Values, now time.Time) (by string, from, to time.Time, err error) {
+	by = query.Get("by")
+	if by == "" {
+		by = client.ReportByResource
+	}
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := query.Get(name); v != "" {
+			if *t, err = parseWhen(name, v, now); err != nil {
+				return by, from, to, err
+			}
+		}
+	}
+	return by, from, to, nil
+}
+
+// reportQuery is the inverse of reportRangeFromQuery.
+func reportQuery(by string, from, to time.Time) url.Values {
+	query := url.Values{"by": {by}}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+	return query
+}
+
+// writeAccessCSV writes a report with a header row. The distinct column counts
+// users in reports by resource and resources in reports by user.
+func writeAccessCSV(w io.Writer, by string, rows []client.AccessSummary) error {
+	distinct := "distinct_users"
+	if by == client.ReportByUser {
+		distinct = "distinct_resources"
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "name", "leases", "lease_hours", distinct, "approved", "self_service"})
+	for _, row := range rows {
+		cw.Write([]string{
+			base64.StdEncoding.EncodeToString(row.ID), row.Name, strconv.Itoa(row.Leases),
+			strconv.FormatFloat(row.LeaseHours, 'f', 2, 64),
+			strconv.Itoa(row.DistinctUsers + row.DistinctResources),
+			strconv.Itoa(row.Approved), strconv.Itoa(row.SelfService),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type acknowledgeReviewRequest struct {
+	Reviewer string `json:"reviewer"`
+	Comment  string `json:"comment"`
+}
+
+// handleListReviews serves GET /reviews?resourceId={id}, the reviews of every
+// break-glass lease taken on the resource.
+func (s *server) handleListReviews(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resourceID, err := fromStatelyUUID(r.URL.Query().Get("resourceId"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid resource ID format %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	reviews, err := s.client.ListEmergencyReviews(r.Context(), resourceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// handleAcknowledgeReview serves POST /reviews/{leaseId}/acknowledge, which
+// signs off on a break-glass lease.
+func (s *server) handleAcknowledgeReview(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(r.URL.Path[len("/reviews/"):], "/")
+	if action != "acknowledge" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	leaseID, err := fromStatelyUUID(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid lease ID format %s (%s)", err.Error(), idStr), http.StatusBadRequest)
+		return
+	}
+
+	var req acknowledgeReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reviewerID, err := fromStatelyUUID(req.Reviewer)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid reviewer ID format %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	review, err := s.client.AcknowledgeEmergencyReview(r.Context(), leaseID, reviewerID, req.Comment)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
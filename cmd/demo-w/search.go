@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/client"
+	"github.com/google/uuid"
+)
+
+// handleSearchLeases serves GET /leases/search, which takes any of:
+//
+//	state          pending, approved, denied or emergency
+//	approver       the ID of the user who approved the lease
+//	reason         words the reason has to contain, e.g. INC-
+//	expiresAfter   a time (RFC 3339) or an offset from now (e.g. 30m)
+//	expiresBefore  likewise
+//	createdAfter   likewise, e.g. -24h
+//	createdBefore  likewise
+//	limit          the most leases to return
+func (s *server) handleSearchLeases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := leaseFilterFromQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	leases, err := s.client.SearchLeases(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versioned(r, leases))
+}
+
+func leaseFilterFromQuery(query url.Values, now time.Time) (client.LeaseFilter, error) {
+	filter := client.LeaseFilter{
+		State:  query.Get("state"),
+		Reason: query.Get("reason"),
+	}
+	if approver := query.Get("approver"); approver != "" {
+		id, err := fromStatelyUUID(approver)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid approver ID format %s", err.Error())
+		}
+		filter.Approver = id
+	}
+	for name, t := range map[string]*time.Time{
+		"expiresAfter":  &filter.ExpiresAfter,
+		"expiresBefore": &filter.ExpiresBefore,
+		"createdAfter":  &filter.CreatedAfter,
+		"createdBefore": &filter.CreatedBefore,
+	} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		var err error
+		if *t, err = parseWhen(name, v, now); err != nil {
+			return filter, err
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return filter, fmt.Errorf("Invalid limit %q", limit)
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
+
+// parseWhen parses a query parameter that's either an RFC 3339 time or an
+// offset from now, like -24h.
+func parseWhen(name, v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("Invalid %s %q: use an RFC 3339 time or an offset like 1h", name, v)
+	}
+	return t, nil
+}
+
+// leaseFilterQuery is the inverse of leaseFilterFromQuery.
+func leaseFilterQuery(filter client.LeaseFilter) url.Values {
+	query := url.Values{}
+	set := func(name, v string) {
+		if v != "" {
+			query.Set(name, v)
+		}
+	}
+	set("state", filter.State)
+	set("reason", filter.Reason)
+	if filter.Approver != uuid.Nil {
+		set("approver", cliID(filter.Approver))
+	}
+	for name, t := range map[string]time.Time{
+		"expiresAfter":  filter.ExpiresAfter,
+		"expiresBefore": filter.ExpiresBefore,
+		"createdAfter":  filter.CreatedAfter,
+		"createdBefore": filter.CreatedBefore,
+	} {
+		if !t.IsZero() {
+			set(name, t.Format(time.RFC3339))
+		}
+	}
+	if filter.Limit > 0 {
+		set("limit", strconv.Itoa(filter.Limit))
+	}
+	return query
+}
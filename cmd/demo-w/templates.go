@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+)
+
+type putTemplateRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Resources are resource names, not IDs.
+	Resources   []string `json:"resources"`
+	DurationHrs float64  `json:"durationHours"`
+	Reason      string   `json:"reason"`
+}
+
+// requestTemplateRequest is the body of POST /templates/{name}/request. Reason
+// and DurationHrs default to the template's.
+type requestTemplateRequest struct {
+	UserID      string  `json:"userId"`
+	Reason      string  `json:"reason"`
+	DurationHrs float64 `json:"durationHours"`
+	Approver    string  `json:"approver"`
+}
+
+// handleTemplates serves GET /templates, which lists every lease template, and
+// POST /templates, which creates or replaces one.
+func (s *server) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		templates, err := s.client.ListTemplates(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(templates)
+	case http.MethodPost:
+		var req putTemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		template, err := s.client.PutTemplate(r.Context(), &schema.LeaseTemplate{
+			Name:            req.Name,
+			Description:     req.Description,
+			Resources:       req.Resources,
+			DurationSeconds: time.Duration(req.DurationHrs * float64(time.Hour)),
+			Reason:          req.Reason,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(template)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTemplate serves:
+//
+//	GET    /templates/{name}           the template
+//	DELETE /templates/{name}           deleting it
+//	POST   /templates/{name}/request   requesting a lease on each of its
+//	                                   resources, as one bundle
+func (s *server) handleTemplate(w http.ResponseWriter, r *http.Request) {
+	name, action, _ := strings.Cut(r.URL.Path[len("/templates/"):], "/")
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		template, err := s.client.GetTemplate(r.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(template)
+	case action == "" && r.Method == http.MethodDelete:
+		if err := s.client.DeleteTemplate(r.Context(), name); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case action == "request" && r.Method == http.MethodPost:
+		s.handleRequestTemplate(w, r, name)
+	case action == "" || action == "request":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *server) handleRequestTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	var req requestTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, err := fromStatelyUUID(req.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid user ID format %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	approverID := uuid.Nil
+	if req.Approver != "" {
+		if approverID, err = fromStatelyUUID(req.Approver); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid approver ID format %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	duration := time.Duration(req.DurationHrs * float64(time.Hour))
+	leases, err := s.client.RequestTemplate(r.Context(), name, userID, req.Reason, duration, approverID)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(versioned(r, leases))
+}
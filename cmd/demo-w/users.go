@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type updateUserEmailRequest struct {
+	Email string `json:"email"`
+}
+
+// handleUser serves:
+//
+//	GET /users/{id}        the user's leases
+//	PUT /users/{id}/email  change the user's email
+func (s *server) handleUser(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(r.URL.Path[len("/users/"):], "/")
+	switch action {
+	case "":
+		s.handleGetUserLeases(w, r)
+		return
+	case "email":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := fromStatelyUUID(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid user ID format %s (%s)", err.Error(), idStr), http.StatusBadRequest)
+		return
+	}
+
+	var req updateUserEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.client.UpdateUserEmail(r.Context(), userID, req.Email)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
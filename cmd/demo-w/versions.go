@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+)
+
+// The API comes in two versions, matching the two versions of the schema:
+//
+//   - v1 leases have res_id and duration fields, and no approver.
+//   - v2 renamed those to resource_id and duration_seconds, and added approver.
+//
+// The store only holds v2 items, so v1 responses are translated on the way
+// out. A request picks its version with a /v1 or /v2 path prefix, or an
+// Accept-Version header on the unprefixed routes. Requests that don't say
+// get DEFAULT_API_VERSION, which defaults to 1 so that clients written before
+// versioning keep working.
+type apiVersion int
+
+const (
+	apiV1 apiVersion = 1
+	apiV2 apiVersion = 2
+)
+
+type apiVersionKey struct{}
+
+func parseAPIVersion(s string) (apiVersion, error) {
+	switch strings.TrimPrefix(strings.ToLower(s), "v") {
+	case "1":
+		return apiV1, nil
+	case "2":
+		return apiV2, nil
+	}
+	return 0, fmt.Errorf("unsupported API version %q", s)
+}
+
+func defaultAPIVersionFromEnv() apiVersion {
+	s := os.Getenv("DEFAULT_API_VERSION")
+	if s == "" {
+		return apiV1
+	}
+	v, err := parseAPIVersion(s)
+	if err != nil {
+		log.Fatalf("Invalid DEFAULT_API_VERSION: %v", err)
+	}
+	return v
+}
+
+// withAPIVersion serves h at the given version. If version is 0 it's taken
+// from the Accept-Version header, or the default.
+func withAPIVersion(version, fallback apiVersion, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := version
+		if v == 0 {
+			v = fallback
+			if header := r.Header.Get("Accept-Version"); header != "" {
+				var err error
+				if v, err = parseAPIVersion(header); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		w.Header().Set("API-Version", strconv.Itoa(int(v)))
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, v)))
+	})
+}
+
+func requestAPIVersion(r *http.Request) apiVersion {
+	if v, ok := r.Context().Value(apiVersionKey{}).(apiVersion); ok {
+		return v
+	}
+	return apiV2
+}
+
+// leaseV1 is a Lease as schema-v1 defined it.
+type leaseV1 struct {
+	Id          []byte `json:"id,omitempty"`
+	UserId      []byte `json:"user_id,omitempty"`
+	ResId       []byte `json:"res_id,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Duration    int64  `json:"duration,omitempty,string"`
+	LastTouched int64  `json:"lastTouched,omitempty,string"`
+	CreatedAt   int64  `json:"createdAt,omitempty,string"`
+}
+
+// scheduledLeaseV1 is a ScheduledLease with the v1 lease field names. v1
+// predates scheduling, but old clients can still send a startTime.
+type scheduledLeaseV1 struct {
+	Id        []byte `json:"id,omitempty"`
+	UserId    []byte `json:"user_id,omitempty"`
+	ResId     []byte `json:"res_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Duration  int64  `json:"duration,omitempty,string"`
+	StartAt   int64  `json:"start_at,omitempty,string"`
+	CreatedAt int64  `json:"createdAt,omitempty,string"`
+}
+
+type checkResponseV1 struct {
+	Allowed bool     `json:"allowed"`
+	Lease   *leaseV1 `json:"lease,omitempty"`
+}
+
+// versioned converts a response body to the shape the request's API version
+// expects. Only leases differ between versions, so everything else passes
+// through unchanged.
+func versioned(r *http.Request, body any) any {
+	if requestAPIVersion(r) != apiV1 {
+		return body
+	}
+	switch b := body.(type) {
+	case *schema.Lease:
+		return toLeaseV1(b)
+	case []*schema.Lease:
+		leases := make([]*leaseV1, len(b))
+		for i, lease := range b {
+			leases[i] = toLeaseV1(lease)
+		}
+		return leases
+	case *schema.ScheduledLease:
+		return &scheduledLeaseV1{
+			Id:        b.Id[:],
+			UserId:    b.UserId[:],
+			ResId:     b.ResourceId[:],
+			Reason:    b.Reason,
+			Duration:  int64(b.DurationSeconds.Seconds()),
+			StartAt:   b.StartAt.UnixMilli(),
+			CreatedAt: b.CreatedAt.UnixMilli(),
+		}
+	case checkResponse:
+		return checkResponseV1{Allowed: b.Allowed, Lease: toLeaseV1(b.Lease)}
+	}
+	return body
+}
+
+func toLeaseV1(lease *schema.Lease) *leaseV1 {
+	if lease == nil {
+		return nil
+	}
+	return &leaseV1{
+		Id:          lease.Id[:],
+		UserId:      lease.UserId[:],
+		ResId:       lease.ResourceId[:],
+		Reason:      lease.Reason,
+		Duration:    int64(lease.DurationSeconds.Seconds()),
+		LastTouched: lease.LastTouched.UnixMilli(),
+		CreatedAt:   lease.CreatedAt.UnixMilli(),
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+)
+
+const webhookWorkers = 4
+
+type createWebhookRequest struct {
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+}
+
+// handleWebhooks serves:
+//
+//	GET  /webhooks
+//	POST /webhooks
+func (s *server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		subs, err := s.client.ListWebhookSubscriptions(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, sub := range subs {
+			redactSecret(sub)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subs)
+	case http.MethodPost:
+		var req createWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.URL == "" || req.Secret == "" {
+			http.Error(w, "url and secret are required", http.StatusBadRequest)
+			return
+		}
+		if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "url must be an absolute http or https URL", http.StatusBadRequest)
+			return
+		}
+
+		sub, err := s.client.CreateWebhookSubscription(r.Context(), req.URL, req.Secret, req.Events, req.Description)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		redactSecret(sub)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sub)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWebhook serves:
+//
+//	DELETE /webhooks/{id}
+//	GET    /webhooks/{id}/dead-letters
+func (s *server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(r.URL.Path[len("/webhooks/"):], "/")
+	subID, err := fromStatelyUUID(idStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid webhook ID format %s (%s)", err.Error(), idStr), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodDelete:
+		if err := s.client.DeleteWebhookSubscription(r.Context(), subID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case action == "dead-letters" && r.Method == http.MethodGet:
+		deadLetters, err := s.client.GetWebhookDeadLetters(r.Context(), subID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deadLetters)
+	case action == "" || action == "dead-letters":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// redactSecret keeps signing secrets out of API responses.
+func redactSecret(sub *schema.WebhookSubscription) {
+	sub.Secret = ""
+}
@@ -0,0 +1,275 @@
+// Package bulk imports and exports users, resources and leases.
+//
+// Two formats are supported:
+//
+//   - NDJSON holds one Record per line, using the schema types' JSON encoding.
+//     A single stream can mix kinds, so a full export can be re-imported in one
+//     go.
+//   - CSV holds a single kind per stream, with a header row naming the columns
+//     (see the columns map). Columns can be in any order, and only the ones
+//     needed to identify a row are required.
+//
+// Imports are idempotent: users are matched to existing users by email and
+// resources by name, so re-running an import updates rows instead of
+// duplicating them. Leases are matched by ID.
+package bulk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+type Format string
+
+const (
+	NDJSON Format = "ndjson"
+	CSV    Format = "csv"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case NDJSON, CSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q (want ndjson or csv)", s)
+}
+
+type Kind string
+
+const (
+	Users     Kind = "user"
+	Resources Kind = "resource"
+	Leases    Kind = "lease"
+)
+
+// AllKinds lists every kind in the order they need to be imported, so that
+// leases come after the users and resources they refer to.
+var AllKinds = []Kind{Users, Resources, Leases}
+
+func ParseKind(s string) (Kind, error) {
+	switch k := Kind(s); k {
+	case Users, Resources, Leases:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown kind %q (want user, resource or lease)", s)
+}
+
+// Record is one line of an NDJSON stream. Exactly one of User, Resource and
+// Lease is set, matching Kind.
+type Record struct {
+	Kind     Kind             `json:"kind"`
+	User     *schema.User     `json:"user,omitempty"`
+	Resource *schema.Resource `json:"resource,omitempty"`
+	Lease    *schema.Lease    `json:"lease,omitempty"`
+}
+
+// columns are the CSV columns for each kind, in the order they're exported.
+var columns = map[Kind][]string{
+	Users:     {"id", "email", "display_name", "created_at"},
+	Resources: {"id", "name", "owner_id", "created_at"},
+	Leases:    {"id", "user_id", "resource_id", "reason", "approver", "denied_by", "decision_comment", "emergency", "incident_ref", "duration_seconds", "last_touched", "created_at"},
+}
+
+// Store is what imports read from and write to. *client.Client implements it.
+type Store interface {
+	ListUsers(ctx context.Context) ([]*schema.User, error)
+	ListResources(ctx context.Context) ([]*schema.Resource, error)
+	ListLeases(ctx context.Context) ([]*schema.Lease, error)
+	RestoreBatch(ctx context.Context, items ...stately.Item) error
+}
+
+// Export writes every item of the given kinds to w. NDJSON exports default to
+// every kind; CSV exports need exactly one.
+func Export(ctx context.Context, store Store, w io.Writer, format Format, kinds ...Kind) error {
+	if len(kinds) == 0 && format == NDJSON {
+		kinds = AllKinds
+	}
+	if len(kinds) != 1 && format == CSV {
+		return fmt.Errorf("CSV exports hold exactly one kind, got %d", len(kinds))
+	}
+
+	var write func(Record) error
+	switch format {
+	case NDJSON:
+		enc := json.NewEncoder(w)
+		write = func(rec Record) error { return enc.Encode(rec) }
+	case CSV:
+		cw := csv.NewWriter(w)
+		defer cw.Flush()
+		if err := cw.Write(columns[kinds[0]]); err != nil {
+			return err
+		}
+		write = func(rec Record) error { return cw.Write(toCSV(rec)) }
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	for _, kind := range kinds {
+		var records []Record
+		switch kind {
+		case Users:
+			users, err := store.ListUsers(ctx)
+			if err != nil {
+				return err
+			}
+			for _, user := range users {
+				records = append(records, Record{Kind: Users, User: user})
+			}
+		case Resources:
+			resources, err := store.ListResources(ctx)
+			if err != nil {
+				return err
+			}
+			for _, resource := range resources {
+				records = append(records, Record{Kind: Resources, Resource: resource})
+			}
+		case Leases:
+			leases, err := store.ListLeases(ctx)
+			if err != nil {
+				return err
+			}
+			for _, lease := range leases {
+				records = append(records, Record{Kind: Leases, Lease: lease})
+			}
+		}
+		for _, rec := range records {
+			if err := write(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func toCSV(rec Record) []string {
+	switch rec.Kind {
+	case Users:
+		u := rec.User
+		return []string{formatID(u.Id), u.Email, u.DisplayName, formatTime(u.CreatedAt)}
+	case Resources:
+		r := rec.Resource
+		return []string{formatID(r.Id), r.Name, formatID(r.OwnerId), formatTime(r.CreatedAt)}
+	default:
+		l := rec.Lease
+		return []string{
+			formatID(l.Id), formatID(l.UserId), formatID(l.ResourceId), l.Reason, formatID(l.Approver),
+			formatID(l.DeniedBy), l.DecisionComment, strconv.FormatBool(l.Emergency), l.IncidentRef,
+			strconv.FormatInt(int64(l.DurationSeconds/time.Second), 10),
+			formatTime(l.LastTouched), formatTime(l.CreatedAt),
+		}
+	}
+}
+
+// fromCSV builds a record from a row, using header to find each column. Empty
+// and missing columns are left as zero values.
+func fromCSV(kind Kind, header map[string]int, row []string) (Record, error) {
+	var err error
+	get := func(col string) string {
+		if i, ok := header[col]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	id := func(col string) uuid.UUID {
+		v := get(col)
+		if v == "" || err != nil {
+			return uuid.Nil
+		}
+		var parsed uuid.UUID
+		if parsed, err = parseID(v); err != nil {
+			err = fmt.Errorf("invalid %s: %w", col, err)
+		}
+		return parsed
+	}
+	ts := func(col string) time.Time {
+		v := get(col)
+		if v == "" || err != nil {
+			return time.Time{}
+		}
+		var parsed time.Time
+		if parsed, err = time.Parse(time.RFC3339, v); err != nil {
+			err = fmt.Errorf("invalid %s: %w", col, err)
+		}
+		return parsed
+	}
+
+	rec := Record{Kind: kind}
+	switch kind {
+	case Users:
+		rec.User = &schema.User{
+			Id:          id("id"),
+			Email:       get("email"),
+			DisplayName: get("display_name"),
+			CreatedAt:   ts("created_at"),
+		}
+	case Resources:
+		rec.Resource = &schema.Resource{
+			Id:        id("id"),
+			Name:      get("name"),
+			OwnerId:   id("owner_id"),
+			CreatedAt: ts("created_at"),
+		}
+	case Leases:
+		rec.Lease = &schema.Lease{
+			Id:              id("id"),
+			UserId:          id("user_id"),
+			ResourceId:      id("resource_id"),
+			Reason:          get("reason"),
+			Approver:        id("approver"),
+			DeniedBy:        id("denied_by"),
+			DecisionComment: get("decision_comment"),
+			IncidentRef:     get("incident_ref"),
+			LastTouched:     ts("last_touched"),
+			CreatedAt:       ts("created_at"),
+		}
+		if v := get("duration_seconds"); v != "" && err == nil {
+			seconds, perr := strconv.ParseInt(v, 10, 64)
+			if perr != nil {
+				err = fmt.Errorf("invalid duration_seconds: %w", perr)
+			}
+			rec.Lease.DurationSeconds = time.Duration(seconds) * time.Second
+		}
+		if v := get("emergency"); v != "" && err == nil {
+			emergency, perr := strconv.ParseBool(v)
+			if perr != nil {
+				err = fmt.Errorf("invalid emergency: %w", perr)
+			}
+			rec.Lease.Emergency = emergency
+		}
+	}
+	return rec, err
+}
+
+// formatID encodes IDs as base64, the same as the JSON encoding and the HTTP
+// API, so IDs can be copied between them.
+func formatID(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(id[:])
+}
+
+// parseID accepts base64 IDs as well as the usual hex form.
+func parseID(s string) (uuid.UUID, error) {
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return uuid.FromBytes(b)
+	}
+	return uuid.Parse(s)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,340 @@
+package bulk
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/client"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+// batchSize is the most items Stately accepts in one PutBatch.
+const batchSize = 50
+
+// RowError describes a row that couldn't be imported. Row is the line number
+// in the input, starting at 1.
+type RowError struct {
+	Row   int    `json:"row"`
+	Kind  Kind   `json:"kind,omitempty"`
+	Error string `json:"error"`
+}
+
+// Report summarizes an import. The counts are rows written, whether they
+// created a new item or updated an existing one.
+type Report struct {
+	Users     int        `json:"users"`
+	Resources int        `json:"resources"`
+	Leases    int        `json:"leases"`
+	Errors    []RowError `json:"errors"`
+}
+
+type row struct {
+	num  int
+	kind Kind
+	// items is the row's item, followed by the claim on its name if it's a
+	// resource.
+	items []stately.Item
+}
+
+type importer struct {
+	store Store
+	now   time.Time
+
+	usersByEmail    map[string]*schema.User
+	resourcesByName map[string]*schema.Resource
+	// remap maps user and resource IDs from the input to the IDs of the
+	// existing items they were matched with, so leases can follow them.
+	remap map[uuid.UUID]uuid.UUID
+	// known holds the IDs of every user and resource that exists, or will once
+	// the pending rows are written.
+	known map[uuid.UUID]bool
+
+	pending      []row
+	pendingItems int
+	report       Report
+}
+
+// Import reads records from r and writes them to the store in batches. CSV
+// input holds a single kind, which must be given; NDJSON records carry their
+// own kind. Rows that can't be parsed or written are listed in the report
+// rather than stopping the import - an error is only returned if the input or
+// the store can't be read at all.
+func Import(ctx context.Context, store Store, r io.Reader, format Format, kind Kind) (*Report, error) {
+	imp := &importer{
+		store:           store,
+		now:             time.Now(),
+		usersByEmail:    map[string]*schema.User{},
+		resourcesByName: map[string]*schema.Resource{},
+		remap:           map[uuid.UUID]uuid.UUID{},
+		known:           map[uuid.UUID]bool{},
+		report:          Report{Errors: []RowError{}},
+	}
+	if err := imp.load(ctx); err != nil {
+		return nil, err
+	}
+
+	var err error
+	switch format {
+	case NDJSON:
+		err = imp.readNDJSON(ctx, r)
+	case CSV:
+		if kind == "" {
+			return nil, errors.New("CSV imports need a kind")
+		}
+		err = imp.readCSV(ctx, r, kind)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return &imp.report, err
+	}
+	imp.flush(ctx)
+	return &imp.report, nil
+}
+
+// load indexes the existing users and resources so rows can be matched to
+// them.
+func (imp *importer) load(ctx context.Context) error {
+	users, err := imp.store.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		imp.usersByEmail[client.NormalizeEmail(user.Email)] = user
+		imp.known[user.Id] = true
+	}
+	resources, err := imp.store.ListResources(ctx)
+	if err != nil {
+		return err
+	}
+	for _, resource := range resources {
+		imp.resourcesByName[resource.Name] = resource
+		imp.known[resource.Id] = true
+	}
+	return nil
+}
+
+func (imp *importer) readNDJSON(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for num := 1; scanner.Scan(); num++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			imp.fail(num, "", err)
+			continue
+		}
+		imp.add(ctx, num, rec)
+	}
+	return scanner.Err()
+}
+
+func (imp *importer) readCSV(ctx context.Context, r io.Reader, kind Kind) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	names, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("reading CSV header: %w", err)
+	}
+	header := make(map[string]int, len(names))
+	for i, name := range names {
+		header[strings.TrimSpace(name)] = i
+	}
+
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			imp.fail(parseErr.StartLine, kind, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		num, _ := cr.FieldPos(0)
+		rec, err := fromCSV(kind, header, fields)
+		if err != nil {
+			imp.fail(num, kind, err)
+			continue
+		}
+		imp.add(ctx, num, rec)
+	}
+}
+
+// add validates a record, matches it against existing items and queues it for
+// writing.
+func (imp *importer) add(ctx context.Context, num int, rec Record) {
+	var item stately.Item
+	var err error
+	switch {
+	case rec.Kind == Users && rec.User != nil:
+		item, err = imp.user(rec.User)
+	case rec.Kind == Resources && rec.Resource != nil:
+		item, err = imp.resource(rec.Resource)
+	case rec.Kind == Leases && rec.Lease != nil:
+		item, err = imp.lease(rec.Lease)
+	default:
+		err = fmt.Errorf("record has no %q body", rec.Kind)
+	}
+	if err != nil {
+		imp.fail(num, rec.Kind, err)
+		return
+	}
+
+	items := []stately.Item{item}
+	if resource, ok := item.(*schema.Resource); ok {
+		items = append(items, &schema.ResourceName{Name: resource.Name, ResourceId: resource.Id, CreatedAt: resource.CreatedAt})
+	}
+	imp.pending = append(imp.pending, row{num: num, kind: rec.Kind, items: items})
+	imp.pendingItems += len(items)
+	// Rows have at most two items, so flushing one short of batchSize keeps
+	// every batch within it.
+	if imp.pendingItems >= batchSize-1 {
+		imp.flush(ctx)
+	}
+}
+
+func (imp *importer) user(user *schema.User) (*schema.User, error) {
+	user.Email = client.NormalizeEmail(user.Email)
+	if user.Email == "" {
+		return nil, errors.New("email is required")
+	}
+	if existing, ok := imp.usersByEmail[user.Email]; ok {
+		imp.match(user.Id, existing.Id)
+		user.Id = existing.Id
+		if user.CreatedAt.IsZero() {
+			user.CreatedAt = existing.CreatedAt
+		}
+	} else if user.Id == uuid.Nil {
+		user.Id = uuid.New()
+	} else if imp.known[user.Id] {
+		return nil, fmt.Errorf("id %s already belongs to another user or resource", user.Id)
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = imp.now
+	}
+	imp.usersByEmail[user.Email] = user
+	imp.known[user.Id] = true
+	return user, nil
+}
+
+func (imp *importer) resource(resource *schema.Resource) (*schema.Resource, error) {
+	resource.Name = strings.TrimSpace(resource.Name)
+	if resource.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if existing, ok := imp.resourcesByName[resource.Name]; ok {
+		imp.match(resource.Id, existing.Id)
+		resource.Id = existing.Id
+		if resource.CreatedAt.IsZero() {
+			resource.CreatedAt = existing.CreatedAt
+		}
+	} else if resource.Id == uuid.Nil {
+		resource.Id = uuid.New()
+	} else if imp.known[resource.Id] {
+		return nil, fmt.Errorf("id %s already belongs to another user or resource", resource.Id)
+	}
+	if resource.CreatedAt.IsZero() {
+		resource.CreatedAt = imp.now
+	}
+	// Users are imported first, so the owner has already been matched.
+	resource.OwnerId = imp.resolve(resource.OwnerId)
+	imp.resourcesByName[resource.Name] = resource
+	imp.known[resource.Id] = true
+	return resource, nil
+}
+
+// lease points the lease at the users and resources its input IDs were matched
+// with. Leases without an ID get a new one, so unlike users and resources they
+// are duplicated if they're imported twice.
+func (imp *importer) lease(lease *schema.Lease) (*schema.Lease, error) {
+	lease.UserId = imp.resolve(lease.UserId)
+	lease.ResourceId = imp.resolve(lease.ResourceId)
+	lease.Approver = imp.resolve(lease.Approver)
+	lease.DeniedBy = imp.resolve(lease.DeniedBy)
+	if !imp.known[lease.UserId] {
+		return nil, fmt.Errorf("unknown user %s", lease.UserId)
+	}
+	if !imp.known[lease.ResourceId] {
+		return nil, fmt.Errorf("unknown resource %s", lease.ResourceId)
+	}
+	if lease.Id == uuid.Nil {
+		lease.Id = uuid.New()
+	}
+	if lease.CreatedAt.IsZero() {
+		lease.CreatedAt = imp.now
+	}
+	if lease.LastTouched.IsZero() {
+		lease.LastTouched = lease.CreatedAt
+	}
+	return lease, nil
+}
+
+func (imp *importer) match(from, to uuid.UUID) {
+	if from != uuid.Nil && from != to {
+		imp.remap[from] = to
+	}
+}
+
+func (imp *importer) resolve(id uuid.UUID) uuid.UUID {
+	if to, ok := imp.remap[id]; ok {
+		return to
+	}
+	return id
+}
+
+// flush writes the pending rows. If the batch fails, each row is retried on
+// its own so that the error can be pinned on the rows that caused it.
+func (imp *importer) flush(ctx context.Context) {
+	if len(imp.pending) == 0 {
+		return
+	}
+	items := make([]stately.Item, 0, imp.pendingItems)
+	for _, r := range imp.pending {
+		items = append(items, r.items...)
+	}
+	if err := imp.store.RestoreBatch(ctx, items...); err == nil {
+		for _, r := range imp.pending {
+			imp.count(r.kind)
+		}
+	} else {
+		for _, r := range imp.pending {
+			if err := imp.store.RestoreBatch(ctx, r.items...); err != nil {
+				imp.fail(r.num, r.kind, err)
+				continue
+			}
+			imp.count(r.kind)
+		}
+	}
+	imp.pending = imp.pending[:0]
+	imp.pendingItems = 0
+}
+
+func (imp *importer) count(kind Kind) {
+	switch kind {
+	case Users:
+		imp.report.Users++
+	case Resources:
+		imp.report.Resources++
+	case Leases:
+		imp.report.Leases++
+	}
+}
+
+func (imp *importer) fail(num int, kind Kind, err error) {
+	imp.report.Errors = append(imp.report.Errors, RowError{Row: num, Kind: kind, Error: err.Error()})
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/metrics"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+)
+
+// accessCache holds CheckAccess results by (user, resource). An entry lives
+// until the lease it found expires or ttl passes, whichever is sooner, and is
+// dropped early when this client writes one of the user's leases for that
+// resource, or when SyncAccessCache sees the list it came from change.
+type accessCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[accessKey]*accessEntry
+	// generation is bumped by every invalidation, so a lookup that raced
+	// with a write doesn't put its now-stale result in the cache.
+	generation uint64
+}
+
+type accessKey struct {
+	user, resource uuid.UUID
+}
+
+type accessEntry struct {
+	lease   *schema.Lease
+	expires time.Time
+	// token is from the list the entry was read from, for SyncList.
+	token []byte
+}
+
+// EnableAccessCache makes CheckAccess answer from an in-process cache, so
+// repeated checks for the same user and resource don't each list the store.
+// Results are cached for at most ttl. Call SyncAccessCache periodically to
+// pick up changes made by other replicas.
+func (c *Client) EnableAccessCache(ttl time.Duration) {
+	c.accessCache = &accessCache{ttl: ttl, entries: map[accessKey]*accessEntry{}}
+}
+
+// get returns the cached result for key, and the generation to pass to put
+// if there wasn't one.
+func (ac *accessCache) get(key accessKey, now time.Time) (*schema.Lease, bool, uint64) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	entry, ok := ac.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		metrics.AccessCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false, ac.generation
+	}
+	metrics.AccessCacheRequests.WithLabelValues("hit").Inc()
+	return entry.lease, true, ac.generation
+}
+
+func (ac *accessCache) put(key accessKey, lease *schema.Lease, token []byte, generation uint64, now time.Time) {
+	expires := now.Add(ac.ttl)
+	if lease != nil {
+		if leaseExpiry := LeaseExpiry(lease); !leaseExpiry.IsZero() && leaseExpiry.Before(expires) {
+			expires = leaseExpiry
+		}
+	}
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if generation != ac.generation {
+		return
+	}
+	ac.entries[key] = &accessEntry{lease: lease, expires: expires, token: token}
+}
+
+func (ac *accessCache) invalidate(key accessKey, source string) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.generation++
+	if _, ok := ac.entries[key]; ok {
+		delete(ac.entries, key)
+		metrics.AccessCacheInvalidations.WithLabelValues(source).Inc()
+	}
+}
+
+func (ac *accessCache) clear() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.generation++
+	clear(ac.entries)
+}
+
+// invalidateAccess drops any cached access check for the lease's user and
+// resource. It's called after every lease write.
+func (c *Client) invalidateAccess(lease *schema.Lease) {
+	if c.accessCache != nil && lease != nil {
+		c.accessCache.invalidate(accessKey{lease.UserId, lease.ResourceId}, "local")
+	}
+}
+
+// SyncAccessCache checks the change feed for each cached access check, and
+// drops the ones whose leases have changed since they were read. It also
+// forgets entries that have expired. An entry whose feed can't be read is
+// dropped too, and the errors are returned together once every entry has
+// been checked.
+func (c *Client) SyncAccessCache(ctx context.Context) (err error) {
+	if c.accessCache == nil {
+		return nil
+	}
+	ctx, done := observe(ctx, "SyncAccessCache")
+	defer done(&err)
+
+	ac := c.accessCache
+	now := time.Now()
+	tokens := map[accessKey][]byte{}
+	ac.mu.Lock()
+	for key, entry := range ac.entries {
+		if now.Before(entry.expires) {
+			tokens[key] = entry.token
+		} else {
+			delete(ac.entries, key)
+		}
+	}
+	ac.mu.Unlock()
+
+	var errs []error
+	for key, token := range tokens {
+		newToken, changed, err := c.syncAccessEntry(ctx, token)
+		if err != nil {
+			// The entry can't be shown to be current, so it goes, and the
+			// rest still get checked.
+			ac.invalidate(key, "sync")
+			errs = append(errs, err)
+			continue
+		}
+		if changed {
+			ac.invalidate(key, "sync")
+			continue
+		}
+		ac.mu.Lock()
+		if entry, ok := ac.entries[key]; ok {
+			entry.token = newToken
+		}
+		ac.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// syncAccessEntry reports whether anything in the list token came from has
+// changed, and returns the token to sync from next time.
+func (c *Client) syncAccessEntry(ctx context.Context, token []byte) ([]byte, bool, error) {
+	resp, err := c.client.SyncList(ctx, token)
+	if err != nil {
+		return nil, false, err
+	}
+	changed := false
+	for resp.Next() {
+		changed = true
+	}
+	newToken, err := resp.Token()
+	if err != nil {
+		return nil, false, err
+	}
+	return newToken.Data, changed, nil
+}
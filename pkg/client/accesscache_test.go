@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+)
+
+func TestAccessCachePutAfterInvalidate(t *testing.T) {
+	key := accessKey{uuid.New(), uuid.New()}
+	lease := &schema.Lease{Id: uuid.New(), UserId: key.user, ResourceId: key.resource, Approver: uuid.New()}
+	for _, tc := range []struct {
+		name string
+		// write runs between a lookup missing the cache and it putting what
+		// it read.
+		write  func(ac *accessCache)
+		cached bool
+	}{
+		{"no write", func(*accessCache) {}, true},
+		{"write to the same lease", func(ac *accessCache) { ac.invalidate(key, "local") }, false},
+		{"write to another user's lease", func(ac *accessCache) { ac.invalidate(accessKey{uuid.New(), key.resource}, "local") }, false},
+		{"restore", func(ac *accessCache) { ac.clear() }, false},
+	} {
+		ac := &accessCache{ttl: time.Minute, entries: map[accessKey]*accessEntry{}}
+		now := time.Now()
+		if _, ok, generation := ac.get(key, now); ok {
+			t.Fatalf("%s: empty cache hit", tc.name)
+		} else {
+			tc.write(ac)
+			ac.put(key, lease, nil, generation, now)
+		}
+		if _, ok, _ := ac.get(key, now); ok != tc.cached {
+			t.Errorf("%s: cached = %v, want %v", tc.name, ok, tc.cached)
+		}
+	}
+}
+
+func TestCheckAccessInvalidation(t *testing.T) {
+	ctx := context.Background()
+	c, f := newTestClient()
+	c.EnableAccessCache(time.Hour)
+	owner := mustCreateUser(t, c)
+	user := mustCreateUser(t, c)
+	resource := mustCreateResource(t, c, owner.Id)
+
+	lease, err := c.CreateLease(ctx, user.Id, resource.Id, "test", time.Hour, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	if got, err := c.CheckAccess(ctx, user.Id, resource.Id); err != nil || got != nil {
+		t.Fatalf("CheckAccess of a pending lease = %v, %v", got, err)
+	}
+
+	// Writes through this client drop the cached result straight away.
+	if _, err := c.ApproveLease(ctx, lease.Id, owner.Id, "", ""); err != nil {
+		t.Fatalf("ApproveLease: %v", err)
+	}
+	if got, err := c.CheckAccess(ctx, user.Id, resource.Id); err != nil || got == nil || got.Id != lease.Id {
+		t.Fatalf("CheckAccess after approving = %v, %v, want the lease", got, err)
+	}
+
+	// Writes by another replica are only seen once the cache is synced.
+	if err := f.Delete(ctx, lease.KeyPath()); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got, err := c.CheckAccess(ctx, user.Id, resource.Id); err != nil || got == nil {
+		t.Fatalf("CheckAccess before syncing = %v, %v, want the cached lease", got, err)
+	}
+	if err := c.SyncAccessCache(ctx); err != nil {
+		t.Fatalf("SyncAccessCache: %v", err)
+	}
+	if got, err := c.CheckAccess(ctx, user.Id, resource.Id); err != nil || got != nil {
+		t.Fatalf("CheckAccess after syncing = %v, %v, want none", got, err)
+	}
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/notify"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+// DenyLease records approver as having turned the lease down, with an
+// optional comment. Only pending leases can be denied, and if the resource
+// has an owner only the owner can deny them. A denied lease is kept (so the
+// user can see why) until its TTL runs out, but never grants access. Like
+// approving, denying a lease from a template denies its whole bundle.
+func (c *Client) DenyLease(ctx context.Context, leaseID, approver uuid.UUID, comment, ifMatch string) (_ *schema.Lease, err error) {
+	ctx, done := observe(ctx, "DenyLease")
+	defer done(&err)
+	leases, err := c.updateLeases(ctx, leaseID, ifMatch, true, func(lease *schema.Lease, owner uuid.UUID) error {
+		if !LeasePending(lease) {
+			return ErrNotPending
+		}
+		if approver == lease.UserId {
+			return ErrSelfApproval
+		}
+		if err := checkApprover(owner, approver); err != nil {
+			return err
+		}
+		lease.DeniedBy = approver
+		lease.DecisionComment = comment
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, lease := range leases {
+		c.emit(ctx, notify.LeaseDenied, lease)
+	}
+	return leases[0], nil
+}
+
+// GetPendingApprovals returns the unexpired leases waiting for ownerID to
+// approve or deny them, i.e. pending leases for the resources ownerID owns.
+func (c *Client) GetPendingApprovals(ctx context.Context, ownerID uuid.UUID) (_ []*schema.Lease, err error) {
+	ctx, done := observe(ctx, "GetPendingApprovals")
+	defer done(&err)
+	resp, err := c.client.BeginList(ctx, "/approver-"+stately.ToKeyID(ownerID[:])+"/pending")
+	if err != nil {
+		return nil, err
+	}
+	var keyPaths []string
+	for resp.Next() {
+		if pending, ok := resp.Value().(*schema.PendingApproval); ok {
+			keyPaths = append(keyPaths, "/lease-"+stately.ToKeyID(pending.LeaseId[:]))
+		}
+	}
+	if _, err = resp.Token(); err != nil {
+		return nil, err
+	}
+
+	// The index is kept in step with the leases, but check them anyway in
+	// case a lease's TTL ran out first.
+	now := time.Now()
+	var leases []*schema.Lease
+	for start := 0; start < len(keyPaths); start += 50 {
+		items, err := c.client.GetBatch(ctx, keyPaths[start:min(start+50, len(keyPaths))]...)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if lease, ok := item.(*schema.Lease); ok && LeasePending(lease) {
+				if expiry := LeaseExpiry(lease); expiry.IsZero() || now.Before(expiry) {
+					leases = append(leases, lease)
+				}
+			}
+		}
+	}
+	return leases, nil
+}
+
+// resourceOwner returns the owner of a resource, or uuid.Nil if it doesn't
+// have one (or doesn't exist).
+func resourceOwner(txn stately.Transaction, resourceID uuid.UUID) (uuid.UUID, error) {
+	item, err := txn.Get("/res-" + stately.ToKeyID(resourceID[:]))
+	if err != nil || item == nil {
+		return uuid.Nil, err
+	}
+	return item.(*schema.Resource).OwnerId, nil
+}
+
+// checkApprover returns ErrNotApprover unless approver may approve leases
+// for a resource with the given owner.
+func checkApprover(owner, approver uuid.UUID) error {
+	if owner != uuid.Nil && approver != owner {
+		return ErrNotApprover
+	}
+	return nil
+}
+
+func pendingApprovalKeyPath(owner, leaseID uuid.UUID) string {
+	return "/approver-" + stately.ToKeyID(owner[:]) + "/pending-" + stately.ToKeyID(leaseID[:])
+}
+
+// syncApprovalIndex makes the owner's approval inbox match the lease: listed
+// while it's pending, and not otherwise. Call it in the transaction that
+// writes the lease, after the lease has been put. Re-putting the entry also
+// restarts its TTL along with the lease's.
+func syncApprovalIndex(txn stately.Transaction, lease *schema.Lease, owner uuid.UUID) error {
+	if owner == uuid.Nil {
+		return nil
+	}
+	if !LeasePending(lease) {
+		return txn.Delete(pendingApprovalKeyPath(owner, lease.Id))
+	}
+	_, err := txn.Put(&schema.PendingApproval{
+		OwnerId:         owner,
+		LeaseId:         lease.Id,
+		UserId:          lease.UserId,
+		ResourceId:      lease.ResourceId,
+		DurationSeconds: lease.DurationSeconds,
+	})
+	return err
+}
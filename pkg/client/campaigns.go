@@ -0,0 +1,452 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/notify"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+// The statuses a lease goes through in a campaign. It starts out pending,
+// and is either confirmed by the owner, revoked when the campaign closes, or
+// gone if the lease expired or was revoked some other way first.
+const (
+	CampaignPending   = "pending"
+	CampaignConfirmed = "confirmed"
+	CampaignRevoked   = "revoked"
+	CampaignGone      = "gone"
+)
+
+// DefaultCampaignMinDuration is the shortest lease a campaign covers if
+// StartCampaign isn't given one.
+const DefaultCampaignMinDuration = 7 * 24 * time.Hour
+
+// CampaignReminderInterval is how often owners are reminded about leases they
+// haven't confirmed while a campaign is open.
+const CampaignReminderInterval = 24 * time.Hour
+
+var (
+	ErrCampaignNotFound     = errors.New("campaign not found")
+	ErrCampaignItemNotFound = errors.New("lease isn't part of this campaign")
+	ErrInvalidCampaign      = errors.New("a campaign needs a name and a close time in the future")
+	// ErrCampaignClosed is returned when confirming a lease after the
+	// campaign's close time.
+	ErrCampaignClosed = errors.New("campaign is closed")
+	ErrAlreadyDecided = errors.New("lease has already been decided in this campaign")
+)
+
+// CampaignProgress is a campaign and how many of its leases are in each
+// status.
+type CampaignProgress struct {
+	Campaign  *schema.Campaign `json:"campaign"`
+	Total     int              `json:"total"`
+	Pending   int              `json:"pending"`
+	Confirmed int              `json:"confirmed"`
+	Revoked   int              `json:"revoked"`
+	Gone      int              `json:"gone"`
+}
+
+// StartCampaign opens a recertification campaign covering every active lease
+// that lasts at least minDuration (DefaultCampaignMinDuration if it's zero)
+// or has no duration at all, and lists each one for its resource's owner to
+// confirm before closesAt. The items are written after the campaign, in
+// batches, so if that fails partway the campaign only covers the leases
+// written so far.
+func (c *Client) StartCampaign(ctx context.Context, name string, minDuration time.Duration, closesAt time.Time) (_ *schema.Campaign, err error) {
+	ctx, done := observe(ctx, "StartCampaign")
+	defer done(&err)
+	now := time.Now()
+	if name == "" || !closesAt.After(now) {
+		return nil, ErrInvalidCampaign
+	}
+	if minDuration <= 0 {
+		minDuration = DefaultCampaignMinDuration
+	}
+	leases, err := c.ListLeases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := c.ListResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	owners := map[uuid.UUID]uuid.UUID{}
+	for _, resource := range resources {
+		owners[resource.Id] = resource.OwnerId
+	}
+
+	campaign, err := c.client.Put(ctx, &schema.Campaign{
+		Name:               name,
+		MinDurationSeconds: minDuration,
+		ClosesAt:           closesAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	created := campaign.(*schema.Campaign)
+
+	var items []stately.Item
+	for _, lease := range leases {
+		if !LeaseActive(lease, now) || (lease.DurationSeconds != 0 && lease.DurationSeconds < minDuration) {
+			continue
+		}
+		items = append(items, &schema.CampaignItem{
+			CampaignId: created.Id,
+			LeaseId:    lease.Id,
+			UserId:     lease.UserId,
+			ResourceId: lease.ResourceId,
+			OwnerId:    owners[lease.ResourceId],
+			Status:     CampaignPending,
+		})
+	}
+	for start := 0; start < len(items); start += 50 {
+		if _, err := c.client.PutBatch(ctx, items[start:min(start+50, len(items))]...); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// ListCampaigns returns every campaign, open or closed. There are few enough
+// that this scans them.
+func (c *Client) ListCampaigns(ctx context.Context) (_ []*schema.Campaign, err error) {
+	ctx, done := observe(ctx, "ListCampaigns")
+	defer done(&err)
+	var campaigns []*schema.Campaign
+	err = c.scan(ctx, "Campaign", func(item stately.Item) {
+		if campaign, ok := item.(*schema.Campaign); ok {
+			campaigns = append(campaigns, campaign)
+		}
+	})
+	return campaigns, err
+}
+
+// GetCampaign returns a campaign along with its progress.
+func (c *Client) GetCampaign(ctx context.Context, campaignID uuid.UUID) (_ *CampaignProgress, err error) {
+	ctx, done := observe(ctx, "GetCampaign")
+	defer done(&err)
+	item, err := c.client.Get(ctx, campaignKeyPath(campaignID))
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrCampaignNotFound
+	}
+	items, err := c.listCampaignItems(ctx, campaignKeyPath(campaignID)+"/item")
+	if err != nil {
+		return nil, err
+	}
+	progress := &CampaignProgress{Campaign: item.(*schema.Campaign), Total: len(items)}
+	for _, item := range items {
+		switch item.Status {
+		case CampaignPending:
+			progress.Pending++
+		case CampaignConfirmed:
+			progress.Confirmed++
+		case CampaignRevoked:
+			progress.Revoked++
+		case CampaignGone:
+			progress.Gone++
+		}
+	}
+	return progress, nil
+}
+
+// ListCampaignItems returns the leases in a campaign and where each one is
+// at. If owner is set, it only returns the leases that owner has to confirm.
+func (c *Client) ListCampaignItems(ctx context.Context, campaignID, owner uuid.UUID) (_ []*schema.CampaignItem, err error) {
+	ctx, done := observe(ctx, "ListCampaignItems")
+	defer done(&err)
+	if owner != uuid.Nil {
+		return c.listCampaignItems(ctx, "/owner-"+stately.ToKeyID(owner[:])+"/campaign-"+stately.ToKeyID(campaignID[:]))
+	}
+	return c.listCampaignItems(ctx, campaignKeyPath(campaignID)+"/item")
+}
+
+func (c *Client) listCampaignItems(ctx context.Context, prefix string) ([]*schema.CampaignItem, error) {
+	resp, err := c.client.BeginList(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var items []*schema.CampaignItem
+	for {
+		for resp.Next() {
+			if item, ok := resp.Value().(*schema.CampaignItem); ok {
+				items = append(items, item)
+			}
+		}
+		token, err := resp.Token()
+		if err != nil {
+			return nil, err
+		}
+		if !token.CanContinue {
+			return items, nil
+		}
+		if resp, err = c.client.ContinueList(ctx, token.Data); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ConfirmCampaignItem records that the resource's owner still wants the lease
+// to stand. Only the owner the lease was listed for can confirm it (or anyone
+// but the lease's user if the resource had no owner), and only before the
+// campaign closes.
+func (c *Client) ConfirmCampaignItem(ctx context.Context, campaignID, leaseID, owner uuid.UUID, comment string) (_ *schema.CampaignItem, err error) {
+	ctx, done := observe(ctx, "ConfirmCampaignItem")
+	defer done(&err)
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		item, err := txn.Get(campaignKeyPath(campaignID))
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrCampaignNotFound
+		}
+		campaign := item.(*schema.Campaign)
+		// Reading the campaign makes this conflict with CloseCampaign moving
+		// closes_at up.
+		if !campaign.ClosedAt.IsZero() || !time.Now().Before(campaign.ClosesAt) {
+			return ErrCampaignClosed
+		}
+		if item, err = txn.Get(campaignItemKeyPath(campaignID, leaseID)); err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrCampaignItemNotFound
+		}
+		campaignItem := item.(*schema.CampaignItem)
+		if campaignItem.Status != CampaignPending {
+			return ErrAlreadyDecided
+		}
+		if owner == campaignItem.UserId {
+			return ErrSelfApproval
+		}
+		if err := checkApprover(campaignItem.OwnerId, owner); err != nil {
+			return err
+		}
+		campaignItem.Status = CampaignConfirmed
+		campaignItem.DecidedBy = owner
+		campaignItem.DecidedAt = time.Now()
+		campaignItem.Comment = comment
+		_, err = txn.Put(campaignItem)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results.PutResponse[0].(*schema.CampaignItem), nil
+}
+
+// CloseCampaign ends a campaign now, even if its close time hasn't come yet,
+// and revokes every lease in it that hasn't been confirmed. If revoking fails
+// or stops partway, calling it again picks up where it left off, including
+// leases whose items were marked revoked but weren't revoked yet.
+func (c *Client) CloseCampaign(ctx context.Context, campaignID uuid.UUID) (_ *CampaignProgress, err error) {
+	ctx, done := observe(ctx, "CloseCampaign")
+	defer done(&err)
+	// Stop any more confirmations first, so nothing is confirmed after we've
+	// decided to revoke it.
+	now := time.Now()
+	_, err = c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		item, err := txn.Get(campaignKeyPath(campaignID))
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrCampaignNotFound
+		}
+		campaign := item.(*schema.Campaign)
+		if !campaign.ClosesAt.After(now) {
+			return nil
+		}
+		campaign.ClosesAt = now
+		_, err = txn.Put(campaign)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := c.listCampaignItems(ctx, campaignKeyPath(campaignID)+"/item")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.Status == CampaignRevoked {
+			// An earlier close may have stopped between claiming the item
+			// and revoking its lease, so make sure the lease is gone.
+			if err := c.DeleteLease(ctx, item.LeaseId, ""); err != nil && !errors.Is(err, ErrLeaseNotFound) {
+				return nil, err
+			}
+			continue
+		}
+		if item.Status != CampaignPending {
+			continue
+		}
+		// Claim the item first, so that two replicas closing the campaign
+		// at once don't both revoke it.
+		claimed, err := c.decideCampaignItem(ctx, item, CampaignPending, CampaignRevoked)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			continue
+		}
+		err = c.DeleteLease(ctx, item.LeaseId, "")
+		if errors.Is(err, ErrLeaseNotFound) {
+			_, err = c.decideCampaignItem(ctx, item, CampaignRevoked, CampaignGone)
+		} else if err != nil {
+			// Put it back so the next attempt retries it.
+			if _, undoErr := c.decideCampaignItem(ctx, item, CampaignRevoked, CampaignPending); undoErr != nil {
+				log.Printf("Failed to reset campaign item for lease %s: %v", item.LeaseId, undoErr)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		item, err := txn.Get(campaignKeyPath(campaignID))
+		if err != nil || item == nil {
+			return err
+		}
+		campaign := item.(*schema.Campaign)
+		if !campaign.ClosedAt.IsZero() {
+			return nil
+		}
+		campaign.ClosedAt = time.Now()
+		_, err = txn.Put(campaign)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.GetCampaign(ctx, campaignID)
+}
+
+// decideCampaignItem moves an item from one status to another, and reports
+// whether it did. It doesn't if the item has already moved on.
+func (c *Client) decideCampaignItem(ctx context.Context, item *schema.CampaignItem, from, to string) (bool, error) {
+	moved := false
+	_, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		moved = false
+		current, err := txn.Get(item.KeyPath())
+		if err != nil {
+			return err
+		}
+		campaignItem, ok := current.(*schema.CampaignItem)
+		if !ok || campaignItem.Status != from {
+			return nil
+		}
+		campaignItem.Status = to
+		campaignItem.DecidedBy = uuid.Nil
+		campaignItem.DecidedAt = time.Now()
+		if to == CampaignPending {
+			campaignItem.DecidedAt = time.Time{}
+		}
+		if _, err := txn.Put(campaignItem); err != nil {
+			return err
+		}
+		moved = true
+		return nil
+	})
+	return moved, err
+}
+
+// RunCampaigns closes the open campaigns whose close time has passed, and
+// reminds owners about the leases they still have to confirm in the others,
+// at most once per CampaignReminderInterval. It's meant to be called
+// periodically, and returns the campaigns it closed.
+func (c *Client) RunCampaigns(ctx context.Context, now time.Time) (_ []*CampaignProgress, err error) {
+	ctx, done := observe(ctx, "RunCampaigns")
+	defer done(&err)
+	campaigns, err := c.ListCampaigns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var closed []*CampaignProgress
+	var errs []error
+	for _, campaign := range campaigns {
+		switch {
+		case !campaign.ClosedAt.IsZero():
+			// Nothing left to do.
+		case !now.Before(campaign.ClosesAt):
+			progress, err := c.CloseCampaign(ctx, campaign.Id)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			closed = append(closed, progress)
+		case now.Sub(campaign.RemindedAt) >= CampaignReminderInterval:
+			if err := c.remindCampaign(ctx, campaign, now); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return closed, errors.Join(errs...)
+}
+
+// remindCampaign sends a lease.recertification_due event for every lease in
+// the campaign that hasn't been confirmed. It claims the reminder by bumping
+// reminded_at first, so only one replica sends it.
+func (c *Client) remindCampaign(ctx context.Context, campaign *schema.Campaign, now time.Time) error {
+	claimed := false
+	_, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		claimed = false
+		item, err := txn.Get(campaign.KeyPath())
+		if err != nil || item == nil {
+			return err
+		}
+		current := item.(*schema.Campaign)
+		if !current.RemindedAt.Equal(campaign.RemindedAt) {
+			return nil
+		}
+		current.RemindedAt = now
+		if _, err := txn.Put(current); err != nil {
+			return err
+		}
+		claimed = true
+		return nil
+	})
+	if err != nil || !claimed {
+		return err
+	}
+
+	items, err := c.listCampaignItems(ctx, campaignKeyPath(campaign.Id)+"/item")
+	if err != nil {
+		return err
+	}
+	var keyPaths []string
+	for _, item := range items {
+		if item.Status == CampaignPending {
+			keyPaths = append(keyPaths, "/lease-"+stately.ToKeyID(item.LeaseId[:]))
+		}
+	}
+	for start := 0; start < len(keyPaths); start += 50 {
+		leases, err := c.client.GetBatch(ctx, keyPaths[start:min(start+50, len(keyPaths))]...)
+		if err != nil {
+			return err
+		}
+		for _, item := range leases {
+			if lease, ok := item.(*schema.Lease); ok {
+				c.notify(ctx, notify.Event{Type: notify.LeaseRecertify, Time: now, Lease: lease, ExpiresAt: campaign.ClosesAt, Campaign: campaign})
+			}
+		}
+	}
+	return nil
+}
+
+func campaignKeyPath(campaignID uuid.UUID) string {
+	return "/campaign-" + stately.ToKeyID(campaignID[:])
+}
+
+func campaignItemKeyPath(campaignID, leaseID uuid.UUID) string {
+	return campaignKeyPath(campaignID) + "/item-" + stately.ToKeyID(leaseID[:])
+}
@@ -2,15 +2,37 @@ package client
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
+	"github.com/StatelyCloud/demo-w/pkg/notify"
 	"github.com/StatelyCloud/demo-w/pkg/schema"
 	"github.com/StatelyCloud/go-sdk/stately"
 	"github.com/google/uuid"
 )
 
+var (
+	ErrLeaseNotFound = errors.New("lease not found")
+	ErrSelfApproval  = errors.New("users can't approve their own leases")
+	// ErrPreconditionFailed is returned when an update's ifMatch isn't the
+	// lease's current ETag, i.e. someone else has changed it in the meantime.
+	ErrPreconditionFailed = errors.New("lease has been modified since it was read")
+	ErrNotApprover        = errors.New("only the resource's owner can approve or deny its leases")
+	ErrNotPending         = errors.New("lease isn't waiting for approval")
+)
+
 type Client struct {
-	client stately.Client
+	client   stately.Client
+	notifier notify.Notifier
+	limits   Limits
+	// accessCache is nil unless EnableAccessCache has been called.
+	accessCache *accessCache
 }
 
 func NewClient(ctx context.Context, storeID uint64) (*Client, error) {
@@ -22,49 +44,377 @@ func NewClient(ctx context.Context, storeID uint64) (*Client, error) {
 		return nil, err
 	}
 	return &Client{
-		statelyClient,
+		client: tracedClient{statelyClient},
 	}, nil
 }
 
-func (c *Client) CreateUser(ctx context.Context, displayName, email string) (*schema.User, error) {
-	item, err := c.client.Put(ctx, &schema.User{
-		DisplayName: displayName,
-		Email:       email,
+// SetNotifier sets where lease lifecycle events (requested, approved, extended
+// and revoked) are sent. Notifiers should hand events off quickly (e.g. with
+// notify.Async), since they're called inline with the lease operation.
+func (c *Client) SetNotifier(n notify.Notifier) {
+	c.notifier = n
+}
+
+func (c *Client) emit(ctx context.Context, eventType notify.EventType, lease *schema.Lease) {
+	c.notify(ctx, notify.Event{Type: eventType, Time: time.Now(), Lease: lease, ExpiresAt: LeaseExpiry(lease)})
+}
+
+func (c *Client) notify(ctx context.Context, event notify.Event) {
+	if c.notifier == nil {
+		return
+	}
+	if err := c.notifier.Notify(ctx, event); err != nil {
+		log.Printf("Failed to send %s for lease %s: %v", event.Type, event.Lease.Id, err)
+	}
+}
+
+// CreateUser creates a user, failing with ErrEmailTaken if another user
+// already has the email or ErrInvalidEmail if it's malformed.
+func (c *Client) CreateUser(ctx context.Context, displayName, email string) (_ *schema.User, err error) {
+	ctx, done := observe(ctx, "CreateUser")
+	defer done(&err)
+	email = NormalizeEmail(email)
+	if !emailRegex.MatchString(email) {
+		return nil, ErrInvalidEmail
+	}
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		if err := checkEmailFree(txn, email, uuid.Nil); err != nil {
+			return err
+		}
+		_, err := txn.Put(&schema.User{
+			DisplayName: displayName,
+			Email:       email,
+		})
+		return err
 	})
 	if err != nil {
 		return nil, err
 	}
-	return item.(*schema.User), nil
+	return results.PutResponse[0].(*schema.User), nil
 }
 
-func (c *Client) CreateResource(ctx context.Context, name string) (*schema.Resource, error) {
-	item, err := c.client.Put(ctx, &schema.Resource{
-		Name: name,
+// CreateResource creates a resource and claims its name, failing with
+// ErrResourceNameTaken if another resource has it. If owner isn't uuid.Nil,
+// only the owner can approve leases for it.
+func (c *Client) CreateResource(ctx context.Context, name string, owner uuid.UUID) (_ *schema.Resource, err error) {
+	ctx, done := observe(ctx, "CreateResource")
+	defer done(&err)
+	name = strings.TrimSpace(name)
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		claim, err := txn.Get(resourceNameKeyPath(name))
+		if err != nil {
+			return err
+		}
+		if claim != nil {
+			return ErrResourceNameTaken
+		}
+		id, err := txn.Put(&schema.Resource{
+			Name:    name,
+			OwnerId: owner,
+		})
+		if err != nil {
+			return err
+		}
+		resourceID, err := uuid.FromBytes(id.Bytes)
+		if err != nil {
+			return err
+		}
+		_, err = txn.Put(&schema.ResourceName{Name: name, ResourceId: resourceID})
+		return err
 	})
 	if err != nil {
 		return nil, err
 	}
-	return item.(*schema.Resource), nil
+	// The resource is always the first item put.
+	return results.PutResponse[0].(*schema.Resource), nil
 }
 
-func (c *Client) CreateLease(ctx context.Context, userID, resourceID uuid.UUID, duration time.Duration, approver uuid.UUID) (*schema.Lease, error) {
-	item, err := c.client.Put(ctx, &schema.Lease{
-		UserId:          userID,
-		ResourceId:      resourceID,
-		DurationSeconds: duration,
-		Approver:        approver,
+func (c *Client) CreateLease(ctx context.Context, userID, resourceID uuid.UUID, reason string, duration time.Duration, approver uuid.UUID) (_ *schema.Lease, err error) {
+	ctx, done := observe(ctx, "CreateLease")
+	defer done(&err)
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		return c.putNewLease(txn, &schema.Lease{
+			UserId:          userID,
+			ResourceId:      resourceID,
+			Reason:          reason,
+			DurationSeconds: duration,
+			Approver:        approver,
+		}, 0)
 	})
 	if err != nil {
 		return nil, err
 	}
+	// The lease is always the first item put.
+	lease := results.PutResponse[0].(*schema.Lease)
+	c.invalidateAccess(lease)
+	c.emit(ctx, notify.LeaseRequested, lease)
+	if approver != uuid.Nil {
+		c.emit(ctx, notify.LeaseApproved, lease)
+	}
+	return lease, nil
+}
+
+// putNewLease checks quotas and the approver (if any) for a new lease, then
+// puts it along with its search index entries, report grant and approval
+// inbox entry. It sets the lease's ID. earlier is how many leases the user
+// has already been given in txn, for the quota.
+func (c *Client) putNewLease(txn stately.Transaction, lease *schema.Lease, earlier int) error {
+	if err := c.checkLimits(txn, lease.UserId, lease.ResourceId, earlier); err != nil {
+		return err
+	}
+	owner, err := resourceOwner(txn, lease.ResourceId)
+	if err != nil {
+		return err
+	}
+	if lease.Approver != uuid.Nil && lease.Approver != lease.UserId {
+		if err := checkApprover(owner, lease.Approver); err != nil {
+			return err
+		}
+	}
+	id, err := txn.Put(lease)
+	if err != nil {
+		return err
+	}
+	if lease.Id, err = uuid.FromBytes(id.Bytes); err != nil {
+		return err
+	}
+	if err := syncLeaseIndex(txn, nil, lease); err != nil {
+		return err
+	}
+	if err := syncLeaseGrant(txn, lease, time.Now(), grantEnd(lease)); err != nil {
+		return err
+	}
+	return syncApprovalIndex(txn, lease, owner)
+}
+
+// Ping checks that the store is reachable, with a Get of a key that never
+// exists.
+func (c *Client) Ping(ctx context.Context) (err error) {
+	ctx, done := observe(ctx, "Ping")
+	defer done(&err)
+	_, err = c.client.Get(ctx, "/user-"+stately.ToKeyID(uuid.Nil[:]))
+	return err
+}
+
+func (c *Client) GetUser(ctx context.Context, userID uuid.UUID) (_ *schema.User, err error) {
+	ctx, done := observe(ctx, "GetUser")
+	defer done(&err)
+	item, err := c.client.Get(ctx, "/user-"+stately.ToKeyID(userID[:]))
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return item.(*schema.User), nil
+}
+
+func (c *Client) GetResource(ctx context.Context, resourceID uuid.UUID) (_ *schema.Resource, err error) {
+	ctx, done := observe(ctx, "GetResource")
+	defer done(&err)
+	item, err := c.client.Get(ctx, "/res-"+stately.ToKeyID(resourceID[:]))
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return item.(*schema.Resource), nil
+}
+
+func (c *Client) GetLease(ctx context.Context, leaseID uuid.UUID) (_ *schema.Lease, err error) {
+	ctx, done := observe(ctx, "GetLease")
+	defer done(&err)
+	item, err := c.client.Get(ctx, "/lease-"+stately.ToKeyID(leaseID[:]))
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrLeaseNotFound
+	}
 	return item.(*schema.Lease), nil
 }
 
-func (c *Client) DeleteLease(ctx context.Context, leaseID uuid.UUID) error {
-	return c.client.Delete(ctx, "/lease-"+stately.ToKeyID(leaseID[:]))
+// ApproveLease records approver as having approved the lease, with an
+// optional comment. If the resource has an owner, only the owner can approve.
+// Approving resets the lease's TTL, so the full duration starts from the
+// approval. If ifMatch isn't empty, the lease is only approved if that's
+// still its ETag. A lease requested from a template shares its approval with
+// the rest of its bundle, so they're all approved together, or not at all.
+func (c *Client) ApproveLease(ctx context.Context, leaseID, approver uuid.UUID, comment, ifMatch string) (_ *schema.Lease, err error) {
+	ctx, done := observe(ctx, "ApproveLease")
+	defer done(&err)
+	leases, err := c.updateLeases(ctx, leaseID, ifMatch, true, func(lease *schema.Lease, owner uuid.UUID) error {
+		// Break-glass leases don't need approving, and re-putting one would
+		// restart its TTL past the emergency cap.
+		if LeaseDenied(lease) || lease.Emergency {
+			return ErrNotPending
+		}
+		if approver == lease.UserId {
+			return ErrSelfApproval
+		}
+		if err := checkApprover(owner, approver); err != nil {
+			return err
+		}
+		lease.Approver = approver
+		lease.DecisionComment = comment
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, lease := range leases {
+		c.emit(ctx, notify.LeaseApproved, lease)
+	}
+	return leases[0], nil
+}
+
+// TouchLease extends a lease by its full duration from now. Re-writing the
+// lease bumps its last modified time, which is what the TTL counts from. If
+// ifMatch isn't empty, the lease is only extended if that's still its ETag.
+func (c *Client) TouchLease(ctx context.Context, leaseID uuid.UUID, ifMatch string) (_ *schema.Lease, err error) {
+	ctx, done := observe(ctx, "TouchLease")
+	defer done(&err)
+	lease, err := c.updateLease(ctx, leaseID, ifMatch, func(lease *schema.Lease, _ uuid.UUID) error {
+		if lease.Emergency {
+			return ErrEmergencyExtension
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.emit(ctx, notify.LeaseExtended, lease)
+	return lease, nil
 }
 
-func (c *Client) GetLeasesForUser(ctx context.Context, userID uuid.UUID) ([]*schema.Lease, error) {
+// updateLease reads the lease, applies update to it and writes it back, all in
+// one transaction so concurrent updates aren't lost. update is also given the
+// owner of the lease's resource, if it has one. If ifMatch isn't empty and
+// isn't the lease's ETag, it fails with ErrPreconditionFailed.
+func (c *Client) updateLease(ctx context.Context, leaseID uuid.UUID, ifMatch string, update func(lease *schema.Lease, owner uuid.UUID) error) (*schema.Lease, error) {
+	leases, err := c.updateLeases(ctx, leaseID, ifMatch, false, update)
+	if err != nil {
+		return nil, err
+	}
+	return leases[0], nil
+}
+
+// updateLeases is updateLease, except that if wholeBundle is set and the
+// lease was requested in a bundle, every unexpired lease in the bundle is
+// updated in the same transaction. ifMatch only applies to the lease that was
+// asked for, which is always first in the result.
+func (c *Client) updateLeases(ctx context.Context, leaseID uuid.UUID, ifMatch string, wholeBundle bool, update func(lease *schema.Lease, owner uuid.UUID) error) ([]*schema.Lease, error) {
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		item, err := txn.Get("/lease-" + stately.ToKeyID(leaseID[:]))
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrLeaseNotFound
+		}
+		lease := item.(*schema.Lease)
+		if ifMatch != "" && LeaseETag(lease) != ifMatch {
+			return ErrPreconditionFailed
+		}
+		leases := []*schema.Lease{lease}
+		if wholeBundle && lease.BundleId != uuid.Nil {
+			others, err := bundleLeases(txn, lease.BundleId)
+			if err != nil {
+				return err
+			}
+			for _, other := range others {
+				if other.Id != lease.Id {
+					leases = append(leases, other)
+				}
+			}
+		}
+		for _, lease := range leases {
+			owner, err := resourceOwner(txn, lease.ResourceId)
+			if err != nil {
+				return err
+			}
+			old := *lease
+			if err := update(lease, owner); err != nil {
+				return err
+			}
+			if _, err = txn.Put(lease); err != nil {
+				return err
+			}
+			if err := syncLeaseIndex(txn, &old, lease); err != nil {
+				return err
+			}
+			if err := syncLeaseGrant(txn, lease, time.Now(), grantEnd(lease)); err != nil {
+				return err
+			}
+			if err := syncBundleMember(txn, lease); err != nil {
+				return err
+			}
+			if err := syncApprovalIndex(txn, lease, owner); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The leases are put in order, with the one asked for first.
+	var leases []*schema.Lease
+	for _, item := range results.PutResponse {
+		if lease, ok := item.(*schema.Lease); ok {
+			c.invalidateAccess(lease)
+			leases = append(leases, lease)
+		}
+	}
+	return leases, nil
+}
+
+// DeleteLease revokes a lease. If ifMatch isn't empty, the lease is only
+// deleted if that's still its ETag.
+func (c *Client) DeleteLease(ctx context.Context, leaseID uuid.UUID, ifMatch string) (err error) {
+	ctx, done := observe(ctx, "DeleteLease")
+	defer done(&err)
+	var lease *schema.Lease
+	_, err = c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		item, err := txn.Get("/lease-" + stately.ToKeyID(leaseID[:]))
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrLeaseNotFound
+		}
+		lease = item.(*schema.Lease)
+		if ifMatch != "" && LeaseETag(lease) != ifMatch {
+			return ErrPreconditionFailed
+		}
+		owner, err := resourceOwner(txn, lease.ResourceId)
+		if err != nil {
+			return err
+		}
+		if owner != uuid.Nil {
+			if err := txn.Delete(pendingApprovalKeyPath(owner, lease.Id)); err != nil {
+				return err
+			}
+		}
+		if err := syncLeaseIndex(txn, lease, nil); err != nil {
+			return err
+		}
+		if err := syncLeaseGrant(txn, lease, lease.CreatedAt, time.Now()); err != nil {
+			return err
+		}
+		if lease.BundleId != uuid.Nil {
+			if err := txn.Delete(bundleMemberKeyPath(lease.BundleId, lease.Id)); err != nil {
+				return err
+			}
+		}
+		return txn.Delete(lease.KeyPath())
+	})
+	if err != nil {
+		return err
+	}
+	c.invalidateAccess(lease)
+	c.emit(ctx, notify.LeaseRevoked, lease)
+	return nil
+}
+
+func (c *Client) GetLeasesForUser(ctx context.Context, userID uuid.UUID) (_ []*schema.Lease, err error) {
+	ctx, done := observe(ctx, "GetLeasesForUser")
+	defer done(&err)
 	resp, err := c.client.BeginList(ctx, "/user-"+stately.ToKeyID(userID[:])+"/res")
 	if err != nil {
 		return nil, err
@@ -82,7 +432,9 @@ func (c *Client) GetLeasesForUser(ctx context.Context, userID uuid.UUID) ([]*sch
 	return leases, nil
 }
 
-func (c *Client) GetLeasesForResource(ctx context.Context, resourceID uuid.UUID) ([]*schema.Lease, error) {
+func (c *Client) GetLeasesForResource(ctx context.Context, resourceID uuid.UUID) (_ []*schema.Lease, err error) {
+	ctx, done := observe(ctx, "GetLeasesForResource")
+	defer done(&err)
 	resp, err := c.client.BeginList(ctx, "/res-"+stately.ToKeyID(resourceID[:])+"/lease")
 	if err != nil {
 		return nil, err
@@ -100,13 +452,379 @@ func (c *Client) GetLeasesForResource(ctx context.Context, resourceID uuid.UUID)
 	return leases, nil
 }
 
-func (c *Client) GetUserByEmail(ctx context.Context, email string) (*schema.User, error) {
-	user, err := c.client.Get(ctx, "/user_email-"+stately.ToKeyID(email))
+// GetUserByEmail looks the user up by their normalized email, falling back to
+// the email exactly as given for users created before emails were normalized.
+func (c *Client) GetUserByEmail(ctx context.Context, email string) (_ *schema.User, err error) {
+	ctx, done := observe(ctx, "GetUserByEmail")
+	defer done(&err)
+	for _, e := range []string{NormalizeEmail(email), email} {
+		item, err := c.client.Get(ctx, "/user_email-"+stately.ToKeyID(e))
+		if err != nil {
+			return nil, err
+		}
+		if user, ok := item.(*schema.User); ok && user.Email == e {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+// ScheduleLease stores a lease that only becomes active at startAt. Until then
+// it doesn't grant any access, and its TTL doesn't start until it's activated
+// by ActivateScheduledLeases. As with CreateLease, an approver has to be
+// allowed to approve leases for the resource.
+func (c *Client) ScheduleLease(ctx context.Context, userID, resourceID uuid.UUID, reason string, duration time.Duration, approver uuid.UUID, startAt time.Time) (_ *schema.ScheduledLease, err error) {
+	ctx, done := observe(ctx, "ScheduleLease")
+	defer done(&err)
+	// Scheduled leases count against the limits from when they're accepted,
+	// so activation doesn't need to check again and an accepted lease always
+	// starts.
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		if err := c.checkLimits(txn, userID, resourceID, 0); err != nil {
+			return err
+		}
+		if approver != uuid.Nil && approver != userID {
+			owner, err := resourceOwner(txn, resourceID)
+			if err != nil {
+				return err
+			}
+			if err := checkApprover(owner, approver); err != nil {
+				return err
+			}
+		}
+		_, err := txn.Put(&schema.ScheduledLease{
+			UserId:          userID,
+			ResourceId:      resourceID,
+			Reason:          reason,
+			DurationSeconds: duration,
+			Approver:        approver,
+			StartAt:         startAt,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results.PutResponse[0].(*schema.ScheduledLease), nil
+}
+
+// ActivateScheduledLeases turns every scheduled lease whose start time is at or
+// before now into a real Lease, and returns the leases it activated. A lease
+// that fails to activate doesn't stop the others; the errors are returned
+// together.
+func (c *Client) ActivateScheduledLeases(ctx context.Context, now time.Time) (_ []*schema.Lease, err error) {
+	ctx, done := observe(ctx, "ActivateScheduledLeases")
+	defer done(&err)
+	var due []*schema.ScheduledLease
+	err = c.scan(ctx, "ScheduledLease", func(item stately.Item) {
+		if sched, ok := item.(*schema.ScheduledLease); ok && !sched.StartAt.After(now) {
+			due = append(due, sched)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var leases []*schema.Lease
+	var errs []error
+	for _, sched := range due {
+		lease, err := c.activateScheduledLease(ctx, sched)
+		if err != nil {
+			// One that can't be activated mustn't hold up the rest.
+			errs = append(errs, fmt.Errorf("scheduled lease %s: %w", sched.Id, err))
+			continue
+		}
+		if lease != nil {
+			leases = append(leases, lease)
+		}
+	}
+	return leases, errors.Join(errs...)
+}
+
+func (c *Client) activateScheduledLease(ctx context.Context, sched *schema.ScheduledLease) (*schema.Lease, error) {
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		// Another replica may have already activated (or someone cancelled)
+		// this lease since we scanned.
+		item, err := txn.Get(sched.KeyPath())
+		if err != nil || item == nil {
+			return err
+		}
+		owner, err := resourceOwner(txn, sched.ResourceId)
+		if err != nil {
+			return err
+		}
+		lease := &schema.Lease{
+			Id:              sched.Id,
+			UserId:          sched.UserId,
+			ResourceId:      sched.ResourceId,
+			Reason:          sched.Reason,
+			DurationSeconds: sched.DurationSeconds,
+			Approver:        sched.Approver,
+		}
+		// The resource may have changed hands since the lease was
+		// scheduled. If the approver can't approve for it any more, the
+		// lease starts out pending and goes to the new owner's inbox.
+		if lease.Approver != uuid.Nil && checkApprover(owner, lease.Approver) != nil {
+			lease.Approver = uuid.Nil
+		}
+		if _, err := txn.Put(lease); err != nil {
+			return err
+		}
+		if err := syncLeaseIndex(txn, nil, lease); err != nil {
+			return err
+		}
+		if err := syncLeaseGrant(txn, lease, time.Now(), grantEnd(lease)); err != nil {
+			return err
+		}
+		if err := syncApprovalIndex(txn, lease, owner); err != nil {
+			return err
+		}
+		return txn.Delete(sched.KeyPath())
+	})
 	if err != nil {
 		return nil, err
 	}
-	if user != nil {
-		return user.(*schema.User), nil
+	for _, item := range results.PutResponse {
+		if lease, ok := item.(*schema.Lease); ok {
+			c.invalidateAccess(lease)
+			return lease, nil
+		}
 	}
 	return nil, nil
 }
+
+// CheckAccess returns the lease that currently grants userID access to
+// resourceID, or nil if there isn't one. Scheduled leases never grant access
+// before their window opens.
+func (c *Client) CheckAccess(ctx context.Context, userID, resourceID uuid.UUID) (_ *schema.Lease, err error) {
+	ctx, done := observe(ctx, "CheckAccess")
+	defer done(&err)
+	now := time.Now()
+	key := accessKey{userID, resourceID}
+	var generation uint64
+	if c.accessCache != nil {
+		var cached *schema.Lease
+		var ok bool
+		if cached, ok, generation = c.accessCache.get(key, now); ok {
+			return cached, nil
+		}
+	}
+
+	resp, err := c.client.BeginList(ctx, "/user-"+stately.ToKeyID(userID[:])+"/res-"+stately.ToKeyID(resourceID[:])+"/lease")
+	if err != nil {
+		return nil, err
+	}
+	var active *schema.Lease
+	for resp.Next() {
+		if lease, ok := resp.Value().(*schema.Lease); ok && active == nil && LeaseActive(lease, now) {
+			active = lease
+		}
+	}
+	token, err := resp.Token()
+	if err != nil {
+		return nil, err
+	}
+	if c.accessCache != nil {
+		c.accessCache.put(key, active, token.Data, generation, now)
+	}
+	return active, nil
+}
+
+// LeaseActive reports whether the lease grants access at the given time. A
+// lease is not valid until it has been approved by someone other than the
+// user it was granted to, and stops being valid once its duration has passed
+// even if the TTL hasn't removed it yet.
+func LeaseActive(lease *schema.Lease, now time.Time) bool {
+	if LeaseDenied(lease) || LeasePending(lease) {
+		return false
+	}
+	expiresAt := LeaseExpiry(lease)
+	return expiresAt.IsZero() || now.Before(expiresAt)
+}
+
+// LeasePending reports whether the lease is still waiting for someone other
+// than its user to approve (or deny) it. Break-glass leases never wait.
+func LeasePending(lease *schema.Lease) bool {
+	return !LeaseDenied(lease) && !lease.Emergency && (lease.Approver == uuid.Nil || lease.Approver == lease.UserId)
+}
+
+// LeaseDenied reports whether the lease has been denied. Denied leases never
+// grant access.
+func LeaseDenied(lease *schema.Lease) bool {
+	return lease.DeniedBy != uuid.Nil
+}
+
+// LeaseExpiry returns when the lease's TTL runs out, or the zero time if the
+// lease has no duration and never expires.
+func LeaseExpiry(lease *schema.Lease) time.Time {
+	if lease.DurationSeconds == 0 {
+		return time.Time{}
+	}
+	return lease.LastTouched.Add(lease.DurationSeconds)
+}
+
+// LeaseETag identifies the current version of a lease, for If-Match. It's a
+// hash of the whole lease rather than just its LastTouched, which only has
+// millisecond precision, so two writes in the same millisecond still give
+// different ETags unless they leave the lease exactly the same.
+func LeaseETag(lease *schema.Lease) string {
+	// A Lease always encodes.
+	body, _ := json.Marshal(lease)
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// ListLeases returns every lease in the store.
+func (c *Client) ListLeases(ctx context.Context) (_ []*schema.Lease, err error) {
+	ctx, done := observe(ctx, "ListLeases")
+	defer done(&err)
+	var leases []*schema.Lease
+	err = c.scan(ctx, "Lease", func(item stately.Item) {
+		if lease, ok := item.(*schema.Lease); ok {
+			leases = append(leases, lease)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return leases, nil
+}
+
+// ListUsers returns every user in the store.
+func (c *Client) ListUsers(ctx context.Context) (_ []*schema.User, err error) {
+	ctx, done := observe(ctx, "ListUsers")
+	defer done(&err)
+	var users []*schema.User
+	err = c.scan(ctx, "User", func(item stately.Item) {
+		if user, ok := item.(*schema.User); ok {
+			users = append(users, user)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ListResources returns every resource in the store.
+func (c *Client) ListResources(ctx context.Context) (_ []*schema.Resource, err error) {
+	ctx, done := observe(ctx, "ListResources")
+	defer done(&err)
+	var resources []*schema.Resource
+	err = c.scan(ctx, "Resource", func(item stately.Item) {
+		if resource, ok := item.(*schema.Resource); ok {
+			resources = append(resources, resource)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// RestoreBatch atomically writes up to 50 items exactly as given. Unlike the
+// Create methods it keeps the items' IDs and their createdAt/lastTouched
+// timestamps, so a restored lease keeps whatever was left of its TTL.
+func (c *Client) RestoreBatch(ctx context.Context, items ...stately.Item) (err error) {
+	ctx, done := observe(ctx, "RestoreBatch")
+	defer done(&err)
+	puts := make([]stately.Item, len(items))
+	for i, item := range items {
+		puts[i] = stately.WithPutOptions{Item: item, OverwriteMetadataTimestamps: true}
+	}
+	_, err = c.client.PutBatch(ctx, puts...)
+	if c.accessCache != nil {
+		c.accessCache.clear()
+	}
+	return err
+}
+
+// scan calls fn for every item of the given type in the store. This reads the
+// whole store, so it's only meant for background jobs.
+func (c *Client) scan(ctx context.Context, itemType string, fn func(stately.Item)) error {
+	resp, err := c.client.BeginScan(ctx, stately.ScanOptions{ItemTypes: []string{itemType}})
+	if err != nil {
+		return err
+	}
+	for {
+		for resp.Next() {
+			fn(resp.Value())
+		}
+		token, err := resp.Token()
+		if err != nil {
+			return err
+		}
+		if !token.CanContinue {
+			return nil
+		}
+		resp, err = c.client.ContinueScan(ctx, token.Data)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) CreateWebhookSubscription(ctx context.Context, url, secret string, events []string, description string) (_ *schema.WebhookSubscription, err error) {
+	ctx, done := observe(ctx, "CreateWebhookSubscription")
+	defer done(&err)
+	item, err := c.client.Put(ctx, &schema.WebhookSubscription{
+		Url:         url,
+		Secret:      secret,
+		Events:      events,
+		Description: description,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item.(*schema.WebhookSubscription), nil
+}
+
+// ListWebhookSubscriptions returns every webhook subscription. Subscriptions
+// don't share a group key, so this is a scan - callers should cache the result.
+func (c *Client) ListWebhookSubscriptions(ctx context.Context) (_ []*schema.WebhookSubscription, err error) {
+	ctx, done := observe(ctx, "ListWebhookSubscriptions")
+	defer done(&err)
+	var subs []*schema.WebhookSubscription
+	err = c.scan(ctx, "WebhookSubscription", func(item stately.Item) {
+		if sub, ok := item.(*schema.WebhookSubscription); ok {
+			subs = append(subs, sub)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (c *Client) DeleteWebhookSubscription(ctx context.Context, subscriptionID uuid.UUID) (err error) {
+	ctx, done := observe(ctx, "DeleteWebhookSubscription")
+	defer done(&err)
+	return c.client.Delete(ctx, "/webhook-"+stately.ToKeyID(subscriptionID[:]))
+}
+
+func (c *Client) PutWebhookDeadLetter(ctx context.Context, deadLetter *schema.WebhookDeadLetter) (err error) {
+	ctx, done := observe(ctx, "PutWebhookDeadLetter")
+	defer done(&err)
+	_, err = c.client.Put(ctx, deadLetter)
+	return err
+}
+
+func (c *Client) GetWebhookDeadLetters(ctx context.Context, subscriptionID uuid.UUID) (_ []*schema.WebhookDeadLetter, err error) {
+	ctx, done := observe(ctx, "GetWebhookDeadLetters")
+	defer done(&err)
+	resp, err := c.client.BeginList(ctx, "/webhook-"+stately.ToKeyID(subscriptionID[:])+"/dead")
+	if err != nil {
+		return nil, err
+	}
+	var deadLetters []*schema.WebhookDeadLetter
+	for resp.Next() {
+		if deadLetter, ok := resp.Value().(*schema.WebhookDeadLetter); ok {
+			deadLetters = append(deadLetters, deadLetter)
+		}
+	}
+	_, err = resp.Token()
+	if err != nil {
+		return nil, err
+	}
+	return deadLetters, nil
+}
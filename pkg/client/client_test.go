@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+)
+
+// mustCreateUser creates a user with a unique email.
+func mustCreateUser(t *testing.T, c *Client) *schema.User {
+	t.Helper()
+	user, err := c.CreateUser(context.Background(), "Test User", uuid.NewString()+"@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user
+}
+
+// mustCreateResource creates a resource with a unique name.
+func mustCreateResource(t *testing.T, c *Client, owner uuid.UUID) *schema.Resource {
+	t.Helper()
+	resource, err := c.CreateResource(context.Background(), "res-"+uuid.NewString(), owner)
+	if err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+	return resource
+}
+
+func TestScheduleLeaseApprover(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient()
+	owner := mustCreateUser(t, c)
+	other := mustCreateUser(t, c)
+	user := mustCreateUser(t, c)
+	owned := mustCreateResource(t, c, owner.Id)
+	unowned := mustCreateResource(t, c, uuid.Nil)
+
+	for _, tc := range []struct {
+		name     string
+		resource uuid.UUID
+		approver uuid.UUID
+		want     error
+	}{
+		{"owner approves", owned.Id, owner.Id, nil},
+		{"non-owner approves", owned.Id, other.Id, ErrNotApprover},
+		{"no approver", owned.Id, uuid.Nil, nil},
+		{"anyone approves an unowned resource", unowned.Id, other.Id, nil},
+	} {
+		_, err := c.ScheduleLease(ctx, user.Id, tc.resource, "test", time.Hour, tc.approver, time.Now().Add(time.Hour))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: ScheduleLease = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestActivateScheduledLeaseAfterOwnerChange(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient()
+	owner := mustCreateUser(t, c)
+	newOwner := mustCreateUser(t, c)
+	user := mustCreateUser(t, c)
+	resource := mustCreateResource(t, c, owner.Id)
+
+	startAt := time.Now().Add(time.Hour)
+	if _, err := c.ScheduleLease(ctx, user.Id, resource.Id, "test", time.Hour, owner.Id, startAt); err != nil {
+		t.Fatalf("ScheduleLease: %v", err)
+	}
+	resource.OwnerId = newOwner.Id
+	if _, err := c.client.Put(ctx, resource); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	leases, err := c.ActivateScheduledLeases(ctx, startAt)
+	if err != nil {
+		t.Fatalf("ActivateScheduledLeases: %v", err)
+	}
+	if len(leases) != 1 {
+		t.Fatalf("ActivateScheduledLeases activated %d leases, want 1", len(leases))
+	}
+	if lease := leases[0]; !LeasePending(lease) {
+		t.Fatalf("lease approved by the old owner was activated as approved by %v", lease.Approver)
+	}
+	pending, err := c.GetPendingApprovals(ctx, newOwner.Id)
+	if err != nil {
+		t.Fatalf("GetPendingApprovals: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Id != leases[0].Id {
+		t.Fatalf("new owner's inbox = %v, want the activated lease", pending)
+	}
+}
+
+func TestLeaseETag(t *testing.T) {
+	touched := time.Now().Truncate(time.Millisecond)
+	lease := &schema.Lease{Id: uuid.New(), UserId: uuid.New(), ResourceId: uuid.New(), DurationSeconds: time.Hour, LastTouched: touched}
+	approved := *lease
+	approved.Approver = uuid.New()
+	same := *lease
+
+	for _, tc := range []struct {
+		name  string
+		other *schema.Lease
+		equal bool
+	}{
+		{"unchanged", &same, true},
+		// A write in the same millisecond only changes the content.
+		{"approved in the same millisecond", &approved, false},
+	} {
+		if got := LeaseETag(lease) == LeaseETag(tc.other); got != tc.equal {
+			t.Errorf("%s: ETags equal = %v, want %v", tc.name, got, tc.equal)
+		}
+	}
+}
+
+func TestApproveLeaseIfMatch(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient()
+	owner := mustCreateUser(t, c)
+	user := mustCreateUser(t, c)
+	resource := mustCreateResource(t, c, owner.Id)
+	lease, err := c.CreateLease(ctx, user.Id, resource.Id, "test", time.Hour, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	// Denying the lease then approving it with the ETag from before the
+	// denial usually happens within the same millisecond.
+	stale := LeaseETag(lease)
+	if _, err := c.DenyLease(ctx, lease.Id, owner.Id, "no", stale); err != nil {
+		t.Fatalf("DenyLease: %v", err)
+	}
+	if _, err := c.ApproveLease(ctx, lease.Id, owner.Id, "", stale); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("ApproveLease with a stale ETag = %v, want ErrPreconditionFailed", err)
+	}
+}
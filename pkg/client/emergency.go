@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/notify"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+// DefaultMaxEmergencyDuration is how long break-glass leases last at most
+// when Limits.MaxEmergencyDuration isn't set.
+const DefaultMaxEmergencyDuration = time.Hour
+
+var (
+	// ErrEmergencyDetails is returned when a break-glass lease is requested
+	// without a reason or an incident reference.
+	ErrEmergencyDetails = errors.New("emergency leases need a reason and an incident reference")
+	ErrReviewNotFound   = errors.New("emergency review not found")
+	ErrAlreadyReviewed  = errors.New("emergency review has already been acknowledged")
+	// ErrEmergencyExtension is returned when touching a break-glass lease,
+	// which would take it past the emergency cap. Take a new one instead.
+	ErrEmergencyExtension = errors.New("emergency leases can't be extended")
+)
+
+// CreateEmergencyLease grants a break-glass lease, which is active straight
+// away without waiting for an approver. The duration is capped at
+// Limits.MaxEmergencyDuration (and defaults to it), and quotas aren't
+// enforced, since neither should get in the way during an incident. In
+// exchange the lease fires a high-priority lease.emergency event, and an
+// EmergencyReview is created that the resource's owner has to acknowledge.
+func (c *Client) CreateEmergencyLease(ctx context.Context, userID, resourceID uuid.UUID, reason, incidentRef string, duration time.Duration) (_ *schema.Lease, err error) {
+	ctx, done := observe(ctx, "CreateEmergencyLease")
+	defer done(&err)
+	if reason == "" || incidentRef == "" {
+		return nil, ErrEmergencyDetails
+	}
+	maxDuration := c.limits.MaxEmergencyDuration
+	if maxDuration <= 0 {
+		maxDuration = DefaultMaxEmergencyDuration
+	}
+	if duration <= 0 || duration > maxDuration {
+		duration = maxDuration
+	}
+
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		lease := &schema.Lease{
+			UserId:          userID,
+			ResourceId:      resourceID,
+			Reason:          reason,
+			DurationSeconds: duration,
+			Emergency:       true,
+			IncidentRef:     incidentRef,
+		}
+		id, err := txn.Put(lease)
+		if err != nil {
+			return err
+		}
+		if lease.Id, err = uuid.FromBytes(id.Bytes); err != nil {
+			return err
+		}
+		if err := syncLeaseIndex(txn, nil, lease); err != nil {
+			return err
+		}
+		if err := syncLeaseGrant(txn, lease, time.Now(), grantEnd(lease)); err != nil {
+			return err
+		}
+		_, err = txn.Put(&schema.EmergencyReview{
+			LeaseId:         lease.Id,
+			ResourceId:      resourceID,
+			UserId:          userID,
+			Reason:          reason,
+			IncidentRef:     incidentRef,
+			DurationSeconds: duration,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The lease is always the first item put.
+	lease := results.PutResponse[0].(*schema.Lease)
+	c.invalidateAccess(lease)
+	c.notify(ctx, notify.Event{
+		Type:      notify.LeaseEmergency,
+		Priority:  notify.PriorityHigh,
+		Time:      time.Now(),
+		Lease:     lease,
+		ExpiresAt: LeaseExpiry(lease),
+	})
+	return lease, nil
+}
+
+// AcknowledgeEmergencyReview marks the review of a break-glass lease as done.
+// If the resource has an owner only the owner can acknowledge it, and
+// otherwise anyone but the user who took the lease can.
+func (c *Client) AcknowledgeEmergencyReview(ctx context.Context, leaseID, reviewer uuid.UUID, comment string) (_ *schema.EmergencyReview, err error) {
+	ctx, done := observe(ctx, "AcknowledgeEmergencyReview")
+	defer done(&err)
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		item, err := txn.Get("/review-" + stately.ToKeyID(leaseID[:]))
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrReviewNotFound
+		}
+		review := item.(*schema.EmergencyReview)
+		if review.AcknowledgedBy != uuid.Nil {
+			return ErrAlreadyReviewed
+		}
+		if reviewer == review.UserId {
+			return ErrSelfApproval
+		}
+		owner, err := resourceOwner(txn, review.ResourceId)
+		if err != nil {
+			return err
+		}
+		if err := checkApprover(owner, reviewer); err != nil {
+			return err
+		}
+		review.AcknowledgedBy = reviewer
+		review.AcknowledgedAt = time.Now()
+		review.Comment = comment
+		_, err = txn.Put(review)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results.PutResponse[0].(*schema.EmergencyReview), nil
+}
+
+// ListEmergencyReviews returns the reviews of every break-glass lease taken
+// on the resource, acknowledged or not. Reviews don't expire, so this pages
+// through the whole list.
+func (c *Client) ListEmergencyReviews(ctx context.Context, resourceID uuid.UUID) (_ []*schema.EmergencyReview, err error) {
+	ctx, done := observe(ctx, "ListEmergencyReviews")
+	defer done(&err)
+	resp, err := c.client.BeginList(ctx, "/res-"+stately.ToKeyID(resourceID[:])+"/review")
+	if err != nil {
+		return nil, err
+	}
+	var reviews []*schema.EmergencyReview
+	for {
+		for resp.Next() {
+			if review, ok := resp.Value().(*schema.EmergencyReview); ok {
+				reviews = append(reviews, review)
+			}
+		}
+		token, err := resp.Token()
+		if err != nil {
+			return nil, err
+		}
+		if !token.CanContinue {
+			return reviews, nil
+		}
+		if resp, err = c.client.ContinueList(ctx, token.Data); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/sdkerror"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+// fakeStately is an in-process stand-in for a Stately store, with enough of
+// stately.Client for the calls this package makes.
+//
+// Items are stored under every key path their type has, IDs with an initial
+// value and metadata timestamps are filled in on Put, and transactions run
+// one at a time, reading what was committed before they started (not their
+// own writes) and applying their writes only if the handler succeeds. Lists
+// and scans return everything in one page. Items are never expired by TTL.
+type fakeStately struct {
+	// Methods this package doesn't call panic.
+	stately.Client
+
+	// txnMu serialises transactions, so they can't conflict.
+	txnMu sync.Mutex
+
+	mu    sync.Mutex
+	items map[string]stately.Item
+	// changes records every key path written or deleted, for SyncList.
+	changes []string
+}
+
+func newFakeStately() *fakeStately {
+	return &fakeStately{items: map[string]stately.Item{}}
+}
+
+// newTestClient returns a client backed by an empty fakeStately.
+func newTestClient() (*Client, *fakeStately) {
+	f := newFakeStately()
+	return &Client{client: f}, f
+}
+
+// fakeKeyPaths returns every key path the item is stored under.
+func fakeKeyPaths(item stately.Item) []string {
+	switch item := item.(type) {
+	case *schema.User:
+		return []string{item.KeyPath(), "/user_email-" + stately.ToKeyID(item.Email)}
+	case *schema.Lease:
+		return []string{
+			item.KeyPath(),
+			"/res-" + stately.ToKeyID(item.ResourceId[:]) + "/lease-" + stately.ToKeyID(item.Id[:]),
+			"/lease-" + stately.ToKeyID(item.Id[:]),
+		}
+	case *schema.ScheduledLease:
+		return []string{
+			item.KeyPath(),
+			"/res-" + stately.ToKeyID(item.ResourceId[:]) + "/sched-" + stately.ToKeyID(item.Id[:]),
+			"/sched-" + stately.ToKeyID(item.Id[:]),
+		}
+	case *schema.LeaseGrant:
+		return []string{item.KeyPath(), "/user-" + stately.ToKeyID(item.UserId[:]) + "/grant-" + stately.ToKeyID(item.LeaseId[:])}
+	case *schema.EmergencyReview:
+		return []string{item.KeyPath(), "/res-" + stately.ToKeyID(item.ResourceId[:]) + "/review-" + stately.ToKeyID(item.LeaseId[:])}
+	case *schema.CampaignItem:
+		return []string{item.KeyPath(), "/owner-" + stately.ToKeyID(item.OwnerId[:]) + "/campaign-" + stately.ToKeyID(item.CampaignId[:]) + "/item-" + stately.ToKeyID(item.LeaseId[:])}
+	}
+	return []string{item.KeyPath()}
+}
+
+// fakeClone copies an item through its wire format, so callers can't change
+// what's stored.
+func fakeClone(item stately.Item) stately.Item {
+	wire, err := item.MarshalStately()
+	if err != nil {
+		panic(err)
+	}
+	clone := reflect.New(reflect.TypeOf(item).Elem()).Interface().(stately.Item)
+	if err := clone.UnmarshalStately(wire); err != nil {
+		panic(err)
+	}
+	return clone
+}
+
+// prepare fills in the item's generated ID and metadata timestamps the way
+// the store would, and checks MustNotExist. It returns a copy of the item to
+// store. f.mu must be held.
+func (f *fakeStately) prepare(item stately.Item) (stately.Item, stately.GeneratedID, error) {
+	var opts stately.WithPutOptions
+	if withOpts, ok := item.(stately.WithPutOptions); ok {
+		opts = withOpts
+	} else if withOpts, ok := item.(*stately.WithPutOptions); ok {
+		opts = *withOpts
+	} else {
+		opts.Item = item
+	}
+	stored := fakeClone(opts.Item)
+
+	var id stately.GeneratedID
+	v := reflect.ValueOf(stored).Elem()
+	if field := v.FieldByName("Id"); field.IsValid() && field.Type() == reflect.TypeOf(uuid.UUID{}) {
+		if field.Interface().(uuid.UUID) == uuid.Nil {
+			field.Set(reflect.ValueOf(uuid.New()))
+		}
+		generated := field.Interface().(uuid.UUID)
+		id.Bytes = generated[:]
+	}
+
+	existing := f.items[stored.KeyPath()]
+	if opts.MustNotExist {
+		for _, keyPath := range fakeKeyPaths(stored) {
+			if f.items[keyPath] != nil {
+				return nil, id, &sdkerror.Error{StatelyCode: sdkerror.ConditionalCheckFailed, Message: keyPath + " already exists"}
+			}
+		}
+	}
+	if !opts.OverwriteMetadataTimestamps {
+		now := time.Now().Truncate(time.Millisecond)
+		if field := v.FieldByName("CreatedAt"); field.IsValid() {
+			createdAt := now
+			if existing != nil {
+				createdAt = reflect.ValueOf(existing).Elem().FieldByName("CreatedAt").Interface().(time.Time)
+			}
+			field.Set(reflect.ValueOf(createdAt))
+		}
+		for _, name := range []string{"LastTouched", "LastModified"} {
+			if field := v.FieldByName(name); field.IsValid() && field.Type() == reflect.TypeOf(time.Time{}) {
+				field.Set(reflect.ValueOf(now))
+			}
+		}
+	}
+	return stored, id, nil
+}
+
+// put stores an item prepared by prepare. f.mu must be held.
+func (f *fakeStately) put(item stately.Item) {
+	f.delete(item.KeyPath())
+	for _, keyPath := range fakeKeyPaths(item) {
+		f.items[keyPath] = item
+		f.changes = append(f.changes, keyPath)
+	}
+}
+
+// delete removes the item at keyPath from every key path it's stored under.
+// f.mu must be held.
+func (f *fakeStately) delete(keyPath string) {
+	item := f.items[keyPath]
+	if item == nil {
+		return
+	}
+	for _, keyPath := range fakeKeyPaths(item) {
+		delete(f.items, keyPath)
+		f.changes = append(f.changes, keyPath)
+	}
+}
+
+func (f *fakeStately) get(keyPaths ...string) []stately.Item {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var items []stately.Item
+	for _, keyPath := range keyPaths {
+		if item := f.items[keyPath]; item != nil {
+			items = append(items, fakeClone(item))
+		}
+	}
+	return items
+}
+
+func (f *fakeStately) list(prefix string) stately.ListResponse[stately.Item] {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keyPaths []string
+	for keyPath := range f.items {
+		if strings.HasPrefix(keyPath, prefix) {
+			keyPaths = append(keyPaths, keyPath)
+		}
+	}
+	slices.Sort(keyPaths)
+	resp := &fakeList[stately.Item]{token: fakeToken(prefix, len(f.changes))}
+	for _, keyPath := range keyPaths {
+		resp.values = append(resp.values, fakeClone(f.items[keyPath]))
+	}
+	return resp
+}
+
+func (f *fakeStately) WithAllowStale(bool) stately.Client {
+	return f
+}
+
+func (f *fakeStately) Get(_ context.Context, keyPath string) (stately.Item, error) {
+	if items := f.get(keyPath); len(items) > 0 {
+		return items[0], nil
+	}
+	return nil, nil
+}
+
+func (f *fakeStately) GetBatch(_ context.Context, keyPaths ...string) ([]stately.Item, error) {
+	return f.get(keyPaths...), nil
+}
+
+func (f *fakeStately) Put(ctx context.Context, item stately.Item) (stately.Item, error) {
+	items, err := f.PutBatch(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func (f *fakeStately) PutBatch(_ context.Context, items ...stately.Item) ([]stately.Item, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := make([]stately.Item, len(items))
+	for i, item := range items {
+		var err error
+		if stored[i], _, err = f.prepare(item); err != nil {
+			return nil, err
+		}
+	}
+	results := make([]stately.Item, len(stored))
+	for i, item := range stored {
+		f.put(item)
+		results[i] = fakeClone(item)
+	}
+	return results, nil
+}
+
+func (f *fakeStately) Delete(_ context.Context, keyPaths ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, keyPath := range keyPaths {
+		f.delete(keyPath)
+	}
+	return nil
+}
+
+func (f *fakeStately) BeginList(_ context.Context, prefix string, _ ...stately.ListOptions) (stately.ListResponse[stately.Item], error) {
+	return f.list(prefix), nil
+}
+
+func (f *fakeStately) ContinueList(context.Context, []byte) (stately.ListResponse[stately.Item], error) {
+	return &fakeList[stately.Item]{}, nil
+}
+
+func (f *fakeStately) BeginScan(_ context.Context, opts ...stately.ScanOptions) (stately.ListResponse[stately.Item], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var itemTypes []string
+	for _, opt := range opts {
+		itemTypes = append(itemTypes, opt.ItemTypes...)
+	}
+	var keyPaths []string
+	for keyPath, item := range f.items {
+		if keyPath == item.KeyPath() && (len(itemTypes) == 0 || slices.Contains(itemTypes, item.StatelyItemType())) {
+			keyPaths = append(keyPaths, keyPath)
+		}
+	}
+	slices.Sort(keyPaths)
+	resp := &fakeList[stately.Item]{}
+	for _, keyPath := range keyPaths {
+		resp.values = append(resp.values, fakeClone(f.items[keyPath]))
+	}
+	return resp, nil
+}
+
+func (f *fakeStately) ContinueScan(context.Context, []byte) (stately.ListResponse[stately.Item], error) {
+	return &fakeList[stately.Item]{}, nil
+}
+
+// SyncList reports a change for every write since the token under its prefix.
+// Unlike the real thing it doesn't say what changed.
+func (f *fakeStately) SyncList(_ context.Context, token []byte) (stately.ListResponse[stately.SyncResponse], error) {
+	prefix, version := parseFakeToken(token)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &fakeList[stately.SyncResponse]{token: fakeToken(prefix, len(f.changes))}
+	for _, keyPath := range f.changes[version:] {
+		if strings.HasPrefix(keyPath, prefix) {
+			resp.values = append(resp.values, &stately.Deleted{KeyPath: keyPath})
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeStately) NewTransaction(_ context.Context, handler stately.TransactionHandler) (*stately.TransactionResults, error) {
+	f.txnMu.Lock()
+	defer f.txnMu.Unlock()
+	txn := &fakeTxn{f: f}
+	if err := handler(txn); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	results := &stately.TransactionResults{Committed: true}
+	for _, w := range txn.writes {
+		if w.item == nil {
+			f.delete(w.keyPath)
+			results.DeleteResponse = append(results.DeleteResponse, w.keyPath)
+			continue
+		}
+		f.put(w.item)
+		results.PutResponse = append(results.PutResponse, fakeClone(w.item))
+	}
+	return results, nil
+}
+
+// fakeTxn buffers a transaction's writes until its handler returns.
+type fakeTxn struct {
+	f      *fakeStately
+	writes []fakeWrite
+}
+
+// fakeWrite is a put of item, or a delete of keyPath if item is nil.
+type fakeWrite struct {
+	item    stately.Item
+	keyPath string
+}
+
+func (t *fakeTxn) Get(keyPath string) (stately.Item, error) {
+	return t.f.Get(context.Background(), keyPath)
+}
+
+func (t *fakeTxn) GetBatch(keyPaths ...string) ([]stately.Item, error) {
+	return t.f.get(keyPaths...), nil
+}
+
+func (t *fakeTxn) Put(item stately.Item) (stately.GeneratedID, error) {
+	ids, err := t.PutBatch(item)
+	if err != nil {
+		return stately.GeneratedID{}, err
+	}
+	return ids[0], nil
+}
+
+func (t *fakeTxn) PutBatch(items ...stately.Item) ([]stately.GeneratedID, error) {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	ids := make([]stately.GeneratedID, len(items))
+	for i, item := range items {
+		stored, id, err := t.f.prepare(item)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+		t.writes = append(t.writes, fakeWrite{item: stored})
+	}
+	return ids, nil
+}
+
+func (t *fakeTxn) Delete(keyPaths ...string) error {
+	for _, keyPath := range keyPaths {
+		t.writes = append(t.writes, fakeWrite{keyPath: keyPath})
+	}
+	return nil
+}
+
+func (t *fakeTxn) BeginList(prefix string, _ ...stately.ListOptions) (stately.ListResponse[stately.Item], error) {
+	return t.f.list(prefix), nil
+}
+
+func (t *fakeTxn) ContinueList(*stately.ListToken) (stately.ListResponse[stately.Item], error) {
+	return &fakeList[stately.Item]{}, nil
+}
+
+// fakeList is a single page of results.
+type fakeList[T any] struct {
+	values []T
+	next   int
+	token  []byte
+}
+
+func (l *fakeList[T]) Next() bool {
+	if l.next == len(l.values) {
+		return false
+	}
+	l.next++
+	return true
+}
+
+func (l *fakeList[T]) Value() T {
+	return l.values[l.next-1]
+}
+
+func (l *fakeList[T]) Token() (*stately.ListToken, error) {
+	return &stately.ListToken{Data: l.token, CanSync: true}, nil
+}
+
+// fakeToken encodes a list's prefix and how many changes it has seen.
+func fakeToken(prefix string, version int) []byte {
+	return []byte(strconv.Itoa(version) + " " + prefix)
+}
+
+func parseFakeToken(token []byte) (string, int) {
+	version, prefix, _ := strings.Cut(string(token), " ")
+	n, _ := strconv.Atoi(version)
+	return prefix, n
+}
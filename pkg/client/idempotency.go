@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/sdkerror"
+	"github.com/StatelyCloud/go-sdk/stately"
+)
+
+// A finished request's response is kept for idempotencyTTL.
+const idempotencyTTL = 24 * time.Hour
+
+// ReserveIdempotencyKey claims key for a request whose body hashes to
+// requestHash, returning nil. If the key has already been claimed it returns
+// the existing record instead, which has a zero Status if that request is
+// still running. The claim lasts for timeout, so a request that dies halfway
+// doesn't hold on to its key for long; it has to be at least as long as the
+// request can run, or a retry could run it a second time.
+func (c *Client) ReserveIdempotencyKey(ctx context.Context, key, requestHash string, timeout time.Duration) (_ *schema.IdempotencyRecord, err error) {
+	ctx, done := observe(ctx, "ReserveIdempotencyKey")
+	defer done(&err)
+	for {
+		_, err = c.client.Put(ctx, stately.WithPutOptions{
+			Item: &schema.IdempotencyRecord{
+				Key:         key,
+				RequestHash: requestHash,
+				TtlSeconds:  timeout,
+			},
+			MustNotExist: true,
+		})
+		if !sdkerror.Is(err, sdkerror.ConditionalCheckFailed) {
+			return nil, err
+		}
+		item, err := c.client.Get(ctx, "/idem-"+stately.ToKeyID(key))
+		if err != nil {
+			return nil, err
+		}
+		if item != nil {
+			return item.(*schema.IdempotencyRecord), nil
+		}
+		// It expired between the Put and the Get, so try again.
+	}
+}
+
+// CompleteIdempotencyKey stores the response to the request that reserved
+// record.Key, to be replayed to any retries.
+func (c *Client) CompleteIdempotencyKey(ctx context.Context, record *schema.IdempotencyRecord) (err error) {
+	ctx, done := observe(ctx, "CompleteIdempotencyKey")
+	defer done(&err)
+	record.TtlSeconds = idempotencyTTL
+	_, err = c.client.Put(ctx, record)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets key, so that the request can be retried.
+func (c *Client) ReleaseIdempotencyKey(ctx context.Context, key string) (err error) {
+	ctx, done := observe(ctx, "ReleaseIdempotencyKey")
+	defer done(&err)
+	return c.client.Delete(ctx, "/idem-"+stately.ToKeyID(key))
+}
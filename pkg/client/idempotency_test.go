@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	c, f := newTestClient()
+	const key = "/v2/leases v2 retry-me"
+
+	for _, tc := range []struct {
+		name string
+		// step is run before reserving key for a request hashing to hash.
+		step func(t *testing.T)
+		hash string
+		// want is the existing record ReserveIdempotencyKey should return,
+		// or nil if it should reserve the key.
+		want *schema.IdempotencyRecord
+	}{
+		{"first request", nil, "abc", nil},
+		{"retry while running", nil, "abc", &schema.IdempotencyRecord{Key: key, RequestHash: "abc", TtlSeconds: time.Minute}},
+		{"different request while running", nil, "def", &schema.IdempotencyRecord{Key: key, RequestHash: "abc", TtlSeconds: time.Minute}},
+		{"retry after completing", func(t *testing.T) {
+			err := c.CompleteIdempotencyKey(ctx, &schema.IdempotencyRecord{Key: key, RequestHash: "abc", Status: 201, ContentType: "application/json", Body: `{"id":1}`})
+			if err != nil {
+				t.Fatalf("CompleteIdempotencyKey: %v", err)
+			}
+		}, "abc", &schema.IdempotencyRecord{Key: key, RequestHash: "abc", Status: 201, ContentType: "application/json", Body: `{"id":1}`, TtlSeconds: idempotencyTTL}},
+		{"different request after completing", nil, "def", &schema.IdempotencyRecord{Key: key, RequestHash: "abc", Status: 201, ContentType: "application/json", Body: `{"id":1}`, TtlSeconds: idempotencyTTL}},
+		{"retry after releasing", func(t *testing.T) {
+			if err := c.ReleaseIdempotencyKey(ctx, key); err != nil {
+				t.Fatalf("ReleaseIdempotencyKey: %v", err)
+			}
+		}, "def", nil},
+	} {
+		if tc.step != nil {
+			tc.step(t)
+		}
+		got, err := c.ReserveIdempotencyKey(ctx, key, tc.hash, time.Minute)
+		if err != nil {
+			t.Fatalf("%s: ReserveIdempotencyKey: %v", tc.name, err)
+		}
+		if tc.want == nil {
+			if got != nil {
+				t.Errorf("%s: ReserveIdempotencyKey = %+v, want the key reserved", tc.name, got)
+			}
+			continue
+		}
+		if got == nil {
+			t.Errorf("%s: ReserveIdempotencyKey reserved the key, want %+v", tc.name, tc.want)
+			continue
+		}
+		if got.Key != tc.want.Key || got.RequestHash != tc.want.RequestHash || got.Status != tc.want.Status ||
+			got.ContentType != tc.want.ContentType || got.Body != tc.want.Body || got.TtlSeconds != tc.want.TtlSeconds {
+			t.Errorf("%s: ReserveIdempotencyKey = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+
+	// The reservation only lasts as long as it was asked to.
+	item, err := f.Get(ctx, "/idem-"+stately.ToKeyID(key))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if ttl := item.(*schema.IdempotencyRecord).TtlSeconds; ttl != time.Minute {
+		t.Errorf("reserved key's TTL = %v, want %v", ttl, time.Minute)
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+// Limits caps how many leases a user or resource can have at once. A lease
+// counts from when it's requested (or scheduled) until it expires or is
+// revoked, whether or not it's been approved, so that unapproved requests
+// can't pile up either. Zero means no limit.
+type Limits struct {
+	MaxLeasesPerUser     int
+	MaxLeasesPerResource int
+	// MaxEmergencyDuration caps break-glass leases. Zero means
+	// DefaultMaxEmergencyDuration.
+	MaxEmergencyDuration time.Duration
+}
+
+// QuotaExceededError is returned when a new lease would take a user or
+// resource over its limit.
+type QuotaExceededError struct {
+	// Scope is "user" or "resource".
+	Scope  string
+	Active int
+	Limit  int
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s already has %d of %d allowed leases", e.Scope, e.Active, e.Limit)
+}
+
+// SetLimits sets the lease limits enforced by CreateLease, ScheduleLease and
+// RequestTemplate.
+func (c *Client) SetLimits(limits Limits) {
+	c.limits = limits
+}
+
+// checkLimits counts the user's and resource's unexpired leases in txn, so
+// that concurrent requests can't both squeeze in under the limit. Scheduled
+// leases that haven't started yet count too, since activating them doesn't
+// check again. (The user's key path prefix lists them already.) txn's reads
+// don't see its own writes, so userLeases is how many leases the user has
+// already been given earlier in txn.
+func (c *Client) checkLimits(txn stately.Transaction, userID, resourceID uuid.UUID, userLeases int) error {
+	now := time.Now()
+	if limit := c.limits.MaxLeasesPerUser; limit > 0 {
+		active, err := countUnexpiredLeases(txn, "/user-"+stately.ToKeyID(userID[:])+"/res", now)
+		if err != nil {
+			return err
+		}
+		active += userLeases
+		if active >= limit {
+			return &QuotaExceededError{Scope: "user", Active: active, Limit: limit}
+		}
+	}
+	if limit := c.limits.MaxLeasesPerResource; limit > 0 {
+		active, err := countUnexpiredLeases(txn, "/res-"+stately.ToKeyID(resourceID[:])+"/lease", now)
+		if err != nil {
+			return err
+		}
+		scheduled, err := countUnexpiredLeases(txn, "/res-"+stately.ToKeyID(resourceID[:])+"/sched", now)
+		if err != nil {
+			return err
+		}
+		active += scheduled
+		if active >= limit {
+			return &QuotaExceededError{Scope: "resource", Active: active, Limit: limit}
+		}
+	}
+	return nil
+}
+
+func countUnexpiredLeases(txn stately.Transaction, prefix string, now time.Time) (int, error) {
+	count := 0
+	resp, err := txn.BeginList(prefix)
+	for {
+		if err != nil {
+			return 0, err
+		}
+		for resp.Next() {
+			switch item := resp.Value().(type) {
+			case *schema.Lease:
+				if expiry := LeaseExpiry(item); expiry.IsZero() || now.Before(expiry) {
+					count++
+				}
+			case *schema.ScheduledLease:
+				count++
+			}
+		}
+		token, err := resp.Token()
+		if err != nil {
+			return 0, err
+		}
+		if !token.CanContinue {
+			return count, nil
+		}
+		resp, err = txn.ContinueList(token)
+	}
+}
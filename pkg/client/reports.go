@@ -0,0 +1,194 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+const (
+	ReportByResource = "resource"
+	ReportByUser     = "user"
+)
+
+var (
+	ErrInvalidReport = errors.New("reports are by resource or by user")
+	ErrInvalidRange  = errors.New("the start of a time range has to be before its end")
+)
+
+// AccessSummary is one row of an access report: what a resource (or user)
+// was granted over the report's range.
+type AccessSummary struct {
+	// ID is the resource's (or user's) ID, and Name its name (or email). The
+	// ID is bytes so that it's base64 in JSON, like the schema types' IDs.
+	ID   []byte `json:"id"`
+	Name string `json:"name"`
+	// Leases counts the leases that granted access at some point in the range.
+	Leases int `json:"leases"`
+	// LeaseHours is how long those leases granted access within the range,
+	// up to now.
+	LeaseHours float64 `json:"lease_hours"`
+	// DistinctUsers is only set in reports by resource, and DistinctResources
+	// in reports by user.
+	DistinctUsers     int `json:"distinct_users,omitempty"`
+	DistinctResources int `json:"distinct_resources,omitempty"`
+	// Approved counts leases that an owner approved, and SelfService the
+	// break-glass leases that skipped approval.
+	Approved    int `json:"approved"`
+	SelfService int `json:"self_service"`
+}
+
+// ReportAccess summarizes the leases that granted access between from and to,
+// by resource or by user. A zero from means since the beginning and a zero to
+// means now. It's built from lease grants, which outlive the leases
+// themselves, so it covers expired and revoked leases too. Rows are sorted by
+// name.
+func (c *Client) ReportAccess(ctx context.Context, by string, from, to time.Time) (_ []AccessSummary, err error) {
+	ctx, done := observe(ctx, "ReportAccess")
+	defer done(&err)
+	now := time.Now()
+	if by != ReportByResource && by != ReportByUser {
+		return nil, ErrInvalidReport
+	}
+	if to.IsZero() {
+		to = now
+	}
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+
+	names := map[uuid.UUID]string{}
+	if by == ReportByResource {
+		resources, err := c.ListResources(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resources {
+			names[resource.Id] = resource.Name
+		}
+	} else {
+		users, err := c.ListUsers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			names[user.Id] = user.Email
+		}
+	}
+
+	rows := map[uuid.UUID]*AccessSummary{}
+	distinct := map[uuid.UUID]map[uuid.UUID]bool{}
+	err = c.scan(ctx, "LeaseGrant", func(item stately.Item) {
+		grant, ok := item.(*schema.LeaseGrant)
+		if !ok {
+			return
+		}
+		start := maxTime(grant.GrantedAt, from)
+		end := minTime(to, now)
+		if !grant.EndsAt.IsZero() {
+			end = minTime(end, grant.EndsAt)
+		}
+		if !start.Before(end) {
+			return
+		}
+
+		id, other := grant.ResourceId, grant.UserId
+		if by == ReportByUser {
+			id, other = grant.UserId, grant.ResourceId
+		}
+		row := rows[id]
+		if row == nil {
+			row = &AccessSummary{ID: id[:], Name: names[id]}
+			rows[id] = row
+			distinct[id] = map[uuid.UUID]bool{}
+		}
+		row.Leases++
+		row.LeaseHours += end.Sub(start).Hours()
+		distinct[id][other] = true
+		if grant.Emergency {
+			row.SelfService++
+		} else {
+			row.Approved++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]AccessSummary, 0, len(rows))
+	for id, row := range rows {
+		if by == ReportByResource {
+			row.DistinctUsers = len(distinct[id])
+		} else {
+			row.DistinctResources = len(distinct[id])
+		}
+		summaries = append(summaries, *row)
+	}
+	slices.SortFunc(summaries, func(a, b AccessSummary) int {
+		if n := strings.Compare(a.Name, b.Name); n != 0 {
+			return n
+		}
+		return bytes.Compare(a.ID, b.ID)
+	})
+	return summaries, nil
+}
+
+// syncLeaseGrant records that a lease grants access until endsAt (the zero
+// time if it doesn't expire), for access reports. Call it in the transaction
+// that writes (or revokes) the lease. A lease that's pending or denied grants
+// nothing, so it's left alone. The first time a lease is recorded its grant
+// starts at grantedAt; after that only the end moves.
+func syncLeaseGrant(txn stately.Transaction, lease *schema.Lease, grantedAt, endsAt time.Time) error {
+	if LeasePending(lease) || LeaseDenied(lease) {
+		return nil
+	}
+	grant := &schema.LeaseGrant{
+		LeaseId:    lease.Id,
+		ResourceId: lease.ResourceId,
+		UserId:     lease.UserId,
+		Emergency:  lease.Emergency,
+		GrantedAt:  grantedAt,
+	}
+	if !lease.Emergency {
+		grant.Approver = lease.Approver
+	}
+	item, err := txn.Get(grant.KeyPath())
+	if err != nil {
+		return err
+	}
+	if existing, ok := item.(*schema.LeaseGrant); ok {
+		grant = existing
+	}
+	grant.EndsAt = endsAt
+	_, err = txn.Put(grant)
+	return err
+}
+
+// grantEnd is when a lease that's being put now stops granting access.
+func grantEnd(lease *schema.Lease) time.Time {
+	if lease.DurationSeconds == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(lease.DurationSeconds)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+)
+
+var ErrResourceNameTaken = errors.New("resource name belongs to another resource")
+
+func resourceNameKeyPath(name string) string {
+	return "/res_name-" + stately.ToKeyID(name)
+}
+
+// GetResourceByName returns the resource that has claimed the name, or nil if
+// none has.
+func (c *Client) GetResourceByName(ctx context.Context, name string) (_ *schema.Resource, err error) {
+	ctx, done := observe(ctx, "GetResourceByName")
+	defer done(&err)
+	item, err := c.client.Get(ctx, resourceNameKeyPath(strings.TrimSpace(name)))
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return c.GetResource(ctx, item.(*schema.ResourceName).ResourceId)
+}
+
+// ClaimResourceNames claims the names of resources that were created before
+// names were unique (or that were copied in by migrate-ddb). It's safe to run
+// more than once. A name shared by several resources goes to whichever is
+// claimed first, and the others are returned so they can be renamed.
+func (c *Client) ClaimResourceNames(ctx context.Context) (claimed int, conflicts []*schema.Resource, err error) {
+	ctx, done := observe(ctx, "ClaimResourceNames")
+	defer done(&err)
+	resources, err := c.ListResources(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, resource := range resources {
+		var conflict, put bool
+		_, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+			conflict, put = false, false
+			item, err := txn.Get(resourceNameKeyPath(resource.Name))
+			if err != nil {
+				return err
+			}
+			if item != nil {
+				conflict = item.(*schema.ResourceName).ResourceId != resource.Id
+				return nil
+			}
+			put = true
+			_, err = txn.Put(&schema.ResourceName{Name: resource.Name, ResourceId: resource.Id})
+			return err
+		})
+		if err != nil {
+			return claimed, conflicts, err
+		}
+		if conflict {
+			conflicts = append(conflicts, resource)
+		} else if put {
+			claimed++
+		}
+	}
+	return claimed, conflicts, nil
+}
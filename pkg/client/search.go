@@ -0,0 +1,353 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxExpiryRange and maxCreatedRange bound how many hourly and daily
+	// index lists a time range can cost.
+	maxExpiryRange  = 31 * 24 * time.Hour
+	maxCreatedRange = 366 * 24 * time.Hour
+	// maxReasonWords is the most words of a reason that are indexed.
+	maxReasonWords = 10
+	// DefaultSearchLimit is how many leases SearchLeases returns if the
+	// filter doesn't say.
+	DefaultSearchLimit = 100
+)
+
+var (
+	ErrUnindexedSearch = errors.New("lease search needs a state, an approver, a word of the reason, an expiry range of at most 31 days or a creation range of at most a year")
+	ErrInvalidState    = errors.New("state must be pending, approved, denied or emergency")
+)
+
+// LeaseFilter is a lease search. Every field that's set has to match. At
+// least one of them has to be indexed: State, Approver, Reason (by its
+// words), ExpiresBefore or CreatedAfter.
+type LeaseFilter struct {
+	// State is one of LeaseState's values.
+	State    string
+	Approver uuid.UUID
+	// Reason matches leases whose reason has every word of it, ignoring case
+	// and punctuation, so "INC-" finds "INC-1234 db failover". Only the
+	// first maxReasonWords words of a reason are indexed.
+	Reason string
+	// ExpiresAfter defaults to now when ExpiresBefore is set.
+	ExpiresAfter, ExpiresBefore time.Time
+	// CreatedBefore defaults to now when CreatedAfter is set.
+	CreatedAfter, CreatedBefore time.Time
+	// Limit defaults to DefaultSearchLimit.
+	Limit int
+}
+
+// LeaseState returns "pending", "approved", "denied" or "emergency". It
+// doesn't account for expiry.
+func LeaseState(lease *schema.Lease) string {
+	switch {
+	case LeaseDenied(lease):
+		return "denied"
+	case LeasePending(lease):
+		return "pending"
+	case lease.Emergency:
+		return "emergency"
+	default:
+		return "approved"
+	}
+}
+
+// SearchLeases returns the unexpired leases that match the filter. It lists
+// the most selective index the filter uses, then checks every filter against
+// the leases themselves, so the index never has to be exact. A range whose
+// end isn't after its start, such as an ExpiresBefore in the past, fails with
+// ErrInvalidRange.
+func (c *Client) SearchLeases(ctx context.Context, filter LeaseFilter) (_ []*schema.Lease, err error) {
+	ctx, done := observe(ctx, "SearchLeases")
+	defer done(&err)
+	now := time.Now()
+	if filter.State != "" && !slices.Contains([]string{"pending", "approved", "denied", "emergency"}, filter.State) {
+		return nil, ErrInvalidState
+	}
+	if !filter.ExpiresBefore.IsZero() && filter.ExpiresAfter.IsZero() {
+		filter.ExpiresAfter = now
+	}
+	if !filter.CreatedAfter.IsZero() && filter.CreatedBefore.IsZero() {
+		filter.CreatedBefore = now
+	}
+	// A range that ends before it starts can't match anything, and with
+	// ExpiresAfter defaulting to now that includes any ExpiresBefore in the
+	// past. Saying so is more use than saying it isn't indexed.
+	if (!filter.ExpiresBefore.IsZero() && !filter.ExpiresAfter.Before(filter.ExpiresBefore)) ||
+		(!filter.CreatedAfter.IsZero() && !filter.CreatedAfter.Before(filter.CreatedBefore)) {
+		return nil, ErrInvalidRange
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultSearchLimit
+	}
+
+	indexes := searchIndexes(filter)
+	if len(indexes) == 0 {
+		return nil, ErrUnindexedSearch
+	}
+
+	var leases []*schema.Lease
+	seen := map[uuid.UUID]bool{}
+	for _, index := range indexes {
+		ids, err := c.listLeaseIndex(ctx, index)
+		if err != nil {
+			return nil, err
+		}
+		var keyPaths []string
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				keyPaths = append(keyPaths, "/lease-"+stately.ToKeyID(id[:]))
+			}
+		}
+		for start := 0; start < len(keyPaths); start += 50 {
+			items, err := c.client.GetBatch(ctx, keyPaths[start:min(start+50, len(keyPaths))]...)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				if lease, ok := item.(*schema.Lease); ok && filter.matches(lease, now) {
+					leases = append(leases, lease)
+					if len(leases) == filter.Limit {
+						return leases, nil
+					}
+				}
+			}
+		}
+	}
+	return leases, nil
+}
+
+// searchIndexes picks the index lists to read for the filter: a single list
+// if it has an approver, reason or state, and otherwise one per hour (or day)
+// of its expiry (or creation) range.
+func searchIndexes(filter LeaseFilter) []string {
+	switch {
+	case filter.Approver != uuid.Nil:
+		return []string{approverIndex(filter.Approver)}
+	case len(reasonWords(filter.Reason)) > 0:
+		// The longest word is likely the rarest.
+		words := reasonWords(filter.Reason)
+		slices.SortStableFunc(words, func(a, b string) int { return len(b) - len(a) })
+		return []string{"reason:" + words[0]}
+	case !filter.ExpiresBefore.IsZero() && filter.ExpiresBefore.Sub(filter.ExpiresAfter) <= maxExpiryRange:
+		var indexes []string
+		for t := filter.ExpiresAfter.UTC().Truncate(time.Hour); !t.After(filter.ExpiresBefore); t = t.Add(time.Hour) {
+			indexes = append(indexes, expiresIndex(t))
+		}
+		return indexes
+	case !filter.CreatedAfter.IsZero() && filter.CreatedBefore.Sub(filter.CreatedAfter) <= maxCreatedRange:
+		var indexes []string
+		for t := filter.CreatedAfter.UTC().Truncate(24 * time.Hour); !t.After(filter.CreatedBefore); t = t.Add(24 * time.Hour) {
+			indexes = append(indexes, createdIndex(t))
+		}
+		return indexes
+	case filter.State != "":
+		return []string{"state:" + filter.State}
+	}
+	return nil
+}
+
+func (f *LeaseFilter) matches(lease *schema.Lease, now time.Time) bool {
+	expiry := LeaseExpiry(lease)
+	switch {
+	case !expiry.IsZero() && !now.Before(expiry):
+		return false
+	case f.State != "" && LeaseState(lease) != f.State:
+		return false
+	case f.Approver != uuid.Nil && (LeasePending(lease) || lease.Approver != f.Approver):
+		return false
+	case f.Reason != "" && !hasWords(lease.Reason, f.Reason):
+		return false
+	case !f.ExpiresBefore.IsZero() && (expiry.IsZero() || expiry.Before(f.ExpiresAfter) || expiry.After(f.ExpiresBefore)):
+		return false
+	case !f.CreatedAfter.IsZero() && (lease.CreatedAt.Before(f.CreatedAfter) || lease.CreatedAt.After(f.CreatedBefore)):
+		return false
+	}
+	return true
+}
+
+// hasWords reports whether every word of query is one of the reason's words.
+func hasWords(reason, query string) bool {
+	words := reasonWords(reason)
+	for _, word := range reasonWords(query) {
+		if !slices.Contains(words, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) listLeaseIndex(ctx context.Context, index string) ([]uuid.UUID, error) {
+	resp, err := c.client.BeginList(ctx, "/lease_index-"+stately.ToKeyID(index))
+	if err != nil {
+		return nil, err
+	}
+	var ids []uuid.UUID
+	for {
+		for resp.Next() {
+			if entry, ok := resp.Value().(*schema.LeaseIndexEntry); ok {
+				ids = append(ids, entry.LeaseId)
+			}
+		}
+		token, err := resp.Token()
+		if err != nil {
+			return nil, err
+		}
+		if !token.CanContinue {
+			return ids, nil
+		}
+		if resp, err = c.client.ContinueList(ctx, token.Data); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ReindexLeases writes the search index entries, report grants and approval
+// inbox entries of every unexpired lease, for leases written before those
+// existed or copied in by import or migrate-ddb, neither of which write them.
+// Run it after either, or pending leases won't show up in their owner's
+// inbox. Grants it writes start when their lease was created. It's safe to
+// run more than once, and returns how many leases it indexed.
+func (c *Client) ReindexLeases(ctx context.Context) (_ int, err error) {
+	ctx, done := observe(ctx, "ReindexLeases")
+	defer done(&err)
+	leases, err := c.ListLeases(ctx)
+	if err != nil {
+		return 0, err
+	}
+	indexed := 0
+	for _, lease := range leases {
+		// The entries expire when the lease does, rather than a full
+		// duration from now.
+		expiry := LeaseExpiry(lease)
+		ttl := time.Duration(0)
+		if !expiry.IsZero() {
+			if ttl = time.Until(expiry); ttl <= 0 {
+				continue
+			}
+		}
+		_, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+			if err := putLeaseIndex(txn, lease.Id, leaseIndexes(lease, lease.CreatedAt, expiry), ttl); err != nil {
+				return err
+			}
+			if err := syncLeaseGrant(txn, lease, lease.CreatedAt, expiry); err != nil {
+				return err
+			}
+			owner, err := resourceOwner(txn, lease.ResourceId)
+			if err != nil {
+				return err
+			}
+			return syncApprovalIndex(txn, lease, owner)
+		})
+		if err != nil {
+			return indexed, err
+		}
+		indexed++
+	}
+	return indexed, nil
+}
+
+// syncLeaseIndex updates the search index for a lease write. Call it in the
+// transaction that writes the lease, after the lease has been put, with the
+// lease as it was before the transaction (nil if it's new) and after it (nil
+// if it's being deleted). Putting a lease restarts its TTL, so the entries
+// are all re-put to restart theirs.
+func syncLeaseIndex(txn stately.Transaction, old, lease *schema.Lease) error {
+	now := time.Now()
+	var keep []string
+	if lease != nil {
+		createdAt := lease.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		var expiry time.Time
+		if lease.DurationSeconds > 0 {
+			expiry = now.Add(lease.DurationSeconds)
+		}
+		keep = leaseIndexes(lease, createdAt, expiry)
+		if err := putLeaseIndex(txn, lease.Id, keep, lease.DurationSeconds); err != nil {
+			return err
+		}
+	}
+	if old == nil {
+		return nil
+	}
+	for _, index := range leaseIndexes(old, old.CreatedAt, LeaseExpiry(old)) {
+		if !slices.Contains(keep, index) {
+			if err := txn.Delete(leaseIndexKeyPath(index, old.Id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func putLeaseIndex(txn stately.Transaction, leaseID uuid.UUID, indexes []string, ttl time.Duration) error {
+	for _, index := range indexes {
+		if _, err := txn.Put(&schema.LeaseIndexEntry{Index: index, LeaseId: leaseID, DurationSeconds: ttl}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// leaseIndexes returns the indexes a lease is listed under.
+func leaseIndexes(lease *schema.Lease, createdAt, expiry time.Time) []string {
+	indexes := []string{"state:" + LeaseState(lease), createdIndex(createdAt)}
+	if !LeasePending(lease) && lease.Approver != uuid.Nil {
+		indexes = append(indexes, approverIndex(lease.Approver))
+	}
+	if !expiry.IsZero() {
+		indexes = append(indexes, expiresIndex(expiry))
+	}
+	for _, word := range reasonWords(lease.Reason) {
+		indexes = append(indexes, "reason:"+word)
+	}
+	return indexes
+}
+
+func leaseIndexKeyPath(index string, leaseID uuid.UUID) string {
+	return "/lease_index-" + stately.ToKeyID(index) + "/lease-" + stately.ToKeyID(leaseID[:])
+}
+
+func approverIndex(approver uuid.UUID) string {
+	return "approver:" + approver.String()
+}
+
+func expiresIndex(t time.Time) string {
+	return "expires:" + t.UTC().Format("2006010215")
+}
+
+func createdIndex(t time.Time) string {
+	return "created:" + t.UTC().Format("20060102")
+}
+
+// reasonWords splits a reason into its distinct lowercase words, so
+// "INC-1234 db failover" is listed under "inc", "1234", "db" and "failover".
+func reasonWords(reason string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(reason), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(words) == maxReasonWords {
+			break
+		}
+		if !slices.Contains(words, word) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+)
+
+func TestSearchIndexesExpiryBuckets(t *testing.T) {
+	after := time.Date(2026, 3, 1, 10, 45, 0, 0, time.UTC)
+	indexes := searchIndexes(LeaseFilter{ExpiresAfter: after, ExpiresBefore: after.Add(2 * time.Hour)})
+	// 10:45 to 12:45 touches the 10:00, 11:00 and 12:00 buckets.
+	want := []string{"expires:2026030110", "expires:2026030111", "expires:2026030112"}
+	if !slices.Equal(indexes, want) {
+		t.Fatalf("searchIndexes = %v, want %v", indexes, want)
+	}
+
+	// Buckets are in UTC whatever zone the range is given in.
+	zone := time.FixedZone("UTC-5", -5*60*60)
+	indexes = searchIndexes(LeaseFilter{ExpiresAfter: after.In(zone), ExpiresBefore: after.In(zone).Add(30 * time.Minute)})
+	want = []string{"expires:2026030110", "expires:2026030111"}
+	if !slices.Equal(indexes, want) {
+		t.Fatalf("searchIndexes in UTC-5 = %v, want %v", indexes, want)
+	}
+
+	// A lease indexed under its expiry is in one of the buckets searched
+	// for a range that covers it.
+	expiry := after.Add(90 * time.Minute)
+	if !slices.Contains(searchIndexes(LeaseFilter{ExpiresAfter: after, ExpiresBefore: expiry}), expiresIndex(expiry)) {
+		t.Fatalf("searchIndexes up to %v doesn't include %s", expiry, expiresIndex(expiry))
+	}
+
+	if indexes := searchIndexes(LeaseFilter{ExpiresAfter: after, ExpiresBefore: after.Add(maxExpiryRange + time.Hour)}); indexes != nil {
+		t.Fatalf("searchIndexes for a range over %v = %v, want none", maxExpiryRange, indexes)
+	}
+}
+
+func TestLeaseFilterMatchesReason(t *testing.T) {
+	now := time.Now()
+	lease := &schema.Lease{Reason: "INC-1234 db failover", LastTouched: now, DurationSeconds: time.Hour}
+	for _, tc := range []struct {
+		reason string
+		want   bool
+	}{
+		{"INC-", true},
+		{"inc 1234", true},
+		{"DB, failover!", true},
+		{"INC-1235", false},
+		{"fail", false},
+	} {
+		filter := LeaseFilter{Reason: tc.reason}
+		if got := filter.matches(lease, now); got != tc.want {
+			t.Errorf("Reason %q matches %q = %v, want %v", tc.reason, lease.Reason, got, tc.want)
+		}
+	}
+
+	if indexes := searchIndexes(LeaseFilter{Reason: "INC-"}); !slices.Equal(indexes, []string{"reason:inc"}) {
+		t.Fatalf(`searchIndexes for "INC-" = %v, want [reason:inc]`, indexes)
+	}
+
+	filter := LeaseFilter{Reason: "INC-"}
+	if filter.matches(lease, now.Add(2*time.Hour)) {
+		t.Fatal("filter matched an expired lease")
+	}
+}
+
+func TestReasonWordsLimit(t *testing.T) {
+	var words []string
+	for i := range maxReasonWords + 2 {
+		words = append(words, "w"+strconv.Itoa(i))
+	}
+	reason := strings.Join(words, " ")
+	if got := reasonWords(reason); !slices.Equal(got, words[:maxReasonWords]) {
+		t.Fatalf("reasonWords = %v, want %v", got, words[:maxReasonWords])
+	}
+
+	// Repeated words don't use up the limit.
+	if got := reasonWords("a a A " + reason); len(got) != maxReasonWords || got[0] != "a" || got[1] != "w0" {
+		t.Fatalf("reasonWords with repeats = %v", got)
+	}
+
+	// Words past the limit aren't indexed, so they don't match either.
+	lease := &schema.Lease{Reason: reason}
+	if filter := (LeaseFilter{Reason: words[maxReasonWords]}); filter.matches(lease, time.Now()) {
+		t.Fatalf("Reason %q matched past the first %d words", words[maxReasonWords], maxReasonWords)
+	}
+}
+
+func TestSearchLeasesInvalidRange(t *testing.T) {
+	c := &Client{}
+	ctx := context.Background()
+	for _, filter := range []LeaseFilter{
+		{ExpiresBefore: time.Now().Add(-time.Hour)},
+		{ExpiresAfter: time.Now().Add(2 * time.Hour), ExpiresBefore: time.Now().Add(time.Hour)},
+		{CreatedAfter: time.Now().Add(time.Hour)},
+	} {
+		if _, err := c.SearchLeases(ctx, filter); !errors.Is(err, ErrInvalidRange) {
+			t.Errorf("SearchLeases(%+v) = %v, want ErrInvalidRange", filter, err)
+		}
+	}
+}
+
+func TestReindexLeasesFillsApprovalInbox(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient()
+	owner := mustCreateUser(t, c)
+	user := mustCreateUser(t, c)
+	resource := mustCreateResource(t, c, owner.Id)
+
+	// Restored leases, like imported or migrated ones, skip the inbox.
+	now := time.Now()
+	pending := &schema.Lease{Id: uuid.New(), UserId: user.Id, ResourceId: resource.Id, DurationSeconds: time.Hour, CreatedAt: now, LastTouched: now}
+	approved := &schema.Lease{Id: uuid.New(), UserId: user.Id, ResourceId: resource.Id, DurationSeconds: time.Hour, Approver: owner.Id, CreatedAt: now, LastTouched: now}
+	if err := c.RestoreBatch(ctx, pending, approved); err != nil {
+		t.Fatalf("RestoreBatch: %v", err)
+	}
+	if inbox, err := c.GetPendingApprovals(ctx, owner.Id); err != nil || len(inbox) != 0 {
+		t.Fatalf("inbox before reindexing = %v, %v", inbox, err)
+	}
+
+	if n, err := c.ReindexLeases(ctx); err != nil || n != 2 {
+		t.Fatalf("ReindexLeases = %d, %v, want 2", n, err)
+	}
+	inbox, err := c.GetPendingApprovals(ctx, owner.Id)
+	if err != nil {
+		t.Fatalf("GetPendingApprovals: %v", err)
+	}
+	if len(inbox) != 1 || inbox[0].Id != pending.Id {
+		t.Fatalf("inbox after reindexing = %v, want just the pending lease", inbox)
+	}
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/notify"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+// MaxTemplateResources is the most resources a template can bundle, so that
+// requesting it fits in one transaction.
+const MaxTemplateResources = 20
+
+var (
+	ErrTemplateNotFound = errors.New("lease template not found")
+	ErrInvalidTemplate  = fmt.Errorf("a lease template needs a name (without slashes) and between 1 and %d resources", MaxTemplateResources)
+)
+
+// PutTemplate creates a lease template, or replaces the one with the same
+// name. Every resource it names has to exist, and they can have at most one
+// owner between them, since the leases requested from it share an approval.
+func (c *Client) PutTemplate(ctx context.Context, template *schema.LeaseTemplate) (_ *schema.LeaseTemplate, err error) {
+	ctx, done := observe(ctx, "PutTemplate")
+	defer done(&err)
+	if template.Name == "" || strings.Contains(template.Name, "/") || len(template.Resources) == 0 || len(template.Resources) > MaxTemplateResources {
+		return nil, ErrInvalidTemplate
+	}
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		if _, err := templateResources(txn, template); err != nil {
+			return err
+		}
+		_, err := txn.Put(template)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results.PutResponse[0].(*schema.LeaseTemplate), nil
+}
+
+// GetTemplate returns the named template.
+func (c *Client) GetTemplate(ctx context.Context, name string) (_ *schema.LeaseTemplate, err error) {
+	ctx, done := observe(ctx, "GetTemplate")
+	defer done(&err)
+	item, err := c.client.Get(ctx, templateKeyPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrTemplateNotFound
+	}
+	return item.(*schema.LeaseTemplate), nil
+}
+
+// ListTemplates returns every lease template.
+func (c *Client) ListTemplates(ctx context.Context) (_ []*schema.LeaseTemplate, err error) {
+	ctx, done := observe(ctx, "ListTemplates")
+	defer done(&err)
+	var templates []*schema.LeaseTemplate
+	err = c.scan(ctx, "LeaseTemplate", func(item stately.Item) {
+		if template, ok := item.(*schema.LeaseTemplate); ok {
+			templates = append(templates, template)
+		}
+	})
+	return templates, err
+}
+
+// DeleteTemplate deletes the named template. Leases already requested from it
+// aren't affected.
+func (c *Client) DeleteTemplate(ctx context.Context, name string) (err error) {
+	ctx, done := observe(ctx, "DeleteTemplate")
+	defer done(&err)
+	return c.client.Delete(ctx, templateKeyPath(name))
+}
+
+// RequestTemplate requests a lease on every resource in the template for
+// userID, all in one transaction: either every lease is created or none are.
+// reason and duration default to the template's. The leases share a bundle
+// ID, and with it one approval: approving or denying any of them (see
+// ApproveLease and DenyLease) decides them all. If approver is set the leases
+// are created approved, as with CreateLease, and approver has to be able to
+// approve every one of them.
+func (c *Client) RequestTemplate(ctx context.Context, name string, userID uuid.UUID, reason string, duration time.Duration, approver uuid.UUID) (_ []*schema.Lease, err error) {
+	ctx, done := observe(ctx, "RequestTemplate")
+	defer done(&err)
+	bundleID := uuid.New()
+	results, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		item, err := txn.Get(templateKeyPath(name))
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrTemplateNotFound
+		}
+		template := item.(*schema.LeaseTemplate)
+		resources, err := templateResources(txn, template)
+		if err != nil {
+			return err
+		}
+		if reason == "" {
+			reason = template.Reason
+		}
+		if duration <= 0 {
+			duration = template.DurationSeconds
+		}
+		for i, resourceID := range resources {
+			lease := &schema.Lease{
+				UserId:          userID,
+				ResourceId:      resourceID,
+				Reason:          reason,
+				DurationSeconds: duration,
+				Approver:        approver,
+				BundleId:        bundleID,
+			}
+			if err := c.putNewLease(txn, lease, i); err != nil {
+				return err
+			}
+			if err := syncBundleMember(txn, lease); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var leases []*schema.Lease
+	for _, item := range results.PutResponse {
+		if lease, ok := item.(*schema.Lease); ok {
+			c.invalidateAccess(lease)
+			leases = append(leases, lease)
+		}
+	}
+	for _, lease := range leases {
+		c.emit(ctx, notify.LeaseRequested, lease)
+		if approver != uuid.Nil {
+			c.emit(ctx, notify.LeaseApproved, lease)
+		}
+	}
+	return leases, nil
+}
+
+// templateResources resolves the template's resource names to IDs, failing
+// with ErrInvalidTemplate if any of them don't exist, are listed twice, or
+// are owned by different people.
+func templateResources(txn stately.Transaction, template *schema.LeaseTemplate) ([]uuid.UUID, error) {
+	var keyPaths []string
+	for _, name := range template.Resources {
+		keyPaths = append(keyPaths, resourceNameKeyPath(name))
+	}
+	items, err := txn.GetBatch(keyPaths...)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]uuid.UUID{}
+	for _, item := range items {
+		if claim, ok := item.(*schema.ResourceName); ok {
+			ids[claim.Name] = claim.ResourceId
+		}
+	}
+	resources := make([]uuid.UUID, 0, len(template.Resources))
+	for _, name := range template.Resources {
+		id, ok := ids[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: there's no resource named %q", ErrInvalidTemplate, name)
+		}
+		if slices.Contains(resources, id) {
+			return nil, fmt.Errorf("%w: %q is listed twice", ErrInvalidTemplate, name)
+		}
+		resources = append(resources, id)
+	}
+
+	// A bundle shares one approval, so one person has to be able to approve
+	// all of it: the resources can't have more than one owner between them.
+	keyPaths = keyPaths[:0]
+	for _, id := range resources {
+		keyPaths = append(keyPaths, "/res-"+stately.ToKeyID(id[:]))
+	}
+	if items, err = txn.GetBatch(keyPaths...); err != nil {
+		return nil, err
+	}
+	owner := uuid.Nil
+	for _, item := range items {
+		resource, ok := item.(*schema.Resource)
+		if !ok || resource.OwnerId == uuid.Nil {
+			continue
+		}
+		if owner != uuid.Nil && resource.OwnerId != owner {
+			return nil, fmt.Errorf("%w: its resources have different owners, so no one could approve it", ErrInvalidTemplate)
+		}
+		owner = resource.OwnerId
+	}
+	return resources, nil
+}
+
+// bundleLeases returns the unexpired leases in a bundle.
+func bundleLeases(txn stately.Transaction, bundleID uuid.UUID) ([]*schema.Lease, error) {
+	resp, err := txn.BeginList("/bundle-" + stately.ToKeyID(bundleID[:]))
+	if err != nil {
+		return nil, err
+	}
+	var keyPaths []string
+	for {
+		for resp.Next() {
+			if member, ok := resp.Value().(*schema.BundleMember); ok {
+				keyPaths = append(keyPaths, "/lease-"+stately.ToKeyID(member.LeaseId[:]))
+			}
+		}
+		token, err := resp.Token()
+		if err != nil {
+			return nil, err
+		}
+		if !token.CanContinue {
+			break
+		}
+		if resp, err = txn.ContinueList(token); err != nil {
+			return nil, err
+		}
+	}
+	if len(keyPaths) == 0 {
+		return nil, nil
+	}
+	items, err := txn.GetBatch(keyPaths...)
+	if err != nil {
+		return nil, err
+	}
+	var leases []*schema.Lease
+	for _, item := range items {
+		if lease, ok := item.(*schema.Lease); ok {
+			leases = append(leases, lease)
+		}
+	}
+	return leases, nil
+}
+
+// syncBundleMember re-puts a bundled lease's member entry, so its TTL
+// restarts along with the lease's. Call it in the transaction that puts the
+// lease, after the lease.
+func syncBundleMember(txn stately.Transaction, lease *schema.Lease) error {
+	if lease.BundleId == uuid.Nil {
+		return nil
+	}
+	_, err := txn.Put(&schema.BundleMember{
+		BundleId:        lease.BundleId,
+		LeaseId:         lease.Id,
+		DurationSeconds: lease.DurationSeconds,
+	})
+	return err
+}
+
+func bundleMemberKeyPath(bundleID, leaseID uuid.UUID) string {
+	return "/bundle-" + stately.ToKeyID(bundleID[:]) + "/lease-" + stately.ToKeyID(leaseID[:])
+}
+
+func templateKeyPath(name string) string {
+	return "/template-" + stately.ToKeyID(name)
+}
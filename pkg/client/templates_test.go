@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+)
+
+func TestRequestTemplateAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		// breakLast makes the template's last resource fail, after the
+		// template has been saved.
+		breakLast func(t *testing.T, c *Client, f *fakeStately, last *schema.Resource)
+		// wantErr reports whether RequestTemplate failed the right way.
+		wantErr func(err error) bool
+	}{
+		{"resource renamed away", func(t *testing.T, c *Client, f *fakeStately, last *schema.Resource) {
+			if err := f.Delete(ctx, resourceNameKeyPath(last.Name)); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+		}, func(err error) bool { return errors.Is(err, ErrInvalidTemplate) }},
+		{"resource given another owner", func(t *testing.T, c *Client, f *fakeStately, last *schema.Resource) {
+			last.OwnerId = mustCreateUser(t, c).Id
+			if _, err := f.Put(ctx, last); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}, func(err error) bool { return errors.Is(err, ErrInvalidTemplate) }},
+		{"resource at its lease limit", func(t *testing.T, c *Client, f *fakeStately, last *schema.Resource) {
+			c.SetLimits(Limits{MaxLeasesPerResource: 1})
+			if _, err := c.CreateLease(ctx, mustCreateUser(t, c).Id, last.Id, "test", time.Hour, uuid.Nil); err != nil {
+				t.Fatalf("CreateLease: %v", err)
+			}
+		}, func(err error) bool {
+			var quotaErr *QuotaExceededError
+			return errors.As(err, &quotaErr)
+		}},
+	} {
+		c, f := newTestClient()
+		owner := mustCreateUser(t, c)
+		user := mustCreateUser(t, c)
+		var resources []*schema.Resource
+		var names []string
+		for range 3 {
+			resource := mustCreateResource(t, c, owner.Id)
+			resources = append(resources, resource)
+			names = append(names, resource.Name)
+		}
+		if _, err := c.PutTemplate(ctx, &schema.LeaseTemplate{Name: "oncall", Resources: names, DurationSeconds: time.Hour}); err != nil {
+			t.Fatalf("%s: PutTemplate: %v", tc.name, err)
+		}
+		tc.breakLast(t, c, f, resources[len(resources)-1])
+		before, err := c.ListLeases(ctx)
+		if err != nil {
+			t.Fatalf("%s: ListLeases: %v", tc.name, err)
+		}
+
+		if _, err := c.RequestTemplate(ctx, "oncall", user.Id, "", 0, uuid.Nil); !tc.wantErr(err) {
+			t.Errorf("%s: RequestTemplate = %v", tc.name, err)
+		}
+		after, err := c.ListLeases(ctx)
+		if err != nil {
+			t.Fatalf("%s: ListLeases: %v", tc.name, err)
+		}
+		if len(after) != len(before) {
+			t.Errorf("%s: RequestTemplate left %d leases behind", tc.name, len(after)-len(before))
+		}
+		if pending, err := c.GetPendingApprovals(ctx, owner.Id); err != nil || len(pending) != len(before) {
+			t.Errorf("%s: owner's inbox = %v, %v, want only the leases from before", tc.name, pending, err)
+		}
+	}
+}
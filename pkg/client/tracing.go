@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/metrics"
+	"github.com/StatelyCloud/demo-w/pkg/tracing"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// observe starts a span for a Client method. The returned function ends it
+// and records the call's latency and error in metrics; defer it with a pointer
+// to the method's named error result.
+func observe(ctx context.Context, method string) (context.Context, func(*error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "Client."+method)
+	return ctx, func(err *error) {
+		metrics.ObserveCall("stately", method, start, err)
+		tracing.End(span, err)
+	}
+}
+
+// tracedClient wraps a stately.Client with a span for each call to the store,
+// recording the item type, key path prefix and number of results. The SDK
+// doesn't let us change its transport, so trace context stops here rather
+// than continuing into the Stately sidecar.
+type tracedClient struct {
+	stately.Client
+}
+
+func (c tracedClient) Get(ctx context.Context, itemPath string) (_ stately.Item, err error) {
+	ctx, span := tracing.Start(ctx, "stately.Get", keyPathPrefix(itemPath))
+	defer tracing.End(span, &err)
+	item, err := c.Client.Get(ctx, itemPath)
+	if item != nil {
+		span.SetAttributes(tracing.ItemTypeKey.String(item.StatelyItemType()), tracing.ResultCountKey.Int(1))
+	} else {
+		span.SetAttributes(tracing.ResultCountKey.Int(0))
+	}
+	return item, err
+}
+
+func (c tracedClient) GetBatch(ctx context.Context, itemPaths ...string) (_ []stately.Item, err error) {
+	ctx, span := tracing.Start(ctx, "stately.GetBatch", keyPathPrefixes(itemPaths))
+	defer tracing.End(span, &err)
+	items, err := c.Client.GetBatch(ctx, itemPaths...)
+	span.SetAttributes(itemTypes(items), tracing.ResultCountKey.Int(len(items)))
+	return items, err
+}
+
+func (c tracedClient) Put(ctx context.Context, item stately.Item) (_ stately.Item, err error) {
+	ctx, span := tracing.Start(ctx, "stately.Put", tracing.ItemTypeKey.String(item.StatelyItemType()))
+	defer tracing.End(span, &err)
+	return c.Client.Put(ctx, item)
+}
+
+func (c tracedClient) PutBatch(ctx context.Context, items ...stately.Item) (_ []stately.Item, err error) {
+	ctx, span := tracing.Start(ctx, "stately.PutBatch", itemTypes(items), tracing.ResultCountKey.Int(len(items)))
+	defer tracing.End(span, &err)
+	return c.Client.PutBatch(ctx, items...)
+}
+
+func (c tracedClient) Delete(ctx context.Context, itemPaths ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "stately.Delete", keyPathPrefixes(itemPaths), tracing.ResultCountKey.Int(len(itemPaths)))
+	defer tracing.End(span, &err)
+	return c.Client.Delete(ctx, itemPaths...)
+}
+
+func (c tracedClient) BeginList(ctx context.Context, keyPath string, opts ...stately.ListOptions) (stately.ListResponse[stately.Item], error) {
+	ctx, span := tracing.Start(ctx, "stately.BeginList", keyPathPrefix(keyPath))
+	resp, err := c.Client.BeginList(ctx, keyPath, opts...)
+	return traceList(span, resp, err)
+}
+
+func (c tracedClient) ContinueList(ctx context.Context, token []byte) (stately.ListResponse[stately.Item], error) {
+	ctx, span := tracing.Start(ctx, "stately.ContinueList")
+	resp, err := c.Client.ContinueList(ctx, token)
+	return traceList(span, resp, err)
+}
+
+func (c tracedClient) BeginScan(ctx context.Context, opts ...stately.ScanOptions) (stately.ListResponse[stately.Item], error) {
+	var types []string
+	for _, opt := range opts {
+		types = append(types, opt.ItemTypes...)
+	}
+	ctx, span := tracing.Start(ctx, "stately.BeginScan", tracing.ItemTypeKey.StringSlice(types))
+	resp, err := c.Client.BeginScan(ctx, opts...)
+	return traceList(span, resp, err)
+}
+
+func (c tracedClient) ContinueScan(ctx context.Context, token []byte) (stately.ListResponse[stately.Item], error) {
+	ctx, span := tracing.Start(ctx, "stately.ContinueScan")
+	resp, err := c.Client.ContinueScan(ctx, token)
+	return traceList(span, resp, err)
+}
+
+func (c tracedClient) SyncList(ctx context.Context, token []byte) (stately.ListResponse[stately.SyncResponse], error) {
+	ctx, span := tracing.Start(ctx, "stately.SyncList")
+	resp, err := c.Client.SyncList(ctx, token)
+	if err != nil {
+		tracing.End(span, &err)
+		return nil, err
+	}
+	return &tracedSyncResponse{ListResponse: resp, span: span}, nil
+}
+
+func (c tracedClient) NewTransaction(ctx context.Context, handler stately.TransactionHandler) (_ *stately.TransactionResults, err error) {
+	ctx, span := tracing.Start(ctx, "stately.NewTransaction")
+	defer tracing.End(span, &err)
+	results, err := c.Client.NewTransaction(ctx, handler)
+	if results != nil {
+		span.SetAttributes(itemTypes(results.PutResponse), tracing.ResultCountKey.Int(len(results.PutResponse)))
+	}
+	return results, err
+}
+
+// traceList keeps the span open until the caller has read the whole page, so
+// that it can record how many items there were.
+func traceList(span trace.Span, resp stately.ListResponse[stately.Item], err error) (stately.ListResponse[stately.Item], error) {
+	if err != nil {
+		tracing.End(span, &err)
+		return nil, err
+	}
+	return &tracedListResponse{ListResponse: resp, span: span}, nil
+}
+
+type tracedListResponse struct {
+	stately.ListResponse[stately.Item]
+	span  trace.Span
+	count int
+	types map[string]bool
+}
+
+func (r *tracedListResponse) Next() bool {
+	if !r.ListResponse.Next() {
+		return false
+	}
+	r.count++
+	if r.types == nil {
+		r.types = map[string]bool{}
+	}
+	r.types[r.Value().StatelyItemType()] = true
+	return true
+}
+
+func (r *tracedListResponse) Token() (_ *stately.ListToken, err error) {
+	defer tracing.End(r.span, &err)
+	types := make([]string, 0, len(r.types))
+	for t := range r.types {
+		types = append(types, t)
+	}
+	r.span.SetAttributes(tracing.ResultCountKey.Int(r.count), tracing.ItemTypeKey.StringSlice(types))
+	return r.ListResponse.Token()
+}
+
+type tracedSyncResponse struct {
+	stately.ListResponse[stately.SyncResponse]
+	span  trace.Span
+	count int
+}
+
+func (r *tracedSyncResponse) Next() bool {
+	if !r.ListResponse.Next() {
+		return false
+	}
+	r.count++
+	return true
+}
+
+func (r *tracedSyncResponse) Token() (_ *stately.ListToken, err error) {
+	defer tracing.End(r.span, &err)
+	r.span.SetAttributes(tracing.ResultCountKey.Int(r.count))
+	return r.ListResponse.Token()
+}
+
+// keyPathPrefix records the key path with its IDs stripped (e.g.
+// "/user-X/res-Y/lease" becomes "/user/res/lease"), so spans for the same kind
+// of lookup can be grouped.
+func keyPathPrefix(keyPath string) attribute.KeyValue {
+	segments := strings.Split(strings.TrimPrefix(keyPath, "/"), "/")
+	for i, segment := range segments {
+		segments[i], _, _ = strings.Cut(segment, "-")
+	}
+	return tracing.KeyPathPrefixKey.String("/" + strings.Join(segments, "/"))
+}
+
+func keyPathPrefixes(keyPaths []string) attribute.KeyValue {
+	seen := map[string]bool{}
+	var prefixes []string
+	for _, keyPath := range keyPaths {
+		prefix := keyPathPrefix(keyPath).Value.AsString()
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return tracing.KeyPathPrefixKey.StringSlice(prefixes)
+}
+
+func itemTypes(items []stately.Item) attribute.KeyValue {
+	seen := map[string]bool{}
+	var types []string
+	for _, item := range items {
+		if t := item.StatelyItemType(); !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	return tracing.ItemTypeKey.StringSlice(types)
+}
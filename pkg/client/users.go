@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrEmailTaken   = errors.New("email address belongs to another user")
+	ErrInvalidEmail = errors.New("email address isn't valid")
+)
+
+var emailRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+$`)
+
+// NormalizeEmail returns the form emails are stored and looked up in, so
+// Foo@example.com and foo@example.com are the same user.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// UpdateUserEmail changes a user's email. Stately moves the user's
+// /user_email- key path along with the item, and the check that nobody else
+// has the new email happens in the same transaction, so two users can never
+// end up with the same email. A malformed email fails with ErrInvalidEmail.
+func (c *Client) UpdateUserEmail(ctx context.Context, userID uuid.UUID, email string) (_ *schema.User, err error) {
+	ctx, done := observe(ctx, "UpdateUserEmail")
+	defer done(&err)
+	email = NormalizeEmail(email)
+	if !emailRegex.MatchString(email) {
+		return nil, ErrInvalidEmail
+	}
+	var user *schema.User
+	_, err = c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+		item, err := txn.Get("/user-" + stately.ToKeyID(userID[:]))
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrUserNotFound
+		}
+		user = item.(*schema.User)
+		if user.Email == email {
+			return nil
+		}
+		if err := checkEmailFree(txn, email, userID); err != nil {
+			return err
+		}
+		user.Email = email
+		_, err = txn.Put(user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// checkEmailFree returns ErrEmailTaken if a user other than userID already
+// has the email.
+func checkEmailFree(txn stately.Transaction, email string, userID uuid.UUID) error {
+	item, err := txn.Get("/user_email-" + stately.ToKeyID(email))
+	if err != nil {
+		return err
+	}
+	if item != nil && item.(*schema.User).Id != userID {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// NormalizeUserEmails lowercases the emails of users created before emails
+// were normalized, so CreateUser and UpdateUserEmail see them when checking
+// that an email is free. It's safe to run more than once. Users whose
+// normalized email already belongs to someone else are left as they are and
+// returned so one of them can be given a different email.
+func (c *Client) NormalizeUserEmails(ctx context.Context) (normalized int, conflicts []*schema.User, err error) {
+	ctx, done := observe(ctx, "NormalizeUserEmails")
+	defer done(&err)
+	users, err := c.ListUsers(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, user := range users {
+		if user.Email == NormalizeEmail(user.Email) {
+			continue
+		}
+		var conflict, put bool
+		_, err := c.client.NewTransaction(ctx, func(txn stately.Transaction) error {
+			conflict, put = false, false
+			item, err := txn.Get("/user-" + stately.ToKeyID(user.Id[:]))
+			if err != nil {
+				return err
+			}
+			if item == nil {
+				return nil
+			}
+			current := item.(*schema.User)
+			email := NormalizeEmail(current.Email)
+			if current.Email == email {
+				return nil
+			}
+			if err := checkEmailFree(txn, email, current.Id); errors.Is(err, ErrEmailTaken) {
+				conflict = true
+				return nil
+			} else if err != nil {
+				return err
+			}
+			put = true
+			current.Email = email
+			_, err = txn.Put(current)
+			return err
+		})
+		if err != nil {
+			return normalized, conflicts, err
+		}
+		if conflict {
+			conflicts = append(conflicts, user)
+		} else if put {
+			normalized++
+		}
+	}
+	return normalized, conflicts, nil
+}
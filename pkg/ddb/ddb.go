@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"maps"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/StatelyCloud/demo-w/pkg/tracing"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
@@ -22,16 +26,23 @@ Package client provides a DynamoDB implementation of the resource leasing system
 Table Design:
 This implementation uses a single DynamoDB table with the following structure:
 - Primary Key: PK (partition key) and SK (sort key)
-- GSI1: Index for querying leases by user
-- GSI2: Index for querying leases by resource
+- GSI1: Index for querying leases by user, or by user and resource
+- GSI2: Index for querying leases by resource, or by resource and user
 
 Key Patterns:
 - User records:         PK=USER#{id}, SK=METADATA
 - Email lookup records: PK=EMAIL#{id}, SK=METADATA
 - Resource records:     PK=RESOURCE#{id}, SK=METADATA
-- Lease records:        PK=LEASE#{id}, SK=METADATA, GSI1PK=USER#{id}, GSI2PK=RESOURCE#{id}
+- Lease records:        PK=LEASE#{id}, SK=METADATA,
+                        GSI1PK=USER#{id}, GSI1SK=RESOURCE#{id}#LEASE#{id},
+                        GSI2PK=RESOURCE#{id}, GSI2SK=USER#{id}#LEASE#{id}
+- Lease bundles:        PK=BUNDLE#{id}, SK=METADATA
 
-Table creation command:
+Leases written before the GSI sort keys included the other side of the lease
+have GSI1SK=GSI2SK=LEASE#{id}. They're still found by user and by resource,
+but not by both until BackfillLeaseIndexKeys has rewritten them.
+
+Table creation command (or see CreateTable):
 
 	aws dynamodb create-table \
 		--table-name YourTableName \
@@ -89,12 +100,18 @@ type User struct {
 	ID          uuid.UUID `dynamodbav:"id"`
 	DisplayName string    `dynamodbav:"display_name"`
 	Email       string    `dynamodbav:"email"`
+	// Unlike Stately's metadata timestamps, these are only as good as the
+	// code that sets them. Items written before they existed have zero times.
+	CreatedAt    time.Time `dynamodbav:"created_at"`
+	LastModified time.Time `dynamodbav:"last_modified"`
 }
 
 // Resource represents a resource in DynamoDB
 type Resource struct {
-	ID   uuid.UUID `dynamodbav:"id"`
-	Name string    `dynamodbav:"name"`
+	ID           uuid.UUID `dynamodbav:"id"`
+	Name         string    `dynamodbav:"name"`
+	CreatedAt    time.Time `dynamodbav:"created_at"`
+	LastModified time.Time `dynamodbav:"last_modified"`
 }
 
 // Lease represents a lease in DynamoDB
@@ -105,20 +122,140 @@ type Lease struct {
 	Reason   string        `dynamodbav:"reason"`
 	Duration time.Duration `dynamodbav:"duration"`
 	TTL      int64         `dynamodbav:"ttl"` // DynamoDB TTL field
+	// Approver is who approved the lease, as in schema-v2. The lease isn't
+	// valid until someone other than its user has approved it.
+	Approver uuid.UUID `dynamodbav:"approver"`
+	// BundleID is set on leases created together by CreateLeaseBundle.
+	BundleID     uuid.UUID `dynamodbav:"bundle_id"`
+	CreatedAt    time.Time `dynamodbav:"created_at"`
+	LastModified time.Time `dynamodbav:"last_modified"`
+}
+
+// Bundle records the leases CreateLeaseBundle created together, so that
+// they can be approved together. It expires along with them.
+type Bundle struct {
+	ID        uuid.UUID   `dynamodbav:"id"`
+	LeaseIDs  []uuid.UUID `dynamodbav:"lease_ids"`
+	TTL       int64       `dynamodbav:"ttl"`
+	CreatedAt time.Time   `dynamodbav:"created_at"`
 }
 
+// MaxBundleLeases is the most leases a bundle can hold. A transaction writes
+// at most 100 items, and one of them is the bundle record.
+const MaxBundleLeases = 99
+
 type DynamoDBClient struct {
 	client *dynamodb.Client
 	table  string
 }
 
-func NewDynamoDBClient(ctx context.Context, tableName string) (*DynamoDBClient, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+var (
+	ErrLeaseNotFound = errors.New("lease not found")
+	ErrSelfApproval  = errors.New("users can't approve their own leases")
+	// ErrPreconditionFailed is returned when an update's ifMatch isn't the
+	// lease's current ETag, i.e. someone else has changed it in the meantime.
+	ErrPreconditionFailed = errors.New("lease has been modified since it was read")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrEmailTaken         = errors.New("email address belongs to another user")
+	ErrBundleNotFound     = errors.New("lease bundle not found")
+)
+
+// LeaseETag identifies the current version of a lease, for If-Match. It's
+// made from last_modified, which every write sets. Leases written before
+// last_modified existed use their ttl instead, which is moved by every update
+// that matters (extending it).
+func LeaseETag(lease *Lease) string {
+	if lease.LastModified.IsZero() {
+		return `"` + strconv.FormatInt(lease.TTL, 10) + `"`
+	}
+	return `"` + lease.LastModified.Format(time.RFC3339Nano) + `"`
+}
+
+// etagCondition returns a condition expression (and its names and values)
+// that only holds if the lease's ETag is still ifMatch.
+func etagCondition(ifMatch string) (string, map[string]string, map[string]types.AttributeValue) {
+	etag := strings.Trim(ifMatch, `"`)
+	if ttl, err := strconv.ParseInt(etag, 10, 64); err == nil {
+		return "attribute_exists(PK) AND attribute_not_exists(last_modified) AND #ttl = :etag",
+			map[string]string{"#ttl": "ttl"},
+			map[string]types.AttributeValue{":etag": &types.AttributeValueMemberN{Value: strconv.FormatInt(ttl, 10)}}
+	}
+	return "attribute_exists(PK) AND #lm = :etag",
+		map[string]string{"#lm": "last_modified"},
+		map[string]types.AttributeValue{":etag": &types.AttributeValueMemberS{Value: etag}}
+}
+
+// unexpiredCondition only holds for a lease that exists and whose ttl hasn't
+// passed (:epoch is now, in Unix seconds). DynamoDB can take days to delete
+// expired items, and writing a new ttl would bring one back to life.
+const unexpiredCondition = "attribute_exists(PK) AND #ttl > :epoch"
+
+// leaseExpired reports whether the lease's ttl has passed, even if DynamoDB
+// hasn't deleted it yet.
+func leaseExpired(lease *Lease, now time.Time) bool {
+	return lease.TTL != 0 && lease.TTL <= now.Unix()
+}
+
+// nowUTC is the time the client stamps on writes. It's in UTC so the stored
+// strings (and so ETags) don't depend on the machine's time zone.
+func nowUTC() time.Time {
+	return time.Now().UTC()
+}
+
+// Option configures NewDynamoDBClient.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	endpoint    string
+	region      string
+	credentials aws.CredentialsProvider
+}
+
+// WithEndpoint sends requests to a different endpoint than AWS's, such as
+// DynamoDB Local at http://localhost:8000.
+func WithEndpoint(endpoint string) Option {
+	return func(o *clientOptions) { o.endpoint = endpoint }
+}
+
+// WithRegion overrides the region from the environment and shared config.
+func WithRegion(region string) Option {
+	return func(o *clientOptions) { o.region = region }
+}
+
+// WithStaticCredentials uses fixed credentials rather than the default chain.
+// DynamoDB Local accepts any.
+func WithStaticCredentials(accessKeyID, secretAccessKey string) Option {
+	return func(o *clientOptions) {
+		o.credentials = credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, "")
+	}
+}
+
+// NewDynamoDBClient creates a client for the given table. By default it's
+// configured like any other AWS SDK client (environment, shared config, IAM
+// role); the options override parts of that.
+func NewDynamoDBClient(ctx context.Context, tableName string, opts ...Option) (*DynamoDBClient, error) {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var loadOpts []func(*config.LoadOptions) error
+	if o.region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(o.region))
+	}
+	if o.credentials != nil {
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(o.credentials))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to load SDK config: %w", err)
 	}
+	cfg.APIOptions = append(cfg.APIOptions, addTraceContext)
 
-	client := dynamodb.NewFromConfig(cfg)
+	client := dynamodb.NewFromConfig(cfg, func(do *dynamodb.Options) {
+		if o.endpoint != "" {
+			do.BaseEndpoint = aws.String(o.endpoint)
+		}
+	})
 
 	return &DynamoDBClient{
 		client: client,
@@ -126,12 +263,93 @@ func NewDynamoDBClient(ctx context.Context, tableName string) (*DynamoDBClient,
 	}, nil
 }
 
+// CreateTable creates the table described in the package comment and turns
+// on TTL for the ttl attribute, waiting until the table is ready to use. It's
+// meant for bootstrapping development and test environments.
+func (c *DynamoDBClient) CreateTable(ctx context.Context) (err error) {
+	ctx, done := observe(ctx, "CreateTable")
+	defer done(&err)
+	throughput := &types.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(5),
+		WriteCapacityUnits: aws.Int64(5),
+	}
+	var attributes []types.AttributeDefinition
+	for _, name := range []string{"PK", "SK", "GSI1PK", "GSI1SK", "GSI2PK", "GSI2SK"} {
+		attributes = append(attributes, types.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: types.ScalarAttributeTypeS,
+		})
+	}
+	keySchema := func(hash, rng string) []types.KeySchemaElement {
+		return []types.KeySchemaElement{
+			{AttributeName: aws.String(hash), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String(rng), KeyType: types.KeyTypeRange},
+		}
+	}
+	gsi := func(name string) types.GlobalSecondaryIndex {
+		return types.GlobalSecondaryIndex{
+			IndexName:             aws.String(name),
+			KeySchema:             keySchema(name+"PK", name+"SK"),
+			Projection:            &types.Projection{ProjectionType: types.ProjectionTypeAll},
+			ProvisionedThroughput: throughput,
+		}
+	}
+
+	_, err = c.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:              aws.String(c.table),
+		AttributeDefinitions:   attributes,
+		KeySchema:              keySchema("PK", "SK"),
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{gsi("GSI1"), gsi("GSI2")},
+		ProvisionedThroughput:  throughput,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+	waiter := dynamodb.NewTableExistsWaiter(c.client, func(o *dynamodb.TableExistsWaiterOptions) {
+		o.MinDelay = 100 * time.Millisecond
+	})
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(c.table)}, time.Minute); err != nil {
+		return fmt.Errorf("failed waiting for table: %w", err)
+	}
+
+	_, err = c.client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(c.table),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String("ttl"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable TTL: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that the table is reachable.
+func (c *DynamoDBClient) Ping(ctx context.Context) (err error) {
+	ctx, done := observe(ctx, "Ping")
+	defer done(&err)
+	_, err = c.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(c.table),
+	})
+	return err
+}
+
 var emailRegex = regexp.MustCompile(`[^@]+@[^@]+`)
 
-func (c *DynamoDBClient) CreateUser(ctx context.Context, displayName, email string) (*User, error) {
+// normalizeEmail returns the form emails are stored and looked up in, so
+// Foo@example.com and foo@example.com are the same user.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (c *DynamoDBClient) CreateUser(ctx context.Context, displayName, email string) (_ *User, err error) {
+	ctx, done := observe(ctx, "CreateUser", tracing.ItemTypeKey.String("User"), tracing.KeyPathPrefixKey.String("USER#"))
+	defer done(&err)
 	if displayName == "" {
 		return nil, fmt.Errorf("display name cannot be empty")
 	}
+	email = normalizeEmail(email)
 	if email == "" {
 		return nil, fmt.Errorf("email cannot be empty")
 	}
@@ -139,10 +357,13 @@ func (c *DynamoDBClient) CreateUser(ctx context.Context, displayName, email stri
 		return nil, fmt.Errorf("invalid email format")
 	}
 
+	now := nowUTC()
 	user := &User{
-		ID:          uuid.New(),
-		DisplayName: displayName,
-		Email:       email,
+		ID:           uuid.New(),
+		DisplayName:  displayName,
+		Email:        email,
+		CreatedAt:    now,
+		LastModified: now,
 	}
 
 	// Create the main user record
@@ -181,7 +402,7 @@ func (c *DynamoDBClient) CreateUser(ctx context.Context, displayName, email stri
 		if errors.As(err, &txErr) {
 			for _, reason := range txErr.CancellationReasons {
 				if reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
-					return nil, fmt.Errorf("email %s is already in use", email)
+					return nil, ErrEmailTaken
 				}
 			}
 		}
@@ -191,14 +412,191 @@ func (c *DynamoDBClient) CreateUser(ctx context.Context, displayName, email stri
 	return user, nil
 }
 
-func (c *DynamoDBClient) CreateResource(ctx context.Context, name string) (*Resource, error) {
+// UpdateUserEmail changes a user's email. The user record, the old EMAIL#
+// copy and the new one are written in one transaction, which only succeeds if
+// nobody has the new email and the user's email hasn't changed since it was
+// read.
+func (c *DynamoDBClient) UpdateUserEmail(ctx context.Context, userID uuid.UUID, email string) (_ *User, err error) {
+	ctx, done := observe(ctx, "UpdateUserEmail", tracing.ItemTypeKey.String("User"), tracing.KeyPathPrefixKey.String("USER#"))
+	defer done(&err)
+	email = normalizeEmail(email)
+	if email == "" {
+		return nil, fmt.Errorf("email cannot be empty")
+	}
+	if !emailRegex.MatchString(email) {
+		return nil, fmt.Errorf("invalid email format")
+	}
+
+	userKey := map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("USER#%s", userID.String())},
+		"SK": &types.AttributeValueMemberS{Value: "METADATA"},
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.table),
+		Key:       userKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if result.Item == nil {
+		return nil, ErrUserNotFound
+	}
+	var user User
+	if err := attributevalue.UnmarshalMap(result.Item, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	if user.Email == email {
+		return &user, nil
+	}
+
+	oldEmail := user.Email
+	user.Email = email
+	user.LastModified = nowUTC()
+	if err := c.moveUserEmail(ctx, &user, oldEmail); err != nil {
+		if errors.Is(err, errUserChanged) {
+			return nil, fmt.Errorf("user %s was changed while updating their email, try again", userID)
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// errUserChanged is returned by moveUserEmail when the user's email isn't
+// the one it was read with any more.
+var errUserChanged = errors.New("user was changed since it was read")
+
+// moveUserEmail writes user, whose email has been changed from oldEmail, and
+// moves its EMAIL# copy to the new email, in one transaction. It fails with
+// ErrEmailTaken if somebody already has the new email, and errUserChanged if
+// the stored user's email isn't oldEmail any more.
+func (c *DynamoDBClient) moveUserEmail(ctx context.Context, user *User, oldEmail string) error {
+	userAV, err := attributevalue.MarshalMap(user)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
+	emailAV := maps.Clone(userAV)
+	userAV["PK"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("USER#%s", user.ID.String())}
+	userAV["SK"] = &types.AttributeValueMemberS{Value: "METADATA"}
+	emailAV["PK"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("EMAIL#%s", user.Email)}
+	emailAV["SK"] = &types.AttributeValueMemberS{Value: "METADATA"}
+
+	_, err = c.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:                aws.String(c.table),
+					Item:                     userAV,
+					ConditionExpression:      aws.String("#email = :old"),
+					ExpressionAttributeNames: map[string]string{"#email": "email"},
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":old": &types.AttributeValueMemberS{Value: oldEmail},
+					},
+				},
+			},
+			{
+				Delete: &types.Delete{
+					TableName: aws.String(c.table),
+					Key: map[string]types.AttributeValue{
+						"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("EMAIL#%s", oldEmail)},
+						"SK": &types.AttributeValueMemberS{Value: "METADATA"},
+					},
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName:           aws.String(c.table),
+					Item:                emailAV,
+					ConditionExpression: aws.String("attribute_not_exists(PK)"),
+				},
+			},
+		},
+	})
+
+	if err != nil {
+		var txErr *types.TransactionCanceledException
+		if errors.As(err, &txErr) && len(txErr.CancellationReasons) == 3 {
+			if code := txErr.CancellationReasons[2].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return ErrEmailTaken
+			}
+			if code := txErr.CancellationReasons[0].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return errUserChanged
+			}
+		}
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	return nil
+}
+
+// NormalizeUserEmails lowercases the emails of users created before emails
+// were normalized, moving their EMAIL# copies along with them, so that the
+// EMAIL# items enforce uniqueness regardless of case. A user whose
+// normalized email somebody else already has keeps the email they had, and is
+// returned in conflicts so one of them can be given a different email. It's
+// safe to run more than once, and alongside the server, and returns how many
+// users it updated.
+func (c *DynamoDBClient) NormalizeUserEmails(ctx context.Context) (normalized int, conflicts []*User, err error) {
+	ctx, done := observe(ctx, "NormalizeUserEmails", tracing.ItemTypeKey.String("User"), tracing.KeyPathPrefixKey.String("USER#"))
+	defer done(&err)
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := c.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:        aws.String(c.table),
+			FilterExpression: aws.String("begins_with(PK, :prefix)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":prefix": &types.AttributeValueMemberS{Value: "USER#"},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return normalized, conflicts, fmt.Errorf("failed to scan users: %w", err)
+		}
+
+		for _, item := range result.Items {
+			var user User
+			if err := attributevalue.UnmarshalMap(item, &user); err != nil {
+				return normalized, conflicts, fmt.Errorf("failed to unmarshal user: %w", err)
+			}
+			oldEmail := user.Email
+			if normalizeEmail(oldEmail) == oldEmail {
+				continue
+			}
+			user.Email = normalizeEmail(oldEmail)
+			user.LastModified = nowUTC()
+			err := c.moveUserEmail(ctx, &user, oldEmail)
+			switch {
+			case errors.Is(err, ErrEmailTaken):
+				user.Email = oldEmail
+				conflicts = append(conflicts, &user)
+			case errors.Is(err, errUserChanged):
+				// Its email was changed in the meantime, which normalized it.
+			case err != nil:
+				return normalized, conflicts, fmt.Errorf("failed to normalize the email of user %s: %w", user.ID, err)
+			default:
+				normalized++
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			tracing.SetResultCount(ctx, normalized)
+			return normalized, conflicts, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+func (c *DynamoDBClient) CreateResource(ctx context.Context, name string) (_ *Resource, err error) {
+	ctx, done := observe(ctx, "CreateResource", tracing.ItemTypeKey.String("Resource"), tracing.KeyPathPrefixKey.String("RESOURCE#"))
+	defer done(&err)
 	if name == "" {
 		return nil, fmt.Errorf("name cannot be empty")
 	}
 
+	now := nowUTC()
 	resource := &Resource{
-		ID:   uuid.New(),
-		Name: name,
+		ID:           uuid.New(),
+		Name:         name,
+		CreatedAt:    now,
+		LastModified: now,
 	}
 
 	av, err := attributevalue.MarshalMap(resource)
@@ -221,7 +619,35 @@ func (c *DynamoDBClient) CreateResource(ctx context.Context, name string) (*Reso
 	return resource, nil
 }
 
-func (c *DynamoDBClient) CreateLease(ctx context.Context, userID, resourceID uuid.UUID, reason string, duration time.Duration) (*Lease, error) {
+// CreateLease creates a lease. Pass uuid.Nil as the approver to leave the
+// lease waiting for approval.
+func (c *DynamoDBClient) CreateLease(ctx context.Context, userID, resourceID uuid.UUID, reason string, duration time.Duration, approver uuid.UUID) (_ *Lease, err error) {
+	ctx, done := observe(ctx, "CreateLease", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("LEASE#"))
+	defer done(&err)
+	lease, err := newLease(userID, resourceID, reason, duration, approver, nowUTC())
+	if err != nil {
+		return nil, err
+	}
+	av, err := leaseItem(lease)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.table),
+		Item:      av,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lease: %w", err)
+	}
+
+	return lease, nil
+}
+
+// newLease checks a lease's fields and returns it with a new ID, created at
+// now.
+func newLease(userID, resourceID uuid.UUID, reason string, duration time.Duration, approver uuid.UUID, now time.Time) (*Lease, error) {
 	if userID == uuid.Nil {
 		return nil, fmt.Errorf("user ID cannot be empty")
 	}
@@ -235,16 +661,25 @@ func (c *DynamoDBClient) CreateLease(ctx context.Context, userID, resourceID uui
 		return nil, fmt.Errorf("duration must be positive")
 	}
 
-	now := time.Now()
-	lease := &Lease{
-		ID:       uuid.New(),
-		UserId:   userID,
-		ResId:    resourceID,
-		Reason:   reason,
-		Duration: duration,
-		TTL:      now.Add(duration).Unix(), // Set TTL to creation time + duration
+	if approver == userID {
+		return nil, ErrSelfApproval
 	}
 
+	return &Lease{
+		ID:           uuid.New(),
+		UserId:       userID,
+		ResId:        resourceID,
+		Reason:       reason,
+		Duration:     duration,
+		TTL:          now.Add(duration).Unix(), // Set TTL to creation time + duration
+		Approver:     approver,
+		CreatedAt:    now,
+		LastModified: now,
+	}, nil
+}
+
+// leaseItem marshals a lease along with its table and index keys.
+func leaseItem(lease *Lease) (map[string]types.AttributeValue, error) {
 	av, err := attributevalue.MarshalMap(lease)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal lease: %w", err)
@@ -252,44 +687,371 @@ func (c *DynamoDBClient) CreateLease(ctx context.Context, userID, resourceID uui
 
 	av["PK"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("LEASE#%s", lease.ID.String())}
 	av["SK"] = &types.AttributeValueMemberS{Value: "METADATA"}
-	av["GSI1PK"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("USER#%s", userID.String())}
-	av["GSI1SK"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("LEASE#%s", lease.ID.String())}
-	av["GSI2PK"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("RESOURCE#%s", resourceID.String())}
-	av["GSI2SK"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("LEASE#%s", lease.ID.String())}
+	av["GSI1PK"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("USER#%s", lease.UserId.String())}
+	av["GSI2PK"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("RESOURCE#%s", lease.ResId.String())}
+	gsi1SK, gsi2SK := leaseIndexSortKeys(lease)
+	av["GSI1SK"] = &types.AttributeValueMemberS{Value: gsi1SK}
+	av["GSI2SK"] = &types.AttributeValueMemberS{Value: gsi2SK}
+	return av, nil
+}
 
-	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{
+func (c *DynamoDBClient) GetLease(ctx context.Context, leaseID uuid.UUID) (_ *Lease, err error) {
+	ctx, done := observe(ctx, "GetLease", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("LEASE#"))
+	defer done(&err)
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(c.table),
-		Item:      av,
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("LEASE#%s", leaseID.String())},
+			"SK": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create lease: %w", err)
+		return nil, fmt.Errorf("failed to get lease: %w", err)
 	}
 
-	return lease, nil
+	if result.Item == nil {
+		return nil, ErrLeaseNotFound
+	}
+
+	var lease Lease
+	if err := attributevalue.UnmarshalMap(result.Item, &lease); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lease: %w", err)
+	}
+
+	tracing.SetResultCount(ctx, 1)
+	return &lease, nil
 }
 
-func (c *DynamoDBClient) DeleteLease(ctx context.Context, leaseID uuid.UUID) error {
+// DeleteLease deletes a lease. If ifMatch isn't empty, the lease is only
+// deleted if that's still its ETag, and a missing lease is ErrLeaseNotFound.
+func (c *DynamoDBClient) DeleteLease(ctx context.Context, leaseID uuid.UUID, ifMatch string) (err error) {
+	ctx, done := observe(ctx, "DeleteLease", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("LEASE#"))
+	defer done(&err)
 	if leaseID == uuid.Nil {
 		return fmt.Errorf("lease ID cannot be empty")
 	}
 
-	_, err := c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+	input := &dynamodb.DeleteItemInput{
 		TableName: aws.String(c.table),
 		Key: map[string]types.AttributeValue{
 			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("LEASE#%s", leaseID.String())},
 			"SK": &types.AttributeValueMemberS{Value: "METADATA"},
 		},
-	})
+	}
+	if ifMatch != "" {
+		cond, names, values := etagCondition(ifMatch)
+		input.ConditionExpression = aws.String(cond)
+		input.ExpressionAttributeNames = names
+		input.ExpressionAttributeValues = values
+		input.ReturnValuesOnConditionCheckFailure = types.ReturnValuesOnConditionCheckFailureAllOld
+	}
+
+	_, err = c.client.DeleteItem(ctx, input)
 
 	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			if condErr.Item == nil {
+				return ErrLeaseNotFound
+			}
+			return ErrPreconditionFailed
+		}
 		return fmt.Errorf("failed to delete lease: %w", err)
 	}
 
 	return nil
 }
 
-func (c *DynamoDBClient) GetLeasesForUser(ctx context.Context, userID uuid.UUID) ([]*Lease, error) {
+// TouchLease extends a lease, so it expires its full duration from now. This
+// is the equivalent of Stately's fromLastModified TTL, which DynamoDB doesn't
+// have: the ttl is recomputed from last_modified on every write. If ifMatch
+// isn't empty, the lease is only extended if that's still its ETag.
+func (c *DynamoDBClient) TouchLease(ctx context.Context, leaseID uuid.UUID, ifMatch string) (_ *Lease, err error) {
+	ctx, done := observe(ctx, "TouchLease", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("LEASE#"))
+	defer done(&err)
+	return c.updateLease(ctx, leaseID, ifMatch, nil)
+}
+
+// ApproveLease records approver as having approved the lease. As with
+// schema-v2, approving resets the lease's ttl, so the full duration starts
+// from the approval.
+func (c *DynamoDBClient) ApproveLease(ctx context.Context, leaseID, approver uuid.UUID, ifMatch string) (_ *Lease, err error) {
+	ctx, done := observe(ctx, "ApproveLease", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("LEASE#"))
+	defer done(&err)
+	if approver == uuid.Nil {
+		return nil, fmt.Errorf("approver cannot be empty")
+	}
+	return c.updateLease(ctx, leaseID, ifMatch, func(lease *Lease) error {
+		if approver == lease.UserId {
+			return ErrSelfApproval
+		}
+		lease.Approver = approver
+		return nil
+	})
+}
+
+// updateLease reads the lease for its duration, then applies update (if any)
+// and restarts the lease's ttl in a single UpdateItem. Durations never change,
+// so racing updates without an ifMatch all land on about the same ttl.
+func (c *DynamoDBClient) updateLease(ctx context.Context, leaseID uuid.UUID, ifMatch string, update func(*Lease) error) (*Lease, error) {
+	lease, err := c.GetLease(ctx, leaseID)
+	if err != nil {
+		return nil, err
+	}
+	now := nowUTC()
+	if leaseExpired(lease, now) {
+		return nil, ErrLeaseNotFound
+	}
+	if ifMatch != "" && LeaseETag(lease) != ifMatch {
+		return nil, ErrPreconditionFailed
+	}
+	if update != nil {
+		if err := update(lease); err != nil {
+			return nil, err
+		}
+	}
+
+	lastModified, err := attributevalue.Marshal(now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal time: %w", err)
+	}
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.table),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("LEASE#%s", leaseID.String())},
+			"SK": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression:         aws.String("SET #ttl = :ttl, #lm = :now"),
+		ConditionExpression:      aws.String(unexpiredCondition),
+		ExpressionAttributeNames: map[string]string{"#ttl": "ttl", "#lm": "last_modified"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ttl":   &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(lease.Duration).Unix(), 10)},
+			":now":   lastModified,
+			":epoch": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+		ReturnValues:                        types.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	if ifMatch != "" {
+		cond, names, values := etagCondition(ifMatch)
+		input.ConditionExpression = aws.String(cond + " AND #ttl > :epoch")
+		maps.Copy(input.ExpressionAttributeNames, names)
+		maps.Copy(input.ExpressionAttributeValues, values)
+	}
+	if lease.Approver != uuid.Nil {
+		approver, err := attributevalue.Marshal(lease.Approver)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal approver: %w", err)
+		}
+		input.UpdateExpression = aws.String(*input.UpdateExpression + ", approver = :approver")
+		input.ExpressionAttributeValues[":approver"] = approver
+	}
+
+	result, err := c.client.UpdateItem(ctx, input)
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			var current Lease
+			if condErr.Item == nil || attributevalue.UnmarshalMap(condErr.Item, &current) != nil || leaseExpired(&current, now) {
+				return nil, ErrLeaseNotFound
+			}
+			return nil, ErrPreconditionFailed
+		}
+		return nil, fmt.Errorf("failed to update lease: %w", err)
+	}
+
+	var updated Lease
+	if err := attributevalue.UnmarshalMap(result.Attributes, &updated); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lease: %w", err)
+	}
+	return &updated, nil
+}
+
+// CreateLeaseBundle creates a lease on each resource for userID, with one
+// TransactWriteItems so that either every lease is created or none are. The
+// leases share a BundleID, which ApproveLeaseBundle approves them all by.
+// Pass uuid.Nil as the approver to leave them waiting for approval.
+func (c *DynamoDBClient) CreateLeaseBundle(ctx context.Context, userID uuid.UUID, resourceIDs []uuid.UUID, reason string, duration time.Duration, approver uuid.UUID) (_ []*Lease, err error) {
+	ctx, done := observe(ctx, "CreateLeaseBundle", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("LEASE#"))
+	defer done(&err)
+	if len(resourceIDs) == 0 || len(resourceIDs) > MaxBundleLeases {
+		return nil, fmt.Errorf("a bundle needs between 1 and %d resources", MaxBundleLeases)
+	}
+
+	now := nowUTC()
+	bundle := &Bundle{ID: uuid.New(), CreatedAt: now}
+	var leases []*Lease
+	var items []types.TransactWriteItem
+	for _, resourceID := range resourceIDs {
+		lease, err := newLease(userID, resourceID, reason, duration, approver, now)
+		if err != nil {
+			return nil, err
+		}
+		lease.BundleID = bundle.ID
+		av, err := leaseItem(lease)
+		if err != nil {
+			return nil, err
+		}
+		leases = append(leases, lease)
+		bundle.LeaseIDs = append(bundle.LeaseIDs, lease.ID)
+		bundle.TTL = lease.TTL
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(c.table),
+				Item:                av,
+				ConditionExpression: aws.String("attribute_not_exists(PK)"),
+			},
+		})
+	}
+
+	bundleAV, err := attributevalue.MarshalMap(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bundle: %w", err)
+	}
+	bundleAV["PK"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("BUNDLE#%s", bundle.ID.String())}
+	bundleAV["SK"] = &types.AttributeValueMemberS{Value: "METADATA"}
+	items = append(items, types.TransactWriteItem{
+		Put: &types.Put{
+			TableName:           aws.String(c.table),
+			Item:                bundleAV,
+			ConditionExpression: aws.String("attribute_not_exists(PK)"),
+		},
+	})
+
+	_, err = c.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lease bundle: %w", err)
+	}
+
+	tracing.SetResultCount(ctx, len(leases))
+	return leases, nil
+}
+
+// ApproveLeaseBundle records approver as having approved every lease in the
+// bundle, in one TransactWriteItems. As with ApproveLease, approving resets
+// the leases' ttls. Leases that have been deleted or have expired since the
+// bundle was created are left out.
+func (c *DynamoDBClient) ApproveLeaseBundle(ctx context.Context, bundleID, approver uuid.UUID) (_ []*Lease, err error) {
+	ctx, done := observe(ctx, "ApproveLeaseBundle", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("BUNDLE#"))
+	defer done(&err)
+	if approver == uuid.Nil {
+		return nil, fmt.Errorf("approver cannot be empty")
+	}
+
+	bundleKey := map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("BUNDLE#%s", bundleID.String())},
+		"SK": &types.AttributeValueMemberS{Value: "METADATA"},
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.table),
+		Key:       bundleKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lease bundle: %w", err)
+	}
+	if result.Item == nil {
+		return nil, ErrBundleNotFound
+	}
+	var bundle Bundle
+	if err := attributevalue.UnmarshalMap(result.Item, &bundle); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lease bundle: %w", err)
+	}
+
+	now := nowUTC()
+	lastModified, err := attributevalue.Marshal(now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal time: %w", err)
+	}
+	approverAV, err := attributevalue.Marshal(approver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal approver: %w", err)
+	}
+	var leases []*Lease
+	var items []types.TransactWriteItem
+	for _, leaseID := range bundle.LeaseIDs {
+		lease, err := c.GetLease(ctx, leaseID)
+		if errors.Is(err, ErrLeaseNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if leaseExpired(lease, now) {
+			continue
+		}
+		if approver == lease.UserId {
+			return nil, ErrSelfApproval
+		}
+		lease.Approver = approver
+		lease.TTL = now.Add(lease.Duration).Unix()
+		lease.LastModified = now
+		leases = append(leases, lease)
+		items = append(items, types.TransactWriteItem{
+			Update: &types.Update{
+				TableName: aws.String(c.table),
+				Key: map[string]types.AttributeValue{
+					"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("LEASE#%s", leaseID.String())},
+					"SK": &types.AttributeValueMemberS{Value: "METADATA"},
+				},
+				UpdateExpression:         aws.String("SET #ttl = :ttl, #lm = :now, approver = :approver"),
+				ConditionExpression:      aws.String(unexpiredCondition),
+				ExpressionAttributeNames: map[string]string{"#ttl": "ttl", "#lm": "last_modified"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":ttl":      &types.AttributeValueMemberN{Value: strconv.FormatInt(lease.TTL, 10)},
+					":now":      lastModified,
+					":epoch":    &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+					":approver": approverAV,
+				},
+			},
+		})
+		bundle.TTL = max(bundle.TTL, lease.TTL)
+	}
+	if len(leases) == 0 {
+		return nil, ErrLeaseNotFound
+	}
+	items = append(items, types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:                aws.String(c.table),
+			Key:                      bundleKey,
+			UpdateExpression:         aws.String("SET #ttl = :ttl"),
+			ConditionExpression:      aws.String("attribute_exists(PK)"),
+			ExpressionAttributeNames: map[string]string{"#ttl": "ttl"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":ttl": &types.AttributeValueMemberN{Value: strconv.FormatInt(bundle.TTL, 10)},
+			},
+		},
+	})
+
+	_, err = c.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		// Every lease's condition only fails if it's been deleted or has
+		// expired since we read it, and the bundle's if it's been deleted.
+		var txErr *types.TransactionCanceledException
+		if errors.As(err, &txErr) && len(txErr.CancellationReasons) == len(items) {
+			failed := func(i int) bool {
+				code := txErr.CancellationReasons[i].Code
+				return code != nil && *code == "ConditionalCheckFailed"
+			}
+			if failed(len(items) - 1) {
+				return nil, ErrBundleNotFound
+			}
+			for i := range leases {
+				if failed(i) {
+					return nil, ErrLeaseNotFound
+				}
+			}
+		}
+		return nil, fmt.Errorf("failed to approve lease bundle: %w", err)
+	}
+
+	tracing.SetResultCount(ctx, len(leases))
+	return leases, nil
+}
+
+func (c *DynamoDBClient) GetLeasesForUser(ctx context.Context, userID uuid.UUID) (_ []*Lease, err error) {
+	ctx, done := observe(ctx, "GetLeasesForUser", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("GSI1:USER#"))
+	defer done(&err)
 	if userID == uuid.Nil {
 		return nil, fmt.Errorf("user ID cannot be empty")
 	}
@@ -309,25 +1071,21 @@ func (c *DynamoDBClient) GetLeasesForUser(ctx context.Context, userID uuid.UUID)
 
 	leases := make([]*Lease, 0)
 	for _, item := range result.Items {
-		var leaseData map[string]types.AttributeValue
-		if v, ok := item["LeaseData"]; ok {
-			if m, ok := v.(*types.AttributeValueMemberM); ok {
-				leaseData = m.Value
-			}
-		}
-
 		var lease Lease
-		err = attributevalue.UnmarshalMap(leaseData, &lease)
+		err = attributevalue.UnmarshalMap(item, &lease)
 		if err != nil {
 			return nil, fmt.Errorf("failed to unmarshal lease: %w", err)
 		}
 		leases = append(leases, &lease)
 	}
 
+	tracing.SetResultCount(ctx, len(leases))
 	return leases, nil
 }
 
-func (c *DynamoDBClient) GetLeasesForResource(ctx context.Context, resourceID uuid.UUID) ([]*Lease, error) {
+func (c *DynamoDBClient) GetLeasesForResource(ctx context.Context, resourceID uuid.UUID) (_ []*Lease, err error) {
+	ctx, done := observe(ctx, "GetLeasesForResource", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("GSI2:RESOURCE#"))
+	defer done(&err)
 	if resourceID == uuid.Nil {
 		return nil, fmt.Errorf("resource ID cannot be empty")
 	}
@@ -347,15 +1105,54 @@ func (c *DynamoDBClient) GetLeasesForResource(ctx context.Context, resourceID uu
 
 	leases := make([]*Lease, 0)
 	for _, item := range result.Items {
-		var leaseData map[string]types.AttributeValue
-		if v, ok := item["LeaseData"]; ok {
-			if m, ok := v.(*types.AttributeValueMemberM); ok {
-				leaseData = m.Value
-			}
+		var lease Lease
+		err = attributevalue.UnmarshalMap(item, &lease)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal lease: %w", err)
 		}
 
+		// Skip expired leases
+		if lease.TTL <= time.Now().Unix() {
+			continue
+		}
+
+		leases = append(leases, &lease)
+	}
+
+	tracing.SetResultCount(ctx, len(leases))
+	return leases, nil
+}
+
+// GetLeasesForUserAndResource returns the user's unexpired leases on the
+// resource, with a single Query on GSI1.
+func (c *DynamoDBClient) GetLeasesForUserAndResource(ctx context.Context, userID, resourceID uuid.UUID) (_ []*Lease, err error) {
+	ctx, done := observe(ctx, "GetLeasesForUserAndResource", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("GSI1:USER#"))
+	defer done(&err)
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID cannot be empty")
+	}
+	if resourceID == uuid.Nil {
+		return nil, fmt.Errorf("resource ID cannot be empty")
+	}
+
+	result, err := c.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(c.table),
+		IndexName:              aws.String("GSI1"),
+		KeyConditionExpression: aws.String("GSI1PK = :pk AND begins_with(GSI1SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("USER#%s", userID.String())},
+			":sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("RESOURCE#%s#LEASE#", resourceID.String())},
+		},
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query leases: %w", err)
+	}
+
+	leases := make([]*Lease, 0)
+	for _, item := range result.Items {
 		var lease Lease
-		err = attributevalue.UnmarshalMap(leaseData, &lease)
+		err = attributevalue.UnmarshalMap(item, &lease)
 		if err != nil {
 			return nil, fmt.Errorf("failed to unmarshal lease: %w", err)
 		}
@@ -368,10 +1165,13 @@ func (c *DynamoDBClient) GetLeasesForResource(ctx context.Context, resourceID uu
 		leases = append(leases, &lease)
 	}
 
+	tracing.SetResultCount(ctx, len(leases))
 	return leases, nil
 }
 
-func (c *DynamoDBClient) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+func (c *DynamoDBClient) GetUserByEmail(ctx context.Context, email string) (_ *User, err error) {
+	ctx, done := observe(ctx, "GetUserByEmail", tracing.ItemTypeKey.String("User"), tracing.KeyPathPrefixKey.String("EMAIL#"))
+	defer done(&err)
 	if email == "" {
 		return nil, fmt.Errorf("email cannot be empty")
 	}
@@ -379,26 +1179,263 @@ func (c *DynamoDBClient) GetUserByEmail(ctx context.Context, email string) (*Use
 		return nil, fmt.Errorf("invalid email format")
 	}
 
-	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(c.table),
-		Key: map[string]types.AttributeValue{
-			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("EMAIL#%s", email)},
-			"SK": &types.AttributeValueMemberS{Value: "METADATA"},
-		},
-	})
+	// Users created before emails were normalized are stored under the
+	// email exactly as it was given.
+	for _, e := range []string{normalizeEmail(email), email} {
+		result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(c.table),
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("EMAIL#%s", e)},
+				"SK": &types.AttributeValueMemberS{Value: "METADATA"},
+			},
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+
+		if result.Item == nil {
+			continue
+		}
+
+		var user User
+		if err := attributevalue.UnmarshalMap(result.Item, &user); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+		}
+
+		tracing.SetResultCount(ctx, 1)
+		return &user, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+// ListLeases scans the table for every lease, including ones whose ttl has
+// passed but that DynamoDB hasn't gotten around to deleting yet.
+func (c *DynamoDBClient) ListLeases(ctx context.Context) (_ []*Lease, err error) {
+	ctx, done := observe(ctx, "ListLeases", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("LEASE#"))
+	defer done(&err)
+	leases := make([]*Lease, 0)
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := c.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:        aws.String(c.table),
+			FilterExpression: aws.String("begins_with(PK, :prefix)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":prefix": &types.AttributeValueMemberS{Value: "LEASE#"},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan leases: %w", err)
+		}
+
+		for _, item := range result.Items {
+			var lease Lease
+			if err := attributevalue.UnmarshalMap(item, &lease); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal lease: %w", err)
+			}
+			leases = append(leases, &lease)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			tracing.SetResultCount(ctx, len(leases))
+			return leases, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// leaseIndexSortKeys returns the lease's GSI1SK and GSI2SK. Each starts with
+// the side of the lease that isn't the index's partition key, so that the
+// leases between a user and a resource are a prefix of either partition.
+func leaseIndexSortKeys(lease *Lease) (gsi1SK, gsi2SK string) {
+	gsi1SK = fmt.Sprintf("RESOURCE#%s#LEASE#%s", lease.ResId.String(), lease.ID.String())
+	gsi2SK = fmt.Sprintf("USER#%s#LEASE#%s", lease.UserId.String(), lease.ID.String())
+	return gsi1SK, gsi2SK
+}
+
+// BackfillLeaseIndexKeys rewrites the GSI sort keys of leases written in the
+// old LEASE#{id} format, and returns how many it updated. It's safe to run
+// more than once, and alongside the server: each update is conditional on the
+// old key still being there, so leases that were deleted (or already
+// rewritten) in the meantime are skipped.
+func (c *DynamoDBClient) BackfillLeaseIndexKeys(ctx context.Context) (_ int, err error) {
+	ctx, done := observe(ctx, "BackfillLeaseIndexKeys", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("LEASE#"))
+	defer done(&err)
+	updated := 0
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := c.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:        aws.String(c.table),
+			FilterExpression: aws.String("begins_with(PK, :prefix) AND begins_with(GSI1SK, :prefix)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":prefix": &types.AttributeValueMemberS{Value: "LEASE#"},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return updated, fmt.Errorf("failed to scan leases: %w", err)
+		}
+
+		for _, item := range result.Items {
+			var lease Lease
+			if err := attributevalue.UnmarshalMap(item, &lease); err != nil {
+				return updated, fmt.Errorf("failed to unmarshal lease: %w", err)
+			}
+			gsi1SK, gsi2SK := leaseIndexSortKeys(&lease)
+			_, err := c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(c.table),
+				Key: map[string]types.AttributeValue{
+					"PK": item["PK"],
+					"SK": item["SK"],
+				},
+				UpdateExpression:    aws.String("SET GSI1SK = :gsi1sk, GSI2SK = :gsi2sk"),
+				ConditionExpression: aws.String("GSI1SK = :old"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":gsi1sk": &types.AttributeValueMemberS{Value: gsi1SK},
+					":gsi2sk": &types.AttributeValueMemberS{Value: gsi2SK},
+					":old":    item["GSI1SK"],
+				},
+			})
+			if err != nil {
+				var condErr *types.ConditionalCheckFailedException
+				if errors.As(err, &condErr) {
+					continue
+				}
+				return updated, fmt.Errorf("failed to update lease %s: %w", lease.ID, err)
+			}
+			updated++
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			tracing.SetResultCount(ctx, updated)
+			return updated, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
 
+// DeleteExpiredLeases deletes every lease whose ttl is at or before now and
+// returns the leases it deleted. DynamoDB's own TTL process can take up to 48
+// hours to remove expired items, so this keeps expired leases from lingering.
+func (c *DynamoDBClient) DeleteExpiredLeases(ctx context.Context, now time.Time) (_ []*Lease, err error) {
+	ctx, done := observe(ctx, "DeleteExpiredLeases", tracing.ItemTypeKey.String("Lease"), tracing.KeyPathPrefixKey.String("LEASE#"))
+	defer done(&err)
+	leases, err := c.ListLeases(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, err
 	}
 
-	if result.Item == nil {
-		return nil, fmt.Errorf("user not found")
+	deleted := make([]*Lease, 0)
+	for _, lease := range leases {
+		if !leaseExpired(lease, now) {
+			continue
+		}
+
+		// The condition makes sure we don't delete a lease that was extended
+		// after we scanned it. A lease without a ttl never expires.
+		_, err := c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(c.table),
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("LEASE#%s", lease.ID.String())},
+				"SK": &types.AttributeValueMemberS{Value: "METADATA"},
+			},
+			ConditionExpression:      aws.String("#ttl > :zero AND #ttl <= :now"),
+			ExpressionAttributeNames: map[string]string{"#ttl": "ttl"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":zero": &types.AttributeValueMemberN{Value: "0"},
+				":now":  &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			},
+		})
+		if err != nil {
+			var condErr *types.ConditionalCheckFailedException
+			if errors.As(err, &condErr) {
+				continue
+			}
+			return deleted, fmt.Errorf("failed to delete expired lease: %w", err)
+		}
+		deleted = append(deleted, lease)
 	}
 
-	var user User
-	if err := attributevalue.UnmarshalMap(result.Item, &user); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	tracing.SetResultCount(ctx, len(deleted))
+	return deleted, nil
+}
+
+// Cursor marks a position in a table scan, so a scan can be resumed later
+// (e.g. by a restarted migration). It's the PK/SK of the last item read.
+type Cursor struct {
+	PK string `json:"pk"`
+	SK string `json:"sk"`
+}
+
+// Page is one page of a full table scan. EMAIL# lookup records are copies of
+// the user records, so they're left out.
+type Page struct {
+	Users     []*User
+	Resources []*Resource
+	Leases    []*Lease
+	// Next is where the following page starts, or nil if this was the last.
+	Next *Cursor
+}
+
+// ScanPage reads up to limit items from the table, starting after the cursor
+// (or at the beginning if it's nil).
+func (c *DynamoDBClient) ScanPage(ctx context.Context, after *Cursor, limit int32) (_ *Page, err error) {
+	ctx, done := observe(ctx, "ScanPage")
+	defer done(&err)
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(c.table),
+		Limit:     aws.Int32(limit),
+	}
+	if after != nil {
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: after.PK},
+			"SK": &types.AttributeValueMemberS{Value: after.SK},
+		}
 	}
 
-	return &user, nil
+	result, err := c.client.Scan(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan table: %w", err)
+	}
+
+	page := &Page{}
+	for _, item := range result.Items {
+		pk, _ := item["PK"].(*types.AttributeValueMemberS)
+		if pk == nil {
+			continue
+		}
+		prefix, _, _ := strings.Cut(pk.Value, "#")
+		switch prefix {
+		case "USER":
+			var user User
+			if err := attributevalue.UnmarshalMap(item, &user); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+			}
+			page.Users = append(page.Users, &user)
+		case "RESOURCE":
+			var resource Resource
+			if err := attributevalue.UnmarshalMap(item, &resource); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal resource: %w", err)
+			}
+			page.Resources = append(page.Resources, &resource)
+		case "LEASE":
+			var lease Lease
+			if err := attributevalue.UnmarshalMap(item, &lease); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal lease: %w", err)
+			}
+			page.Leases = append(page.Leases, &lease)
+		}
+	}
+
+	if len(result.LastEvaluatedKey) > 0 {
+		pk, _ := result.LastEvaluatedKey["PK"].(*types.AttributeValueMemberS)
+		sk, _ := result.LastEvaluatedKey["SK"].(*types.AttributeValueMemberS)
+		if pk == nil || sk == nil {
+			return nil, fmt.Errorf("unexpected scan key %v", result.LastEvaluatedKey)
+		}
+		page.Next = &Cursor{PK: pk.Value, SK: sk.Value}
+	}
+	tracing.SetResultCount(ctx, len(page.Users)+len(page.Resources)+len(page.Leases))
+	return page, nil
 }
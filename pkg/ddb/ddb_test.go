@@ -0,0 +1,599 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// newTestClient returns a client for a new, empty table. The table is made in
+// DynamoDB Local if DDB_TEST_ENDPOINT is set (e.g. http://localhost:8000),
+// and in an in-process fake otherwise.
+func newTestClient(t *testing.T) *DynamoDBClient {
+	t.Helper()
+	ctx := context.Background()
+	endpoint := os.Getenv("DDB_TEST_ENDPOINT")
+	if endpoint == "" {
+		srv := httptest.NewServer(newFakeDynamoDB())
+		t.Cleanup(srv.Close)
+		endpoint = srv.URL
+	}
+
+	c, err := NewDynamoDBClient(ctx, "demo-w-test-"+uuid.NewString(),
+		WithEndpoint(endpoint),
+		WithRegion("us-east-1"),
+		WithStaticCredentials("test", "test"),
+	)
+	if err != nil {
+		t.Fatalf("NewDynamoDBClient: %v", err)
+	}
+	if err := c.CreateTable(ctx); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+	t.Cleanup(func() {
+		c.client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(c.table)})
+	})
+	return c
+}
+
+func TestPing(t *testing.T) {
+	c := newTestClient(t)
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+}
+
+func TestCreateTableTwice(t *testing.T) {
+	c := newTestClient(t)
+	if err := c.CreateTable(context.Background()); err == nil {
+		t.Fatal("CreateTable on an existing table succeeded")
+	}
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	user, err := c.CreateUser(ctx, "Ada", "ada@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	got, err := c.GetUserByEmail(ctx, "ada@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if *got != *user {
+		t.Errorf("GetUserByEmail = %+v, want %+v", got, user)
+	}
+
+	if _, err := c.CreateUser(ctx, "Imposter", "ada@example.com"); err == nil {
+		t.Error("CreateUser with a taken email succeeded")
+	}
+	if _, err := c.GetUserByEmail(ctx, "nobody@example.com"); err == nil {
+		t.Error("GetUserByEmail for a missing user succeeded")
+	}
+	if _, err := c.CreateUser(ctx, "Bad", "not-an-email"); err == nil {
+		t.Error("CreateUser with an invalid email succeeded")
+	}
+}
+
+func TestUpdateUserEmail(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	ada, err := c.CreateUser(ctx, "Ada", "Ada@Example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if ada.Email != "ada@example.com" {
+		t.Errorf("CreateUser stored email %q, want it lowercased", ada.Email)
+	}
+	if _, err := c.CreateUser(ctx, "Grace", "grace@example.com"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := c.CreateUser(ctx, "Imposter", "ADA@example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("CreateUser with a taken email in another case = %v, want ErrEmailTaken", err)
+	}
+
+	updated, err := c.UpdateUserEmail(ctx, ada.ID, "Ada.Lovelace@Example.com")
+	if err != nil {
+		t.Fatalf("UpdateUserEmail: %v", err)
+	}
+	if updated.Email != "ada.lovelace@example.com" || !updated.CreatedAt.Equal(ada.CreatedAt) {
+		t.Errorf("UpdateUserEmail = %+v", updated)
+	}
+	got, err := c.GetUserByEmail(ctx, "ADA.LOVELACE@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if got.ID != ada.ID || got.Email != updated.Email {
+		t.Errorf("GetUserByEmail = %+v, want %+v", got, updated)
+	}
+	if _, err := c.GetUserByEmail(ctx, "ada@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByEmail of the old email = %v, want ErrUserNotFound", err)
+	}
+	// The old email is free again.
+	if _, err := c.CreateUser(ctx, "Another Ada", "ada@example.com"); err != nil {
+		t.Errorf("CreateUser with the old email: %v", err)
+	}
+
+	if _, err := c.UpdateUserEmail(ctx, ada.ID, "Grace@example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("UpdateUserEmail to a taken email = %v, want ErrEmailTaken", err)
+	}
+	if _, err := c.UpdateUserEmail(ctx, uuid.New(), "nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdateUserEmail of a missing user = %v, want ErrUserNotFound", err)
+	}
+}
+
+// putLegacyUser writes a user and its EMAIL# copy under email exactly as
+// given, the way users were stored before emails were normalized.
+func putLegacyUser(t *testing.T, c *DynamoDBClient, email string) *User {
+	t.Helper()
+	user := &User{ID: uuid.New(), DisplayName: "Legacy", Email: email}
+	item, err := attributevalue.MarshalMap(user)
+	if err != nil {
+		t.Fatalf("MarshalMap: %v", err)
+	}
+	for _, pk := range []string{"USER#" + user.ID.String(), "EMAIL#" + email} {
+		item["PK"] = &types.AttributeValueMemberS{Value: pk}
+		item["SK"] = &types.AttributeValueMemberS{Value: "METADATA"}
+		if _, err := c.client.PutItem(context.Background(), &dynamodb.PutItemInput{TableName: aws.String(c.table), Item: item}); err != nil {
+			t.Fatalf("PutItem: %v", err)
+		}
+	}
+	return user
+}
+
+func TestNormalizeUserEmails(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	ada := putLegacyUser(t, c, "Ada@Example.com")
+	grace := putLegacyUser(t, c, " Grace@example.com")
+	taken, err := c.CreateUser(ctx, "Alan", "alan@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	clash := putLegacyUser(t, c, "ALAN@example.com")
+
+	normalized, conflicts, err := c.NormalizeUserEmails(ctx)
+	if err != nil {
+		t.Fatalf("NormalizeUserEmails: %v", err)
+	}
+	if normalized != 2 {
+		t.Errorf("NormalizeUserEmails normalized %d, want 2", normalized)
+	}
+	if len(conflicts) != 1 || conflicts[0].ID != clash.ID || conflicts[0].Email != clash.Email {
+		t.Errorf("NormalizeUserEmails conflicts = %+v, want just %s", conflicts, clash.ID)
+	}
+
+	for _, tc := range []struct {
+		email string
+		want  uuid.UUID
+	}{
+		{"ada@example.com", ada.ID},
+		{"grace@example.com", grace.ID},
+		{"alan@example.com", taken.ID},
+		{"ALAN@example.com", taken.ID},
+	} {
+		got, err := c.GetUserByEmail(ctx, tc.email)
+		if err != nil || got.ID != tc.want {
+			t.Errorf("GetUserByEmail(%q) = %+v, %v, want %s", tc.email, got, err, tc.want)
+		}
+	}
+	// The normalized EMAIL# items now enforce uniqueness.
+	if _, err := c.CreateUser(ctx, "Imposter", "ADA@example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("CreateUser with a normalized legacy email = %v, want ErrEmailTaken", err)
+	}
+	if _, err := c.GetUserByEmail(ctx, "Ada@Example.com"); err != nil {
+		t.Errorf("GetUserByEmail in the legacy case: %v", err)
+	}
+
+	// Running it again changes nothing.
+	if normalized, conflicts, err := c.NormalizeUserEmails(ctx); err != nil || normalized != 0 || len(conflicts) != 1 {
+		t.Errorf("NormalizeUserEmails again = %d, %+v, %v", normalized, conflicts, err)
+	}
+}
+
+func TestLeaseQueries(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	user, err := c.CreateUser(ctx, "Ada", "ada@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	other, err := c.CreateUser(ctx, "Grace", "grace@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	db, err := c.CreateResource(ctx, "prod-db")
+	if err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+	lease, err := c.CreateLease(ctx, user.ID, db.ID, "on call", time.Hour, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	if _, err := c.CreateLease(ctx, other.ID, db.ID, "debugging", time.Hour, uuid.Nil); err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+
+	got, err := c.GetLease(ctx, lease.ID)
+	if err != nil {
+		t.Fatalf("GetLease: %v", err)
+	}
+	if *got != *lease {
+		t.Errorf("GetLease = %+v, want %+v", got, lease)
+	}
+	if _, err := c.GetLease(ctx, uuid.New()); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("GetLease for a missing lease = %v, want ErrLeaseNotFound", err)
+	}
+
+	userLeases, err := c.GetLeasesForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetLeasesForUser: %v", err)
+	}
+	if len(userLeases) != 1 || *userLeases[0] != *lease {
+		t.Errorf("GetLeasesForUser = %+v, want just %+v", userLeases, lease)
+	}
+
+	resourceLeases, err := c.GetLeasesForResource(ctx, db.ID)
+	if err != nil {
+		t.Fatalf("GetLeasesForResource: %v", err)
+	}
+	if len(resourceLeases) != 2 {
+		t.Errorf("GetLeasesForResource returned %d leases, want 2", len(resourceLeases))
+	}
+
+	all, err := c.ListLeases(ctx)
+	if err != nil {
+		t.Fatalf("ListLeases: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("ListLeases returned %d leases, want 2", len(all))
+	}
+}
+
+func TestDeleteLease(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	lease, err := c.CreateLease(ctx, uuid.New(), uuid.New(), "on call", time.Hour, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	if err := c.DeleteLease(ctx, lease.ID, `"1"`); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("DeleteLease with a stale ETag = %v, want ErrPreconditionFailed", err)
+	}
+	if err := c.DeleteLease(ctx, lease.ID, LeaseETag(lease)); err != nil {
+		t.Fatalf("DeleteLease: %v", err)
+	}
+	if err := c.DeleteLease(ctx, lease.ID, LeaseETag(lease)); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("DeleteLease of a deleted lease = %v, want ErrLeaseNotFound", err)
+	}
+	if _, err := c.GetLease(ctx, lease.ID); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("GetLease after delete = %v, want ErrLeaseNotFound", err)
+	}
+}
+
+func TestDeleteExpiredLeases(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	short, err := c.CreateLease(ctx, uuid.New(), uuid.New(), "quick look", time.Minute, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	long, err := c.CreateLease(ctx, uuid.New(), uuid.New(), "on call", 24*time.Hour, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	// Leases without a ttl (e.g. backfilled ones) never expire.
+	forever, err := c.CreateLease(ctx, uuid.New(), uuid.New(), "service account", time.Minute, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	expireLease(t, c, forever.ID, 0)
+
+	deleted, err := c.DeleteExpiredLeases(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteExpiredLeases: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != short.ID {
+		t.Errorf("DeleteExpiredLeases deleted %+v, want just %s", deleted, short.ID)
+	}
+	for _, lease := range []*Lease{long, forever} {
+		if _, err := c.GetLease(ctx, lease.ID); err != nil {
+			t.Errorf("GetLease of unexpired lease %s: %v", lease.ID, err)
+		}
+	}
+}
+
+func TestScanPage(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if _, err := c.CreateUser(ctx, "Ada", "ada@example.com"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := c.CreateResource(ctx, "prod-db"); err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+	for range 3 {
+		if _, err := c.CreateLease(ctx, uuid.New(), uuid.New(), "on call", time.Hour, uuid.Nil); err != nil {
+			t.Fatalf("CreateLease: %v", err)
+		}
+	}
+
+	var users, resources, leases, pages int
+	var cursor *Cursor
+	for {
+		page, err := c.ScanPage(ctx, cursor, 2)
+		if err != nil {
+			t.Fatalf("ScanPage: %v", err)
+		}
+		users += len(page.Users)
+		resources += len(page.Resources)
+		leases += len(page.Leases)
+		pages++
+		if page.Next == nil {
+			break
+		}
+		cursor = page.Next
+	}
+	// The EMAIL# copy of the user is skipped.
+	if users != 1 || resources != 1 || leases != 3 {
+		t.Errorf("ScanPage found %d users, %d resources and %d leases, want 1, 1 and 3", users, resources, leases)
+	}
+	if pages < 3 {
+		t.Errorf("ScanPage took %d pages for 6 items at 2 per page", pages)
+	}
+}
+
+func TestTouchLease(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	lease, err := c.CreateLease(ctx, uuid.New(), uuid.New(), "on call", time.Hour, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	if lease.CreatedAt.IsZero() || !lease.LastModified.Equal(lease.CreatedAt) {
+		t.Errorf("CreateLease set CreatedAt %v and LastModified %v", lease.CreatedAt, lease.LastModified)
+	}
+
+	touched, err := c.TouchLease(ctx, lease.ID, LeaseETag(lease))
+	if err != nil {
+		t.Fatalf("TouchLease: %v", err)
+	}
+	if !touched.LastModified.After(lease.LastModified) || !touched.CreatedAt.Equal(lease.CreatedAt) {
+		t.Errorf("TouchLease = %+v, want a later LastModified than %+v", touched, lease)
+	}
+	if want := touched.LastModified.Add(time.Hour).Unix(); touched.TTL != want {
+		t.Errorf("TouchLease set ttl %d, want %d", touched.TTL, want)
+	}
+	if LeaseETag(touched) == LeaseETag(lease) {
+		t.Error("TouchLease didn't change the ETag")
+	}
+
+	if _, err := c.TouchLease(ctx, lease.ID, LeaseETag(lease)); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("TouchLease with a stale ETag = %v, want ErrPreconditionFailed", err)
+	}
+	if _, err := c.TouchLease(ctx, uuid.New(), ""); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("TouchLease of a missing lease = %v, want ErrLeaseNotFound", err)
+	}
+}
+
+// expireLease moves a lease's ttl to ttl without deleting it, the way
+// DynamoDB leaves expired items around until it gets to them.
+func expireLease(t *testing.T, c *DynamoDBClient, leaseID uuid.UUID, ttl int64) {
+	t.Helper()
+	_, err := c.client.UpdateItem(context.Background(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.table),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: "LEASE#" + leaseID.String()},
+			"SK": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression:          aws.String("SET #ttl = :ttl"),
+		ExpressionAttributeNames:  map[string]string{"#ttl": "ttl"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":ttl": &types.AttributeValueMemberN{Value: strconv.FormatInt(ttl, 10)}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateItem: %v", err)
+	}
+}
+
+func TestUpdateExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	user, owner := uuid.New(), uuid.New()
+	lease, err := c.CreateLease(ctx, user, uuid.New(), "on call", time.Hour, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	past := time.Now().Add(-time.Minute).Unix()
+	expireLease(t, c, lease.ID, past)
+
+	if _, err := c.TouchLease(ctx, lease.ID, ""); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("TouchLease of an expired lease = %v, want ErrLeaseNotFound", err)
+	}
+	if _, err := c.ApproveLease(ctx, lease.ID, owner, ""); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("ApproveLease of an expired lease = %v, want ErrLeaseNotFound", err)
+	}
+	got, err := c.GetLease(ctx, lease.ID)
+	if err != nil {
+		t.Fatalf("GetLease: %v", err)
+	}
+	if got.TTL != past || got.Approver != uuid.Nil {
+		t.Errorf("expired lease was revived: %+v", got)
+	}
+}
+
+func TestApproveLease(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	user, owner := uuid.New(), uuid.New()
+	if _, err := c.CreateLease(ctx, user, uuid.New(), "on call", time.Hour, user); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("CreateLease approved by its user = %v, want ErrSelfApproval", err)
+	}
+	lease, err := c.CreateLease(ctx, user, uuid.New(), "on call", time.Hour, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	if _, err := c.ApproveLease(ctx, lease.ID, user, ""); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("ApproveLease by its user = %v, want ErrSelfApproval", err)
+	}
+	if _, err := c.ApproveLease(ctx, lease.ID, owner, LeaseETag(lease)); err != nil {
+		t.Fatalf("ApproveLease: %v", err)
+	}
+
+	leases, err := c.GetLeasesForUser(ctx, user)
+	if err != nil {
+		t.Fatalf("GetLeasesForUser: %v", err)
+	}
+	if len(leases) != 1 || leases[0].Approver != owner {
+		t.Errorf("GetLeasesForUser = %+v, want one lease approved by %s", leases, owner)
+	}
+}
+
+func TestLeaseBundle(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	user, owner := uuid.New(), uuid.New()
+	resources := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	if _, err := c.CreateLeaseBundle(ctx, user, resources, "", time.Hour, uuid.Nil); err == nil {
+		t.Error("CreateLeaseBundle without a reason succeeded")
+	}
+	if leases, err := c.ListLeases(ctx); err != nil || len(leases) != 0 {
+		t.Errorf("ListLeases after a failed bundle = %d leases, %v; want none", len(leases), err)
+	}
+
+	created, err := c.CreateLeaseBundle(ctx, user, resources, "deploy", time.Hour, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLeaseBundle: %v", err)
+	}
+	if len(created) != len(resources) {
+		t.Fatalf("CreateLeaseBundle = %d leases, want %d", len(created), len(resources))
+	}
+	bundleID := created[0].BundleID
+	for i, lease := range created {
+		if lease.BundleID != bundleID || lease.ResId != resources[i] {
+			t.Errorf("lease %d = %+v, want resource %s in bundle %s", i, lease, resources[i], bundleID)
+		}
+	}
+
+	if _, err := c.ApproveLeaseBundle(ctx, uuid.New(), owner); !errors.Is(err, ErrBundleNotFound) {
+		t.Errorf("ApproveLeaseBundle of a missing bundle = %v, want ErrBundleNotFound", err)
+	}
+	if _, err := c.ApproveLeaseBundle(ctx, bundleID, user); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("ApproveLeaseBundle by its user = %v, want ErrSelfApproval", err)
+	}
+
+	// Leases revoked from the bundle, or expired but not yet deleted, are
+	// left out of the approval.
+	if err := c.DeleteLease(ctx, created[2].ID, ""); err != nil {
+		t.Fatalf("DeleteLease: %v", err)
+	}
+	past := time.Now().Add(-time.Minute).Unix()
+	expireLease(t, c, created[1].ID, past)
+	approved, err := c.ApproveLeaseBundle(ctx, bundleID, owner)
+	if err != nil {
+		t.Fatalf("ApproveLeaseBundle: %v", err)
+	}
+	if len(approved) != 1 || approved[0].ID != created[0].ID {
+		t.Errorf("ApproveLeaseBundle = %+v, want just %s", approved, created[0].ID)
+	}
+	got, err := c.GetLease(ctx, created[0].ID)
+	if err != nil {
+		t.Fatalf("GetLease: %v", err)
+	}
+	if got.Approver != owner || got.BundleID != bundleID {
+		t.Errorf("GetLease = %+v, want it approved by %s in bundle %s", got, owner, bundleID)
+	}
+	if got, err := c.GetLease(ctx, created[1].ID); err != nil || got.TTL != past || got.Approver != uuid.Nil {
+		t.Errorf("GetLease of the expired lease = %+v, %v; want it left alone", got, err)
+	}
+}
+
+func TestGetLeasesForUserAndResource(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	user, db := uuid.New(), uuid.New()
+	lease, err := c.CreateLease(ctx, user, db, "on call", time.Hour, uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	if _, err := c.CreateLease(ctx, user, uuid.New(), "debugging", time.Hour, uuid.Nil); err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+	if _, err := c.CreateLease(ctx, uuid.New(), db, "debugging", time.Hour, uuid.Nil); err != nil {
+		t.Fatalf("CreateLease: %v", err)
+	}
+
+	// A lease written with the old GSI sort keys.
+	legacy := &Lease{ID: uuid.New(), UserId: user, ResId: db, Reason: "legacy", Duration: time.Hour, TTL: time.Now().Add(time.Hour).Unix()}
+	item, err := attributevalue.MarshalMap(legacy)
+	if err != nil {
+		t.Fatalf("MarshalMap: %v", err)
+	}
+	delete(item, "created_at")
+	delete(item, "last_modified")
+	for k, v := range map[string]string{
+		"PK":     "LEASE#" + legacy.ID.String(),
+		"SK":     "METADATA",
+		"GSI1PK": "USER#" + user.String(),
+		"GSI1SK": "LEASE#" + legacy.ID.String(),
+		"GSI2PK": "RESOURCE#" + db.String(),
+		"GSI2SK": "LEASE#" + legacy.ID.String(),
+	} {
+		item[k] = &types.AttributeValueMemberS{Value: v}
+	}
+	if _, err := c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.table), Item: item}); err != nil {
+		t.Fatalf("PutItem: %v", err)
+	}
+
+	leases, err := c.GetLeasesForUserAndResource(ctx, user, db)
+	if err != nil {
+		t.Fatalf("GetLeasesForUserAndResource: %v", err)
+	}
+	if len(leases) != 1 || leases[0].ID != lease.ID {
+		t.Errorf("GetLeasesForUserAndResource before the backfill = %+v, want just %s", leases, lease.ID)
+	}
+
+	n, err := c.BackfillLeaseIndexKeys(ctx)
+	if err != nil {
+		t.Fatalf("BackfillLeaseIndexKeys: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("BackfillLeaseIndexKeys updated %d leases, want 1", n)
+	}
+	if n, err := c.BackfillLeaseIndexKeys(ctx); err != nil || n != 0 {
+		t.Errorf("second BackfillLeaseIndexKeys = %d, %v, want 0, nil", n, err)
+	}
+
+	leases, err = c.GetLeasesForUserAndResource(ctx, user, db)
+	if err != nil {
+		t.Fatalf("GetLeasesForUserAndResource: %v", err)
+	}
+	if len(leases) != 2 {
+		t.Errorf("GetLeasesForUserAndResource after the backfill returned %d leases, want 2", len(leases))
+	}
+	if all, err := c.GetLeasesForResource(ctx, db); err != nil || len(all) != 3 {
+		t.Errorf("GetLeasesForResource = %d leases, %v, want 3", len(all), err)
+	}
+}
@@ -0,0 +1,492 @@
+package ddb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeDynamoDB is an in-process stand-in for DynamoDB that speaks enough of
+// its JSON protocol for the calls this package makes. It's served over HTTP,
+// so tests reach it through WithEndpoint exactly as they would DynamoDB Local.
+//
+// Expressions are limited to clauses joined by AND, where each clause is a
+// comparison (=, <>, <, <=, >, >=) or one of attribute_exists,
+// attribute_not_exists and begins_with. Items are never expired by TTL, which
+// matches DynamoDB's habit of leaving them around for a while.
+type fakeDynamoDB struct {
+	mu     sync.Mutex
+	tables map[string]*fakeTable
+}
+
+type fakeTable struct {
+	hash, rng string
+	// indexes maps a GSI name to its hash and range attributes.
+	indexes map[string][2]string
+	ttl     string
+	items   map[string]fakeItem
+}
+
+// fakeItem is an item in DynamoDB's JSON encoding, e.g. {"PK": {"S": "..."}}.
+type fakeItem map[string]map[string]any
+
+type fakeError struct {
+	code    string
+	message string
+	extra   map[string]any
+}
+
+func newFakeDynamoDB() *fakeDynamoDB {
+	return &fakeDynamoDB{tables: map[string]*fakeTable{}}
+}
+
+// fakeRequest has the fields of every request the fake handles.
+type fakeRequest struct {
+	TableName                           string
+	Item                                fakeItem
+	Key                                 fakeItem
+	ConditionExpression                 string
+	UpdateExpression                    string
+	ReturnValues                        string
+	KeyConditionExpression              string
+	FilterExpression                    string
+	ExpressionAttributeNames            map[string]string
+	ExpressionAttributeValues           fakeItem
+	ReturnValuesOnConditionCheckFailure string
+	IndexName                           string
+	Limit                               int
+	ExclusiveStartKey                   fakeItem
+	KeySchema                           []struct{ AttributeName, KeyType string }
+	GlobalSecondaryIndexes              []struct {
+		IndexName string
+		KeySchema []struct{ AttributeName, KeyType string }
+	}
+	TimeToLiveSpecification struct {
+		AttributeName string
+		Enabled       bool
+	}
+	TransactItems []struct {
+		Put, Delete, Update, ConditionCheck *fakeRequest
+	}
+}
+
+func (f *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, op, _ := strings.Cut(r.Header.Get("X-Amz-Target"), ".")
+	var req fakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	resp, ferr := f.handle(op, &req)
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	if ferr != nil {
+		body := map[string]any{"__type": "com.amazonaws.dynamodb.v20120810#" + ferr.code, "message": ferr.message}
+		for k, v := range ferr.extra {
+			body[k] = v
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeDynamoDB) handle(op string, req *fakeRequest) (map[string]any, *fakeError) {
+	if op == "CreateTable" {
+		return f.createTable(req)
+	}
+	table, ok := f.tables[req.TableName]
+	if !ok && op != "TransactWriteItems" {
+		return nil, &fakeError{code: "ResourceNotFoundException", message: "Requested resource not found: " + req.TableName}
+	}
+
+	switch op {
+	case "DescribeTable":
+		return map[string]any{"Table": map[string]any{"TableName": req.TableName, "TableStatus": "ACTIVE"}}, nil
+	case "DeleteTable":
+		delete(f.tables, req.TableName)
+		return map[string]any{"TableDescription": map[string]any{"TableName": req.TableName, "TableStatus": "DELETING"}}, nil
+	case "UpdateTimeToLive":
+		table.ttl = req.TimeToLiveSpecification.AttributeName
+		return map[string]any{"TimeToLiveSpecification": req.TimeToLiveSpecification}, nil
+	case "GetItem":
+		if item, ok := table.items[table.key(req.Key)]; ok {
+			return map[string]any{"Item": item}, nil
+		}
+		return map[string]any{}, nil
+	case "PutItem", "DeleteItem":
+		key := table.key(req.Key)
+		if op == "PutItem" {
+			key = table.key(req.Item)
+		}
+		old, exists := table.items[key]
+		if err := checkCondition(req, old, exists); err != nil {
+			return nil, err
+		}
+		if op == "PutItem" {
+			table.items[key] = req.Item
+		} else {
+			delete(table.items, key)
+		}
+		return map[string]any{}, nil
+	case "UpdateItem":
+		return table.updateItem(req)
+	case "TransactWriteItems":
+		return f.transactWrite(req)
+	case "Query":
+		return table.query(req)
+	case "Scan":
+		return table.scan(req)
+	}
+	return nil, &fakeError{code: "UnknownOperationException", message: "fake doesn't support " + op}
+}
+
+func (f *fakeDynamoDB) createTable(req *fakeRequest) (map[string]any, *fakeError) {
+	if _, ok := f.tables[req.TableName]; ok {
+		return nil, &fakeError{code: "ResourceInUseException", message: "Table already exists: " + req.TableName}
+	}
+	table := &fakeTable{indexes: map[string][2]string{}, items: map[string]fakeItem{}}
+	table.hash, table.rng = keyNames(req.KeySchema)
+	for _, gsi := range req.GlobalSecondaryIndexes {
+		hash, rng := keyNames(gsi.KeySchema)
+		table.indexes[gsi.IndexName] = [2]string{hash, rng}
+	}
+	f.tables[req.TableName] = table
+	return map[string]any{"TableDescription": map[string]any{"TableName": req.TableName, "TableStatus": "ACTIVE"}}, nil
+}
+
+func keyNames(schema []struct{ AttributeName, KeyType string }) (hash, rng string) {
+	for _, k := range schema {
+		if k.KeyType == "HASH" {
+			hash = k.AttributeName
+		} else {
+			rng = k.AttributeName
+		}
+	}
+	return hash, rng
+}
+
+// transactWrite checks every condition before applying any of the writes,
+// and reports which ones failed the way DynamoDB does.
+func (f *fakeDynamoDB) transactWrite(req *fakeRequest) (map[string]any, *fakeError) {
+	reasons := make([]map[string]any, len(req.TransactItems))
+	failed := false
+	for i, ti := range req.TransactItems {
+		reasons[i] = map[string]any{"Code": "None"}
+		op := firstNonNil(ti.Put, ti.Delete, ti.Update, ti.ConditionCheck)
+		table, ok := f.tables[op.TableName]
+		if !ok {
+			return nil, &fakeError{code: "ResourceNotFoundException", message: "Requested resource not found: " + op.TableName}
+		}
+		key := op.Key
+		if ti.Put != nil {
+			key = op.Item
+		}
+		old, exists := table.items[table.key(key)]
+		if err := checkCondition(op, old, exists); err != nil {
+			reasons[i] = map[string]any{"Code": "ConditionalCheckFailed", "Message": err.message}
+			failed = true
+		}
+		if ti.Update != nil {
+			if _, err := applyUpdate(op, old); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if failed {
+		return nil, &fakeError{
+			code:    "TransactionCanceledException",
+			message: "Transaction cancelled, please refer cancellation reasons for specific reasons",
+			extra:   map[string]any{"CancellationReasons": reasons},
+		}
+	}
+	for _, ti := range req.TransactItems {
+		switch {
+		case ti.Put != nil:
+			table := f.tables[ti.Put.TableName]
+			table.items[table.key(ti.Put.Item)] = ti.Put.Item
+		case ti.Delete != nil:
+			table := f.tables[ti.Delete.TableName]
+			delete(table.items, table.key(ti.Delete.Key))
+		case ti.Update != nil:
+			table := f.tables[ti.Update.TableName]
+			key := table.key(ti.Update.Key)
+			table.items[key], _ = applyUpdate(ti.Update, table.items[key])
+		}
+	}
+	return map[string]any{}, nil
+}
+
+func firstNonNil(reqs ...*fakeRequest) *fakeRequest {
+	for _, r := range reqs {
+		if r != nil {
+			return r
+		}
+	}
+	return &fakeRequest{}
+}
+
+func checkCondition(req *fakeRequest, old fakeItem, exists bool) *fakeError {
+	if req.ConditionExpression == "" {
+		return nil
+	}
+	ok, err := evaluate(req.ConditionExpression, req, old)
+	if err != nil {
+		return &fakeError{code: "ValidationException", message: err.Error()}
+	}
+	if ok {
+		return nil
+	}
+	ferr := &fakeError{code: "ConditionalCheckFailedException", message: "The conditional request failed"}
+	if exists && req.ReturnValuesOnConditionCheckFailure == "ALL_OLD" {
+		ferr.extra = map[string]any{"Item": old}
+	}
+	return ferr
+}
+
+func (t *fakeTable) key(item fakeItem) string {
+	return attrString(item[t.hash]) + "\x00" + attrString(item[t.rng])
+}
+
+// sorted returns the items that have the given key attributes, ordered by
+// them.
+func (t *fakeTable) sorted(hash, rng string) []fakeItem {
+	var items []fakeItem
+	for _, item := range t.items {
+		if item[hash] != nil && (rng == "" || item[rng] != nil) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if a, b := attrString(items[i][hash]), attrString(items[j][hash]); a != b {
+			return a < b
+		}
+		return attrString(items[i][rng]) < attrString(items[j][rng])
+	})
+	return items
+}
+
+func (t *fakeTable) query(req *fakeRequest) (map[string]any, *fakeError) {
+	hash, rng := t.hash, t.rng
+	if req.IndexName != "" {
+		index, ok := t.indexes[req.IndexName]
+		if !ok {
+			return nil, &fakeError{code: "ValidationException", message: "no such index: " + req.IndexName}
+		}
+		hash, rng = index[0], index[1]
+	}
+	items := []fakeItem{}
+	for _, item := range t.sorted(hash, rng) {
+		ok, err := evaluate(req.KeyConditionExpression, req, item)
+		if err == nil && ok && req.FilterExpression != "" {
+			ok, err = evaluate(req.FilterExpression, req, item)
+		}
+		if err != nil {
+			return nil, &fakeError{code: "ValidationException", message: err.Error()}
+		}
+		if ok {
+			items = append(items, item)
+		}
+	}
+	return map[string]any{"Items": items, "Count": len(items), "ScannedCount": len(items)}, nil
+}
+
+// scan pages through the table in key order. Like DynamoDB, Limit counts the
+// items read, before the filter is applied.
+func (t *fakeTable) scan(req *fakeRequest) (map[string]any, *fakeError) {
+	all := t.sorted(t.hash, t.rng)
+	start := 0
+	if req.ExclusiveStartKey != nil {
+		after := t.key(req.ExclusiveStartKey)
+		for start < len(all) && t.key(all[start]) <= after {
+			start++
+		}
+	}
+	end := len(all)
+	if req.Limit > 0 && start+req.Limit < end {
+		end = start + req.Limit
+	}
+
+	items := []fakeItem{}
+	for _, item := range all[start:end] {
+		if req.FilterExpression != "" {
+			ok, err := evaluate(req.FilterExpression, req, item)
+			if err != nil {
+				return nil, &fakeError{code: "ValidationException", message: err.Error()}
+			}
+			if !ok {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	resp := map[string]any{"Items": items, "Count": len(items), "ScannedCount": end - start}
+	if end < len(all) {
+		last := all[end-1]
+		resp["LastEvaluatedKey"] = fakeItem{t.hash: last[t.hash], t.rng: last[t.rng]}
+	}
+	return resp, nil
+}
+
+// updateItem applies an update expression made of SET clauses that assign
+// values, creating the item if it doesn't exist.
+func (t *fakeTable) updateItem(req *fakeRequest) (map[string]any, *fakeError) {
+	key := t.key(req.Key)
+	old, exists := t.items[key]
+	if err := checkCondition(req, old, exists); err != nil {
+		return nil, err
+	}
+	item, err := applyUpdate(req, old)
+	if err != nil {
+		return nil, err
+	}
+	t.items[key] = item
+
+	if req.ReturnValues == "ALL_NEW" {
+		return map[string]any{"Attributes": item}, nil
+	}
+	return map[string]any{}, nil
+}
+
+// applyUpdate returns a copy of old (which may be nil) with req's key and
+// SET clauses applied.
+func applyUpdate(req *fakeRequest, old fakeItem) (fakeItem, *fakeError) {
+	item := fakeItem{}
+	for k, v := range old {
+		item[k] = v
+	}
+	for k, v := range req.Key {
+		item[k] = v
+	}
+	set, ok := strings.CutPrefix(strings.TrimSpace(req.UpdateExpression), "SET ")
+	if !ok {
+		return nil, &fakeError{code: "ValidationException", message: "fake only supports SET: " + req.UpdateExpression}
+	}
+	for _, assignment := range strings.Split(set, ",") {
+		name, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return nil, &fakeError{code: "ValidationException", message: "fake can't parse " + assignment}
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if alias, ok := req.ExpressionAttributeNames[name]; ok {
+			name = alias
+		}
+		v, ok := req.ExpressionAttributeValues[value]
+		if !ok {
+			return nil, &fakeError{code: "ValidationException", message: "fake only assigns :values, got " + value}
+		}
+		item[name] = v
+	}
+	return item, nil
+}
+
+// evaluate reports whether item satisfies the expression.
+func evaluate(expr string, req *fakeRequest, item fakeItem) (bool, error) {
+	operand := func(s string) map[string]any {
+		s = strings.TrimSpace(s)
+		switch {
+		case strings.HasPrefix(s, ":"):
+			return req.ExpressionAttributeValues[s]
+		case strings.HasPrefix(s, "#"):
+			return item[req.ExpressionAttributeNames[s]]
+		}
+		return item[s]
+	}
+
+	for _, clause := range strings.Split(expr, " AND ") {
+		clause = strings.TrimSpace(clause)
+		if fn, args, ok := strings.Cut(clause, "("); ok && strings.HasSuffix(args, ")") {
+			parts := strings.Split(strings.TrimSuffix(args, ")"), ",")
+			var result bool
+			switch fn {
+			case "attribute_exists":
+				result = operand(parts[0]) != nil
+			case "attribute_not_exists":
+				result = operand(parts[0]) == nil
+			case "begins_with":
+				if len(parts) != 2 {
+					return false, fmt.Errorf("bad begins_with: %s", clause)
+				}
+				a, b := operand(parts[0]), operand(parts[1])
+				result = a != nil && b != nil && strings.HasPrefix(attrString(a), attrString(b))
+			default:
+				return false, fmt.Errorf("fake doesn't support %s", fn)
+			}
+			if !result {
+				return false, nil
+			}
+			continue
+		}
+
+		var op string
+		for _, candidate := range []string{"<=", ">=", "<>", "=", "<", ">"} {
+			if strings.Contains(clause, candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return false, fmt.Errorf("fake can't parse %q", clause)
+		}
+		left, right, _ := strings.Cut(clause, op)
+		a, b := operand(left), operand(right)
+		if a == nil || b == nil {
+			return false, nil
+		}
+		cmp := compareAttrs(a, b)
+		var result bool
+		switch op {
+		case "=":
+			result = cmp == 0
+		case "<>":
+			result = cmp != 0
+		case "<":
+			result = cmp < 0
+		case "<=":
+			result = cmp <= 0
+		case ">":
+			result = cmp > 0
+		case ">=":
+			result = cmp >= 0
+		}
+		if !result {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func compareAttrs(a, b map[string]any) int {
+	if an, ok := a["N"].(string); ok {
+		if bn, ok := b["N"].(string); ok {
+			x, _ := strconv.ParseFloat(an, 64)
+			y, _ := strconv.ParseFloat(bn, 64)
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(attrString(a), attrString(b))
+}
+
+// attrString returns a scalar attribute's value as a string.
+func attrString(v map[string]any) string {
+	for _, t := range []string{"S", "N", "B"} {
+		if s, ok := v[t].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
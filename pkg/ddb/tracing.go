@@ -0,0 +1,38 @@
+package ddb
+
+import (
+	"context"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/metrics"
+	"github.com/StatelyCloud/demo-w/pkg/tracing"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// observe starts a span for a DynamoDBClient method. The returned function
+// ends it and records the call's latency and error in metrics; defer it with a
+// pointer to the method's named error result.
+func observe(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, func(*error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "DynamoDBClient."+method, attrs...)
+	return ctx, func(err *error) {
+		metrics.ObserveCall("ddb", method, start, err)
+		tracing.End(span, err)
+	}
+}
+
+// addTraceContext adds W3C trace context headers to every request the AWS SDK
+// sends. It runs in the build step, before the request is signed.
+func addTraceContext(stack *middleware.Stack) error {
+	return stack.Build.Add(middleware.BuildMiddlewareFunc("TraceContext",
+		func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+			}
+			return next.HandleBuild(ctx, in)
+		}), middleware.After)
+}
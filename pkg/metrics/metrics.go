@@ -0,0 +1,106 @@
+// Package metrics defines the Prometheus metrics the service exports on
+// /metrics.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "demo_w"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	// RateLimitedRequests counts API requests rejected by the per-caller rate
+	// limit. They're turned away before routing, so they don't show up in
+	// http_requests_total.
+	RateLimitedRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "API requests rejected by the per-caller rate limit.",
+	})
+
+	callDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "client_call_duration_seconds",
+		Help:      "Latency of pkg/client (backend=stately) and pkg/ddb (backend=ddb) calls by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "method"})
+
+	callErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "client_call_errors_total",
+		Help:      "pkg/client (backend=stately) and pkg/ddb (backend=ddb) calls that returned an error, by method.",
+	}, []string{"backend", "method"})
+
+	AccessCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "access_cache_requests_total",
+		Help:      "Access checks answered from the cache (result=hit) or the store (result=miss).",
+	}, []string{"result"})
+
+	AccessCacheInvalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "access_cache_invalidations_total",
+		Help:      "Cached access checks dropped because of a write by this replica (source=local) or a change seen in the change feed (source=sync).",
+	}, []string{"source"})
+
+	// ActiveLeases, PendingApprovals and LeasesPerResource are computed
+	// periodically from a scan of the leases, so they lag a little behind.
+	ActiveLeases = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_leases",
+		Help:      "Leases that currently grant access.",
+	})
+	PendingApprovals = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_approvals",
+		Help:      "Unexpired leases that are waiting to be approved.",
+	})
+	LeasesPerResource = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leases_per_resource",
+		Help:      "Unexpired leases (approved or not) for each resource.",
+	}, []string{"resource_id"})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// InstrumentHandler records the count and latency of requests to h under the
+// given route. Use the route's pattern rather than the request path, so that
+// IDs in the path don't each get their own series.
+func InstrumentHandler(route string, h http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": route}
+	return promhttp.InstrumentHandlerCounter(httpRequests.MustCurryWith(labels),
+		promhttp.InstrumentHandlerDuration(httpDuration.MustCurryWith(labels), h))
+}
+
+// ObserveCall records the latency of a client call, and whether it failed.
+// It's meant to be deferred at the top of a method with a named error result:
+//
+//	defer metrics.ObserveCall("stately", "CreateUser", time.Now(), &err)
+func ObserveCall(backend, method string, start time.Time, err *error) {
+	callDuration.WithLabelValues(backend, method).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		callErrors.WithLabelValues(backend, method).Inc()
+	}
+}
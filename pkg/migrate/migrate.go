@@ -0,0 +1,410 @@
+// Package migrate copies users, resources and leases from the DynamoDB
+// single-table layout in pkg/ddb into StatelyDB.
+//
+// IDs are kept as they are, so anything that refers to them (other leases,
+// external systems) keeps working. DynamoDB stores a lease's absolute expiry
+// (ttl) while Stately counts duration_seconds from the lease's lastTouched
+// time, so lastTouched is back-dated to ttl - duration to keep the time each
+// lease has left. Leases that have already expired aren't copied.
+//
+// Progress is saved to a checkpoint file after every page of the scan, so an
+// interrupted migration picks up where it left off. Pages are written with
+// Puts that overwrite by ID, so redoing part of a page is harmless.
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/client"
+	"github.com/StatelyCloud/demo-w/pkg/ddb"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/StatelyCloud/go-sdk/stately"
+	"github.com/google/uuid"
+)
+
+// batchSize is the most items Stately accepts in one PutBatch.
+const batchSize = 50
+
+// Source is the DynamoDB table being migrated. *ddb.DynamoDBClient implements
+// it.
+type Source interface {
+	ScanPage(ctx context.Context, after *ddb.Cursor, limit int32) (*ddb.Page, error)
+}
+
+// Target is the Stately store being migrated into. *client.Client implements
+// it.
+type Target interface {
+	RestoreBatch(ctx context.Context, items ...stately.Item) error
+	GetUser(ctx context.Context, userID uuid.UUID) (*schema.User, error)
+	GetResource(ctx context.Context, resourceID uuid.UUID) (*schema.Resource, error)
+	GetLease(ctx context.Context, leaseID uuid.UUID) (*schema.Lease, error)
+	ListUsers(ctx context.Context) ([]*schema.User, error)
+	ListResources(ctx context.Context) ([]*schema.Resource, error)
+	ListLeases(ctx context.Context) ([]*schema.Lease, error)
+}
+
+// Counts tallies items by kind.
+type Counts struct {
+	Users     int `json:"users"`
+	Resources int `json:"resources"`
+	Leases    int `json:"leases"`
+}
+
+// Checkpoint records how far a migration has got.
+type Checkpoint struct {
+	// Cursor is where the next page of the scan starts. It's nil before the
+	// first page has been written.
+	Cursor *ddb.Cursor `json:"cursor"`
+	Done   bool        `json:"done"`
+	// Migrated counts the items written so far.
+	Migrated Counts `json:"migrated"`
+	// Expired counts the leases that were skipped because they had expired.
+	Expired int `json:"expired"`
+}
+
+type Migrator struct {
+	Source Source
+	Target Target
+	// CheckpointPath is the file progress is saved to. If it's empty, progress
+	// isn't saved and every run starts from the beginning.
+	CheckpointPath string
+	// PageSize is how many DynamoDB items are read per scan page.
+	PageSize int32
+}
+
+// Run copies everything from the source to the target, resuming from the
+// checkpoint if there is one.
+func (m *Migrator) Run(ctx context.Context) (*Checkpoint, error) {
+	cp, err := m.loadCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	if cp.Done {
+		log.Printf("Checkpoint %s says the migration already finished", m.CheckpointPath)
+		return cp, nil
+	}
+	if cp.Cursor != nil {
+		log.Printf("Resuming migration after %s/%s", cp.Cursor.PK, cp.Cursor.SK)
+	}
+
+	for {
+		page, err := m.Source.ScanPage(ctx, cp.Cursor, m.pageSize())
+		if err != nil {
+			return cp, err
+		}
+		if err := m.writePage(ctx, page, cp); err != nil {
+			return cp, err
+		}
+
+		cp.Cursor = page.Next
+		cp.Done = page.Next == nil
+		if err := m.saveCheckpoint(cp); err != nil {
+			return cp, err
+		}
+		log.Printf("Migrated %d users, %d resources, %d leases (%d expired leases skipped)",
+			cp.Migrated.Users, cp.Migrated.Resources, cp.Migrated.Leases, cp.Expired)
+		if cp.Done {
+			return cp, nil
+		}
+	}
+}
+
+func (m *Migrator) writePage(ctx context.Context, page *ddb.Page, cp *Checkpoint) error {
+	now := time.Now()
+	var items []stately.Item
+	var counts Counts
+	for _, user := range page.Users {
+		items = append(items, toUser(user, now))
+		counts.Users++
+	}
+	for _, resource := range page.Resources {
+		items = append(items, toResource(resource, now))
+		counts.Resources++
+	}
+	for _, lease := range page.Leases {
+		l, ok := toLease(lease, now)
+		if !ok {
+			cp.Expired++
+			continue
+		}
+		items = append(items, l)
+		if l.BundleId != uuid.Nil {
+			// So the bundle can still be approved together.
+			items = append(items, &schema.BundleMember{BundleId: l.BundleId, LeaseId: l.Id, DurationSeconds: l.DurationSeconds})
+		}
+		counts.Leases++
+	}
+
+	for start := 0; start < len(items); start += batchSize {
+		end := min(start+batchSize, len(items))
+		if err := m.Target.RestoreBatch(ctx, items[start:end]...); err != nil {
+			return fmt.Errorf("failed to write batch: %w", err)
+		}
+	}
+	cp.Migrated.Users += counts.Users
+	cp.Migrated.Resources += counts.Resources
+	cp.Migrated.Leases += counts.Leases
+	return nil
+}
+
+// Items written before pkg/ddb tracked created_at don't record when they
+// were created, so the best we can do for those is the time they were migrated.
+func createdAt(t, now time.Time) time.Time {
+	if t.IsZero() {
+		return now
+	}
+	return t
+}
+
+func toUser(user *ddb.User, now time.Time) *schema.User {
+	return &schema.User{
+		Id:          user.ID,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		CreatedAt:   createdAt(user.CreatedAt, now),
+	}
+}
+
+func toResource(resource *ddb.Resource, now time.Time) *schema.Resource {
+	return &schema.Resource{
+		Id:        resource.ID,
+		Name:      resource.Name,
+		CreatedAt: createdAt(resource.CreatedAt, now),
+	}
+}
+
+// toLease returns false if the lease has already expired.
+func toLease(lease *ddb.Lease, now time.Time) (*schema.Lease, bool) {
+	lastTouched := now
+	if lease.Duration > 0 {
+		expiresAt := time.Unix(lease.TTL, 0)
+		if !expiresAt.After(now) {
+			return nil, false
+		}
+		lastTouched = expiresAt.Add(-lease.Duration)
+	}
+	return &schema.Lease{
+		Id:              lease.ID,
+		UserId:          lease.UserId,
+		ResourceId:      lease.ResId,
+		Reason:          lease.Reason,
+		DurationSeconds: lease.Duration,
+		LastTouched:     lastTouched,
+		CreatedAt:       createdAt(lease.CreatedAt, lastTouched),
+		Approver:        lease.Approver,
+		BundleId:        lease.BundleID,
+	}, true
+}
+
+func (m *Migrator) pageSize() int32 {
+	if m.PageSize <= 0 {
+		return 100
+	}
+	return m.PageSize
+}
+
+func (m *Migrator) loadCheckpoint() (*Checkpoint, error) {
+	cp := &Checkpoint{}
+	if m.CheckpointPath == "" {
+		return cp, nil
+	}
+	data, err := os.ReadFile(m.CheckpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", m.CheckpointPath, err)
+	}
+	return cp, nil
+}
+
+// saveCheckpoint writes the checkpoint to a temporary file and renames it into
+// place, so a crash never leaves a half-written checkpoint behind.
+func (m *Migrator) saveCheckpoint(cp *Checkpoint) error {
+	if m.CheckpointPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.CheckpointPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.CheckpointPath)
+}
+
+// Verification is the result of comparing the source and target.
+type Verification struct {
+	// Source counts the source's users, resources and unexpired leases.
+	Source Counts `json:"source"`
+	// Target counts everything in the target, which may include items that
+	// didn't come from the source.
+	Target Counts `json:"target"`
+	// Checked is how many items were spot-checked.
+	Checked    int      `json:"checked"`
+	Mismatches []string `json:"mismatches"`
+}
+
+func (v *Verification) OK() bool {
+	return len(v.Mismatches) == 0
+}
+
+// Verify compares item counts between the source and target, and spot-checks
+// up to spotChecks randomly chosen items of each kind field by field.
+func (m *Migrator) Verify(ctx context.Context, spotChecks int) (*Verification, error) {
+	v := &Verification{Mismatches: []string{}}
+	now := time.Now()
+
+	// Reservoir-sample the items to check while counting, so we only need one
+	// pass over the table.
+	var users []*ddb.User
+	var resources []*ddb.Resource
+	var leases []*ddb.Lease
+	var cursor *ddb.Cursor
+	for {
+		page, err := m.Source.ScanPage(ctx, cursor, m.pageSize())
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range page.Users {
+			v.Source.Users++
+			users = sample(users, user, v.Source.Users, spotChecks)
+		}
+		for _, resource := range page.Resources {
+			v.Source.Resources++
+			resources = sample(resources, resource, v.Source.Resources, spotChecks)
+		}
+		for _, lease := range page.Leases {
+			if _, ok := toLease(lease, now); !ok {
+				continue
+			}
+			v.Source.Leases++
+			leases = sample(leases, lease, v.Source.Leases, spotChecks)
+		}
+		if page.Next == nil {
+			break
+		}
+		cursor = page.Next
+	}
+
+	targetUsers, err := m.Target.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targetResources, err := m.Target.ListResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targetLeases, err := m.Target.ListLeases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v.Target = Counts{Users: len(targetUsers), Resources: len(targetResources), Leases: len(targetLeases)}
+
+	// The target can have more than the source (it may have had data of its
+	// own, and leases can be created after migrating), but never less.
+	if v.Target.Users < v.Source.Users {
+		v.mismatch("target has %d users, source has %d", v.Target.Users, v.Source.Users)
+	}
+	if v.Target.Resources < v.Source.Resources {
+		v.mismatch("target has %d resources, source has %d", v.Target.Resources, v.Source.Resources)
+	}
+	if v.Target.Leases < v.Source.Leases {
+		v.mismatch("target has %d leases, source has %d", v.Target.Leases, v.Source.Leases)
+	}
+
+	for _, want := range users {
+		v.Checked++
+		got, err := m.Target.GetUser(ctx, want.ID)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case got == nil:
+			v.mismatch("user %s is missing", want.ID)
+		case got.Email != want.Email || got.DisplayName != want.DisplayName:
+			v.mismatch("user %s is %q <%s>, want %q <%s>", want.ID, got.DisplayName, got.Email, want.DisplayName, want.Email)
+		}
+	}
+	for _, want := range resources {
+		v.Checked++
+		got, err := m.Target.GetResource(ctx, want.ID)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case got == nil:
+			v.mismatch("resource %s is missing", want.ID)
+		case got.Name != want.Name:
+			v.mismatch("resource %s is named %q, want %q", want.ID, got.Name, want.Name)
+		}
+	}
+	for _, want := range leases {
+		v.Checked++
+		got, err := m.Target.GetLease(ctx, want.ID)
+		if errors.Is(err, client.ErrLeaseNotFound) {
+			// It may have expired since we scanned it.
+			if time.Now().Unix() < want.TTL {
+				v.mismatch("lease %s is missing", want.ID)
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if diff := compareLease(got, want); diff != "" {
+			v.mismatch("lease %s %s", want.ID, diff)
+		}
+	}
+	return v, nil
+}
+
+func compareLease(got *schema.Lease, want *ddb.Lease) string {
+	switch {
+	case got.UserId != want.UserId:
+		return fmt.Sprintf("has user %s, want %s", got.UserId, want.UserId)
+	case got.ResourceId != want.ResId:
+		return fmt.Sprintf("has resource %s, want %s", got.ResourceId, want.ResId)
+	case got.Reason != want.Reason:
+		return fmt.Sprintf("has reason %q, want %q", got.Reason, want.Reason)
+	case got.DurationSeconds != want.Duration:
+		return fmt.Sprintf("has duration %s, want %s", got.DurationSeconds, want.Duration)
+	case got.Approver != want.Approver:
+		return fmt.Sprintf("has approver %s, want %s", got.Approver, want.Approver)
+	}
+	// The lease may have been touched since it was migrated, which only ever
+	// moves its expiry later. DynamoDB's ttl is in whole seconds.
+	if want.Duration > 0 {
+		gotExpiry := client.LeaseExpiry(got).Unix()
+		if gotExpiry < want.TTL {
+			return fmt.Sprintf("expires at %s, want %s", time.Unix(gotExpiry, 0), time.Unix(want.TTL, 0))
+		}
+	}
+	return ""
+}
+
+func (v *Verification) mismatch(format string, args ...any) {
+	v.Mismatches = append(v.Mismatches, fmt.Sprintf(format, args...))
+}
+
+// sample adds the nth item seen to a reservoir of at most size items, so that
+// every item ends up in the reservoir with equal probability.
+func sample[T any](reservoir []T, item T, n, size int) []T {
+	if len(reservoir) < size {
+		return append(reservoir, item)
+	}
+	if i := rand.IntN(n); i < size {
+		reservoir[i] = item
+	}
+	return reservoir
+}
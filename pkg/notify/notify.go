@@ -0,0 +1,194 @@
+// Package notify delivers lease events to the people and systems that care
+// about them.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+type EventType string
+
+const (
+	LeaseRequested    EventType = "lease.requested"
+	LeaseApproved     EventType = "lease.approved"
+	LeaseDenied       EventType = "lease.denied"
+	LeaseEmergency    EventType = "lease.emergency"
+	LeaseExtended     EventType = "lease.extended"
+	LeaseRevoked      EventType = "lease.revoked"
+	LeaseExpiringSoon EventType = "lease.expiring_soon"
+	LeaseExpired      EventType = "lease.expired"
+	// LeaseRecertify reminds a resource's owner to confirm a lease in a
+	// recertification campaign. ExpiresAt is when the campaign closes.
+	LeaseRecertify EventType = "lease.recertification_due"
+)
+
+// Priority marks events that someone should look at straight away.
+type Priority string
+
+const PriorityHigh Priority = "high"
+
+// Event is something that happened to a lease.
+type Event struct {
+	Type      EventType     `json:"type"`
+	Priority  Priority      `json:"priority,omitempty"`
+	Time      time.Time     `json:"time"`
+	Lease     *schema.Lease `json:"lease"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+	// Campaign is only set for lease.recertification_due.
+	Campaign *schema.Campaign `json:"campaign,omitempty"`
+}
+
+// Notifier sends events somewhere.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// Multi sends each event to every notifier in the list.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, event Event) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ErrQueueFull is returned by Async when it can't keep up.
+var ErrQueueFull = errors.New("notification queue is full")
+
+// Async hands events to another notifier in the background, so that a slow
+// or hung webhook or mail relay doesn't hold up the lease operation that
+// raised them. Events are sent one at a time, in order, by Run.
+type Async struct {
+	next  Notifier
+	queue chan queuedEvent
+}
+
+type queuedEvent struct {
+	ctx   context.Context
+	event Event
+}
+
+// NewAsync returns an Async that queues up to size events for next.
+func NewAsync(next Notifier, size int) *Async {
+	return &Async{next: next, queue: make(chan queuedEvent, size)}
+}
+
+// Notify queues the event. It never blocks - if the queue is full the event
+// is dropped and ErrQueueFull is returned.
+func (a *Async) Notify(ctx context.Context, event Event) error {
+	// The event outlives the request that raised it, but keeps its trace.
+	select {
+	case a.queue <- queuedEvent{context.WithoutCancel(ctx), event}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Run sends queued events until ctx is cancelled.
+func (a *Async) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case queued := <-a.queue:
+			if err := a.next.Notify(queued.ctx, queued.event); err != nil {
+				log.Printf("Failed to send %s for lease %s: %v", queued.event.Type, queued.event.Lease.GetId(), err)
+			}
+		}
+	}
+}
+
+// Log writes events to the standard logger.
+type Log struct{}
+
+func (Log) Notify(_ context.Context, event Event) error {
+	prefix := ""
+	if event.Priority == PriorityHigh {
+		prefix = "URGENT "
+	}
+	log.Printf("%s%s: lease %s (user %s, resource %s) expires at %s", prefix, event.Type,
+		event.Lease.GetId(), event.Lease.GetUserId(), event.Lease.GetResourceId(),
+		event.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// Webhook POSTs each event as JSON to a fixed URL.
+type Webhook struct {
+	URL string
+	// Client defaults to one that passes on the caller's trace context and
+	// gives up after 10 seconds.
+	Client *http.Client
+}
+
+var tracedClient = &http.Client{Timeout: 10 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+func (w *Webhook) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = tracedClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+// SMTP emails each event. It doesn't authenticate, so it's meant to be pointed
+// at a local relay (or a stand-in like MailHog during development).
+type SMTP struct {
+	Addr string
+	From string
+	To   []string
+}
+
+func (s *SMTP) Notify(_ context.Context, event Event) error {
+	subject := fmt.Sprintf("Lease %s: %s", event.Lease.GetId(), event.Type)
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", s.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(s.To, ", "))
+	if event.Priority == PriorityHigh {
+		subject = "[URGENT] " + subject
+		body.WriteString("X-Priority: 1\r\nImportance: high\r\n")
+	}
+	fmt.Fprintf(&body, "Subject: %s\r\n\r\n", subject)
+	fmt.Fprintf(&body, "User:     %s\r\n", event.Lease.GetUserId())
+	fmt.Fprintf(&body, "Resource: %s\r\n", event.Lease.GetResourceId())
+	fmt.Fprintf(&body, "Reason:   %s\r\n", event.Lease.GetReason())
+	if incident := event.Lease.GetIncidentRef(); incident != "" {
+		fmt.Fprintf(&body, "Incident: %s\r\n", incident)
+	}
+	fmt.Fprintf(&body, "Expires:  %s\r\n", event.ExpiresAt.Format(time.RFC3339))
+	return smtp.SendMail(s.Addr, nil, s.From, s.To, []byte(body.String()))
+}
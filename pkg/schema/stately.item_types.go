@@ -11,39 +11,1805 @@ import (
 	"github.com/StatelyCloud/go-sdk/stately"
 )
 
+// Lists a lease under the bundle it was requested in, so the whole bundle can
+// be approved or denied at once. It's written in the same transaction as the
+// leases, and expires with its lease.
+//
+// BundleMember items can be accessed via the following key paths:
+// * /bundle-:bundle_id/lease-:lease_id
+type BundleMember struct {
+	BundleId uuid.UUID `protobuf:"bytes,1" json:"bundle_id,omitempty"`
+
+	LeaseId uuid.UUID `protobuf:"bytes,2" json:"lease_id,omitempty"`
+
+	DurationSeconds time.Duration `protobuf:"zigzag64,3" json:"duration_seconds,omitempty,string"`
+}
+
+// GetBundleId is a nil-safe getter for field BundleId.
+func (x *BundleMember) GetBundleId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.BundleId
+}
+
+// GetLeaseId is a nil-safe getter for field LeaseId.
+func (x *BundleMember) GetLeaseId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.LeaseId
+}
+
+// GetDurationSeconds is a nil-safe getter for field DurationSeconds.
+func (x *BundleMember) GetDurationSeconds() time.Duration {
+	if x == nil {
+		return 0
+	}
+	return x.DurationSeconds
+}
+
+// MarshalJSON implements a custom JSON marshaller for BundleMember.
+func (x BundleMember) MarshalJSON() ([]byte, error) {
+	type Alias BundleMember
+	aux := &struct {
+		*Alias
+		BundleId        []byte `json:"bundle_id,omitempty"`
+		LeaseId         []byte `json:"lease_id,omitempty"`
+		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
+	}{
+		Alias:           (*Alias)(&x),
+		BundleId:        uuidToBinary(x.BundleId),
+		LeaseId:         uuidToBinary(x.LeaseId),
+		DurationSeconds: int64(x.DurationSeconds.Seconds()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for BundleMember.
+func (x *BundleMember) UnmarshalJSON(data []byte) error {
+	type Alias BundleMember
+	aux := &struct {
+		*Alias
+		BundleId        []byte `json:"bundle_id,omitempty"`
+		LeaseId         []byte `json:"lease_id,omitempty"`
+		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.BundleId = binaryToUUID(aux.BundleId)
+	x.LeaseId = binaryToUUID(aux.LeaseId)
+	x.DurationSeconds = time.Duration(aux.DurationSeconds) * time.Second
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *BundleMember) StatelyItemType() string {
+	return "BundleMember"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *BundleMember) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *BundleMember) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/bundle-:bundle_id/lease-:lease_id` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *BundleMember) KeyPath() string {
+	return "/bundle-" + stately.ToKeyID([16]byte(x.GetBundleId())) +
+		"/lease-" + stately.ToKeyID([16]byte(x.GetLeaseId()))
+}
+
+// A recertification campaign, in which resource owners reconfirm each standing
+// lease on their resources before closes_at. Leases that haven't been
+// confirmed by then are revoked when the campaign closes.
+//
+// Campaign items can be accessed via the following key paths:
+// * /campaign-:id
+type Campaign struct {
+	Id uuid.UUID `protobuf:"bytes,1" json:"id,omitempty"`
+
+	Name string `protobuf:"bytes,2" json:"name,omitempty"`
+
+	// The shortest lease the campaign covers. Leases without a duration are
+	// always covered.
+	MinDurationSeconds time.Duration `protobuf:"zigzag64,3" json:"min_duration_seconds,omitempty,string"`
+
+	ClosesAt time.Time `protobuf:"zigzag64,4" json:"closes_at,omitempty,string"`
+
+	// When the campaign was closed. Unset while it's open.
+	ClosedAt time.Time `protobuf:"zigzag64,5" json:"closed_at,omitempty,string"`
+
+	// When owners were last reminded about leases they haven't confirmed.
+	RemindedAt time.Time `protobuf:"zigzag64,6" json:"reminded_at,omitempty,string"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,7" json:"createdAt,omitempty,string"`
+}
+
+// GetId is a nil-safe getter for field Id.
+func (x *Campaign) GetId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.Id
+}
+
+// GetName is a nil-safe getter for field Name.
+func (x *Campaign) GetName() string {
+	if x == nil {
+		return ""
+	}
+	return x.Name
+}
+
+// GetMinDurationSeconds is a nil-safe getter for field MinDurationSeconds.
+func (x *Campaign) GetMinDurationSeconds() time.Duration {
+	if x == nil {
+		return 0
+	}
+	return x.MinDurationSeconds
+}
+
+// GetClosesAt is a nil-safe getter for field ClosesAt.
+func (x *Campaign) GetClosesAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.ClosesAt
+}
+
+// GetClosedAt is a nil-safe getter for field ClosedAt.
+func (x *Campaign) GetClosedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.ClosedAt
+}
+
+// GetRemindedAt is a nil-safe getter for field RemindedAt.
+func (x *Campaign) GetRemindedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.RemindedAt
+}
+
+// GetCreatedAt is a nil-safe getter for field CreatedAt.
+func (x *Campaign) GetCreatedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.CreatedAt
+}
+
+// MarshalJSON implements a custom JSON marshaller for Campaign.
+func (x Campaign) MarshalJSON() ([]byte, error) {
+	type Alias Campaign
+	aux := &struct {
+		*Alias
+		Id                 []byte `json:"id,omitempty"`
+		MinDurationSeconds int64  `json:"min_duration_seconds,omitempty,string"`
+		ClosesAt           int64  `json:"closes_at,omitempty,string"`
+		ClosedAt           int64  `json:"closed_at,omitempty,string"`
+		RemindedAt         int64  `json:"reminded_at,omitempty,string"`
+		CreatedAt          int64  `json:"createdAt,omitempty,string"`
+	}{
+		Alias:              (*Alias)(&x),
+		Id:                 uuidToBinary(x.Id),
+		MinDurationSeconds: int64(x.MinDurationSeconds.Seconds()),
+		ClosesAt:           int64(x.ClosesAt.UnixMilli()),
+		ClosedAt:           int64(x.ClosedAt.UnixMilli()),
+		RemindedAt:         int64(x.RemindedAt.UnixMilli()),
+		CreatedAt:          int64(x.CreatedAt.UnixMilli()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for Campaign.
+func (x *Campaign) UnmarshalJSON(data []byte) error {
+	type Alias Campaign
+	aux := &struct {
+		*Alias
+		Id                 []byte `json:"id,omitempty"`
+		MinDurationSeconds int64  `json:"min_duration_seconds,omitempty,string"`
+		ClosesAt           int64  `json:"closes_at,omitempty,string"`
+		ClosedAt           int64  `json:"closed_at,omitempty,string"`
+		RemindedAt         int64  `json:"reminded_at,omitempty,string"`
+		CreatedAt          int64  `json:"createdAt,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.Id = binaryToUUID(aux.Id)
+	x.MinDurationSeconds = time.Duration(aux.MinDurationSeconds) * time.Second
+	x.ClosesAt = time.UnixMilli(int64(aux.ClosesAt))
+	x.ClosedAt = time.UnixMilli(int64(aux.ClosedAt))
+	x.RemindedAt = time.UnixMilli(int64(aux.RemindedAt))
+	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *Campaign) StatelyItemType() string {
+	return "Campaign"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *Campaign) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *Campaign) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/campaign-:id` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *Campaign) KeyPath() string {
+	return "/campaign-" + stately.ToKeyID([16]byte(x.GetId()))
+}
+
+// Tracks one lease through a campaign. Items are listed under the campaign
+// for its progress, and under the resource's owner for their to-do list.
+//
+// CampaignItem items can be accessed via the following key paths:
+// * /campaign-:campaign_id/item-:lease_id
+// * /owner-:owner_id/campaign-:campaign_id/item-:lease_id
+type CampaignItem struct {
+	CampaignId uuid.UUID `protobuf:"bytes,1" json:"campaign_id,omitempty"`
+
+	LeaseId uuid.UUID `protobuf:"bytes,2" json:"lease_id,omitempty"`
+
+	UserId uuid.UUID `protobuf:"bytes,3" json:"user_id,omitempty"`
+
+	ResourceId uuid.UUID `protobuf:"bytes,4" json:"resource_id,omitempty"`
+
+	// Who has to confirm the lease. Unset if the resource has no owner.
+	OwnerId uuid.UUID `protobuf:"bytes,5" json:"owner_id,omitempty"`
+
+	// pending, confirmed, revoked, or gone if the lease ended by itself.
+	Status string `protobuf:"bytes,6" json:"status,omitempty"`
+
+	DecidedBy uuid.UUID `protobuf:"bytes,7" json:"decided_by,omitempty"`
+
+	DecidedAt time.Time `protobuf:"zigzag64,8" json:"decided_at,omitempty,string"`
+
+	Comment string `protobuf:"bytes,9" json:"comment,omitempty"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,10" json:"createdAt,omitempty,string"`
+}
+
+// GetCampaignId is a nil-safe getter for field CampaignId.
+func (x *CampaignItem) GetCampaignId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.CampaignId
+}
+
+// GetLeaseId is a nil-safe getter for field LeaseId.
+func (x *CampaignItem) GetLeaseId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.LeaseId
+}
+
+// GetUserId is a nil-safe getter for field UserId.
+func (x *CampaignItem) GetUserId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.UserId
+}
+
+// GetResourceId is a nil-safe getter for field ResourceId.
+func (x *CampaignItem) GetResourceId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.ResourceId
+}
+
+// GetOwnerId is a nil-safe getter for field OwnerId.
+func (x *CampaignItem) GetOwnerId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.OwnerId
+}
+
+// GetStatus is a nil-safe getter for field Status.
+func (x *CampaignItem) GetStatus() string {
+	if x == nil {
+		return ""
+	}
+	return x.Status
+}
+
+// GetDecidedBy is a nil-safe getter for field DecidedBy.
+func (x *CampaignItem) GetDecidedBy() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.DecidedBy
+}
+
+// GetDecidedAt is a nil-safe getter for field DecidedAt.
+func (x *CampaignItem) GetDecidedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.DecidedAt
+}
+
+// GetComment is a nil-safe getter for field Comment.
+func (x *CampaignItem) GetComment() string {
+	if x == nil {
+		return ""
+	}
+	return x.Comment
+}
+
+// GetCreatedAt is a nil-safe getter for field CreatedAt.
+func (x *CampaignItem) GetCreatedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.CreatedAt
+}
+
+// MarshalJSON implements a custom JSON marshaller for CampaignItem.
+func (x CampaignItem) MarshalJSON() ([]byte, error) {
+	type Alias CampaignItem
+	aux := &struct {
+		*Alias
+		CampaignId []byte `json:"campaign_id,omitempty"`
+		LeaseId    []byte `json:"lease_id,omitempty"`
+		UserId     []byte `json:"user_id,omitempty"`
+		ResourceId []byte `json:"resource_id,omitempty"`
+		OwnerId    []byte `json:"owner_id,omitempty"`
+		DecidedBy  []byte `json:"decided_by,omitempty"`
+		DecidedAt  int64  `json:"decided_at,omitempty,string"`
+		CreatedAt  int64  `json:"createdAt,omitempty,string"`
+	}{
+		Alias:      (*Alias)(&x),
+		CampaignId: uuidToBinary(x.CampaignId),
+		LeaseId:    uuidToBinary(x.LeaseId),
+		UserId:     uuidToBinary(x.UserId),
+		ResourceId: uuidToBinary(x.ResourceId),
+		OwnerId:    uuidToBinary(x.OwnerId),
+		DecidedBy:  uuidToBinary(x.DecidedBy),
+		DecidedAt:  int64(x.DecidedAt.UnixMilli()),
+		CreatedAt:  int64(x.CreatedAt.UnixMilli()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for CampaignItem.
+func (x *CampaignItem) UnmarshalJSON(data []byte) error {
+	type Alias CampaignItem
+	aux := &struct {
+		*Alias
+		CampaignId []byte `json:"campaign_id,omitempty"`
+		LeaseId    []byte `json:"lease_id,omitempty"`
+		UserId     []byte `json:"user_id,omitempty"`
+		ResourceId []byte `json:"resource_id,omitempty"`
+		OwnerId    []byte `json:"owner_id,omitempty"`
+		DecidedBy  []byte `json:"decided_by,omitempty"`
+		DecidedAt  int64  `json:"decided_at,omitempty,string"`
+		CreatedAt  int64  `json:"createdAt,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.CampaignId = binaryToUUID(aux.CampaignId)
+	x.LeaseId = binaryToUUID(aux.LeaseId)
+	x.UserId = binaryToUUID(aux.UserId)
+	x.ResourceId = binaryToUUID(aux.ResourceId)
+	x.OwnerId = binaryToUUID(aux.OwnerId)
+	x.DecidedBy = binaryToUUID(aux.DecidedBy)
+	x.DecidedAt = time.UnixMilli(int64(aux.DecidedAt))
+	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *CampaignItem) StatelyItemType() string {
+	return "CampaignItem"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *CampaignItem) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *CampaignItem) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/campaign-:campaign_id/item-:lease_id` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *CampaignItem) KeyPath() string {
+	return "/campaign-" + stately.ToKeyID([16]byte(x.GetCampaignId())) +
+		"/item-" + stately.ToKeyID([16]byte(x.GetLeaseId()))
+}
+
+// A review of a break-glass lease, which a resource owner has to acknowledge
+// after the fact. It's created along with the lease, and unlike the lease it
+// doesn't expire, so there's a record of every emergency.
+//
+// EmergencyReview items can be accessed via the following key paths:
+// * /review-:lease_id
+// * /res-:resource_id/review-:lease_id
+type EmergencyReview struct {
+	LeaseId uuid.UUID `protobuf:"bytes,1" json:"lease_id,omitempty"`
+
+	ResourceId uuid.UUID `protobuf:"bytes,2" json:"resource_id,omitempty"`
+
+	// The user who took the lease.
+	UserId uuid.UUID `protobuf:"bytes,3" json:"user_id,omitempty"`
+
+	Reason string `protobuf:"bytes,4" json:"reason,omitempty"`
+
+	IncidentRef string `protobuf:"bytes,5" json:"incident_ref,omitempty"`
+
+	DurationSeconds time.Duration `protobuf:"zigzag64,6" json:"duration_seconds,omitempty,string"`
+
+	// Who acknowledged the review. Unset until someone has.
+	AcknowledgedBy uuid.UUID `protobuf:"bytes,7" json:"acknowledged_by,omitempty"`
+
+	AcknowledgedAt time.Time `protobuf:"zigzag64,8" json:"acknowledged_at,omitempty,string"`
+
+	Comment string `protobuf:"bytes,9" json:"comment,omitempty"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,10" json:"createdAt,omitempty,string"`
+}
+
+// GetLeaseId is a nil-safe getter for field LeaseId.
+func (x *EmergencyReview) GetLeaseId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.LeaseId
+}
+
+// GetResourceId is a nil-safe getter for field ResourceId.
+func (x *EmergencyReview) GetResourceId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.ResourceId
+}
+
+// GetUserId is a nil-safe getter for field UserId.
+func (x *EmergencyReview) GetUserId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.UserId
+}
+
+// GetReason is a nil-safe getter for field Reason.
+func (x *EmergencyReview) GetReason() string {
+	if x == nil {
+		return ""
+	}
+	return x.Reason
+}
+
+// GetIncidentRef is a nil-safe getter for field IncidentRef.
+func (x *EmergencyReview) GetIncidentRef() string {
+	if x == nil {
+		return ""
+	}
+	return x.IncidentRef
+}
+
+// GetDurationSeconds is a nil-safe getter for field DurationSeconds.
+func (x *EmergencyReview) GetDurationSeconds() time.Duration {
+	if x == nil {
+		return 0
+	}
+	return x.DurationSeconds
+}
+
+// GetAcknowledgedBy is a nil-safe getter for field AcknowledgedBy.
+func (x *EmergencyReview) GetAcknowledgedBy() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.AcknowledgedBy
+}
+
+// GetAcknowledgedAt is a nil-safe getter for field AcknowledgedAt.
+func (x *EmergencyReview) GetAcknowledgedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.AcknowledgedAt
+}
+
+// GetComment is a nil-safe getter for field Comment.
+func (x *EmergencyReview) GetComment() string {
+	if x == nil {
+		return ""
+	}
+	return x.Comment
+}
+
+// GetCreatedAt is a nil-safe getter for field CreatedAt.
+func (x *EmergencyReview) GetCreatedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.CreatedAt
+}
+
+// MarshalJSON implements a custom JSON marshaller for EmergencyReview.
+func (x EmergencyReview) MarshalJSON() ([]byte, error) {
+	type Alias EmergencyReview
+	aux := &struct {
+		*Alias
+		LeaseId         []byte `json:"lease_id,omitempty"`
+		ResourceId      []byte `json:"resource_id,omitempty"`
+		UserId          []byte `json:"user_id,omitempty"`
+		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
+		AcknowledgedBy  []byte `json:"acknowledged_by,omitempty"`
+		AcknowledgedAt  int64  `json:"acknowledged_at,omitempty,string"`
+		CreatedAt       int64  `json:"createdAt,omitempty,string"`
+	}{
+		Alias:           (*Alias)(&x),
+		LeaseId:         uuidToBinary(x.LeaseId),
+		ResourceId:      uuidToBinary(x.ResourceId),
+		UserId:          uuidToBinary(x.UserId),
+		DurationSeconds: int64(x.DurationSeconds.Seconds()),
+		AcknowledgedBy:  uuidToBinary(x.AcknowledgedBy),
+		AcknowledgedAt:  int64(x.AcknowledgedAt.UnixMilli()),
+		CreatedAt:       int64(x.CreatedAt.UnixMilli()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for EmergencyReview.
+func (x *EmergencyReview) UnmarshalJSON(data []byte) error {
+	type Alias EmergencyReview
+	aux := &struct {
+		*Alias
+		LeaseId         []byte `json:"lease_id,omitempty"`
+		ResourceId      []byte `json:"resource_id,omitempty"`
+		UserId          []byte `json:"user_id,omitempty"`
+		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
+		AcknowledgedBy  []byte `json:"acknowledged_by,omitempty"`
+		AcknowledgedAt  int64  `json:"acknowledged_at,omitempty,string"`
+		CreatedAt       int64  `json:"createdAt,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.LeaseId = binaryToUUID(aux.LeaseId)
+	x.ResourceId = binaryToUUID(aux.ResourceId)
+	x.UserId = binaryToUUID(aux.UserId)
+	x.DurationSeconds = time.Duration(aux.DurationSeconds) * time.Second
+	x.AcknowledgedBy = binaryToUUID(aux.AcknowledgedBy)
+	x.AcknowledgedAt = time.UnixMilli(int64(aux.AcknowledgedAt))
+	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *EmergencyReview) StatelyItemType() string {
+	return "EmergencyReview"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *EmergencyReview) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *EmergencyReview) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/review-:lease_id` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *EmergencyReview) KeyPath() string {
+	return "/review-" + stately.ToKeyID([16]byte(x.GetLeaseId()))
+}
+
+// The response to a create request sent with an Idempotency-Key header, so
+// that a retry of the same request gets the same response instead of creating
+// something twice. While the first request is still running the record has no
+// status, and it's only kept for a short time either way.
+//
+// IdempotencyRecord items can be accessed via the following key paths:
+// * /idem-:key
+type IdempotencyRecord struct {
+	// The endpoint and API version the key was used with, and the key itself.
+	Key string `protobuf:"bytes,1" json:"key,omitempty"`
+
+	// A hash of the request body, so a key can't be reused for a different request.
+	RequestHash string `protobuf:"bytes,2" json:"request_hash,omitempty"`
+
+	// The HTTP status of the original response, or 0 while it's in progress.
+	Status uint32 `protobuf:"varint,3" json:"status,omitempty"`
+
+	ContentType string `protobuf:"bytes,4" json:"content_type,omitempty"`
+
+	Body string `protobuf:"bytes,5" json:"body,omitempty"`
+
+	TtlSeconds time.Duration `protobuf:"zigzag64,6" json:"ttl_seconds,omitempty,string"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,7" json:"createdAt,omitempty,string"`
+}
+
+// GetKey is a nil-safe getter for field Key.
+func (x *IdempotencyRecord) GetKey() string {
+	if x == nil {
+		return ""
+	}
+	return x.Key
+}
+
+// GetRequestHash is a nil-safe getter for field RequestHash.
+func (x *IdempotencyRecord) GetRequestHash() string {
+	if x == nil {
+		return ""
+	}
+	return x.RequestHash
+}
+
+// GetStatus is a nil-safe getter for field Status.
+func (x *IdempotencyRecord) GetStatus() uint32 {
+	if x == nil {
+		return 0
+	}
+	return x.Status
+}
+
+// GetContentType is a nil-safe getter for field ContentType.
+func (x *IdempotencyRecord) GetContentType() string {
+	if x == nil {
+		return ""
+	}
+	return x.ContentType
+}
+
+// GetBody is a nil-safe getter for field Body.
+func (x *IdempotencyRecord) GetBody() string {
+	if x == nil {
+		return ""
+	}
+	return x.Body
+}
+
+// GetTtlSeconds is a nil-safe getter for field TtlSeconds.
+func (x *IdempotencyRecord) GetTtlSeconds() time.Duration {
+	if x == nil {
+		return 0
+	}
+	return x.TtlSeconds
+}
+
+// GetCreatedAt is a nil-safe getter for field CreatedAt.
+func (x *IdempotencyRecord) GetCreatedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.CreatedAt
+}
+
+// MarshalJSON implements a custom JSON marshaller for IdempotencyRecord.
+func (x IdempotencyRecord) MarshalJSON() ([]byte, error) {
+	type Alias IdempotencyRecord
+	aux := &struct {
+		*Alias
+		TtlSeconds int64 `json:"ttl_seconds,omitempty,string"`
+		CreatedAt  int64 `json:"createdAt,omitempty,string"`
+	}{
+		Alias:      (*Alias)(&x),
+		TtlSeconds: int64(x.TtlSeconds.Seconds()),
+		CreatedAt:  int64(x.CreatedAt.UnixMilli()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for IdempotencyRecord.
+func (x *IdempotencyRecord) UnmarshalJSON(data []byte) error {
+	type Alias IdempotencyRecord
+	aux := &struct {
+		*Alias
+		TtlSeconds int64 `json:"ttl_seconds,omitempty,string"`
+		CreatedAt  int64 `json:"createdAt,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.TtlSeconds = time.Duration(aux.TtlSeconds) * time.Second
+	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *IdempotencyRecord) StatelyItemType() string {
+	return "IdempotencyRecord"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *IdempotencyRecord) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *IdempotencyRecord) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/idem-:key` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *IdempotencyRecord) KeyPath() string {
+	return "/idem-" + stately.ToKeyID(x.GetKey())
+}
+
 // A "lease" gives users temporary access to a resource.
 //
-// Lease items can be accessed via the following key paths:
-// * /user-:user_id/res-:resource_id/lease-:id
-// * /res-:resource_id/lease-:id
-// * /lease-:id
-type Lease struct {
-	// A unique identifier for the lease itself.
+// Lease items can be accessed via the following key paths:
+// * /user-:user_id/res-:resource_id/lease-:id
+// * /res-:resource_id/lease-:id
+// * /lease-:id
+type Lease struct {
+	// A unique identifier for the lease itself.
+	Id uuid.UUID `protobuf:"bytes,1" json:"id,omitempty"`
+
+	// The user that this lease is granted to.
+	UserId uuid.UUID `protobuf:"bytes,2" json:"user_id,omitempty"`
+
+	// The resource this lease grants access to.
+	ResourceId uuid.UUID `protobuf:"bytes,3" json:"resource_id,omitempty"`
+
+	// Allow the user to specify why they needed the lease.
+	Reason string `protobuf:"bytes,4" json:"reason,omitempty"`
+
+	// How long is this lease for? This is measured from when the lease was last modified.
+	DurationSeconds time.Duration `protobuf:"zigzag64,5" json:"duration_seconds,omitempty,string"`
+
+	// Last touch time allows us to extend a lease by updating it.
+	LastTouched time.Time `protobuf:"zigzag64,6" json:"lastTouched,omitempty,string"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,7" json:"createdAt,omitempty,string"`
+
+	// Who has approved this? The lease is not considered valid until approved by another person.
+	Approver uuid.UUID `protobuf:"bytes,8" json:"approver,omitempty"`
+
+	// Who denied this lease, if it was denied. A denied lease never becomes valid.
+	DeniedBy uuid.UUID `protobuf:"bytes,9" json:"denied_by,omitempty"`
+
+	// The approver's comment when approving or denying the lease.
+	DecisionComment string `protobuf:"bytes,10" json:"decision_comment,omitempty"`
+
+	// Break-glass leases skip approval, and are reviewed afterwards instead.
+	Emergency bool `protobuf:"varint,11" json:"emergency,omitempty"`
+
+	// The incident a break-glass lease was taken for.
+	IncidentRef string `protobuf:"bytes,12" json:"incident_ref,omitempty"`
+
+	// Set on leases requested together from a template. They share one
+	// approval: deciding any of them decides them all.
+	BundleId uuid.UUID `protobuf:"bytes,13" json:"bundle_id,omitempty"`
+}
+
+// GetId is a nil-safe getter for field Id.
+func (x *Lease) GetId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.Id
+}
+
+// GetUserId is a nil-safe getter for field UserId.
+func (x *Lease) GetUserId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.UserId
+}
+
+// GetResourceId is a nil-safe getter for field ResourceId.
+func (x *Lease) GetResourceId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.ResourceId
+}
+
+// GetReason is a nil-safe getter for field Reason.
+func (x *Lease) GetReason() string {
+	if x == nil {
+		return ""
+	}
+	return x.Reason
+}
+
+// GetDurationSeconds is a nil-safe getter for field DurationSeconds.
+func (x *Lease) GetDurationSeconds() time.Duration {
+	if x == nil {
+		return 0
+	}
+	return x.DurationSeconds
+}
+
+// GetLastTouched is a nil-safe getter for field LastTouched.
+func (x *Lease) GetLastTouched() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.LastTouched
+}
+
+// GetCreatedAt is a nil-safe getter for field CreatedAt.
+func (x *Lease) GetCreatedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.CreatedAt
+}
+
+// GetApprover is a nil-safe getter for field Approver.
+func (x *Lease) GetApprover() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.Approver
+}
+
+// GetDeniedBy is a nil-safe getter for field DeniedBy.
+func (x *Lease) GetDeniedBy() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.DeniedBy
+}
+
+// GetDecisionComment is a nil-safe getter for field DecisionComment.
+func (x *Lease) GetDecisionComment() string {
+	if x == nil {
+		return ""
+	}
+	return x.DecisionComment
+}
+
+// GetEmergency is a nil-safe getter for field Emergency.
+func (x *Lease) GetEmergency() bool {
+	if x == nil {
+		return false
+	}
+	return x.Emergency
+}
+
+// GetIncidentRef is a nil-safe getter for field IncidentRef.
+func (x *Lease) GetIncidentRef() string {
+	if x == nil {
+		return ""
+	}
+	return x.IncidentRef
+}
+
+// GetBundleId is a nil-safe getter for field BundleId.
+func (x *Lease) GetBundleId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.BundleId
+}
+
+// MarshalJSON implements a custom JSON marshaller for Lease.
+func (x Lease) MarshalJSON() ([]byte, error) {
+	type Alias Lease
+	aux := &struct {
+		*Alias
+		Id              []byte `json:"id,omitempty"`
+		UserId          []byte `json:"user_id,omitempty"`
+		ResourceId      []byte `json:"resource_id,omitempty"`
+		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
+		LastTouched     int64  `json:"lastTouched,omitempty,string"`
+		CreatedAt       int64  `json:"createdAt,omitempty,string"`
+		Approver        []byte `json:"approver,omitempty"`
+		DeniedBy        []byte `json:"denied_by,omitempty"`
+		BundleId        []byte `json:"bundle_id,omitempty"`
+	}{
+		Alias:           (*Alias)(&x),
+		Id:              uuidToBinary(x.Id),
+		UserId:          uuidToBinary(x.UserId),
+		ResourceId:      uuidToBinary(x.ResourceId),
+		DurationSeconds: int64(x.DurationSeconds.Seconds()),
+		LastTouched:     int64(x.LastTouched.UnixMilli()),
+		CreatedAt:       int64(x.CreatedAt.UnixMilli()),
+		Approver:        uuidToBinary(x.Approver),
+		DeniedBy:        uuidToBinary(x.DeniedBy),
+		BundleId:        uuidToBinary(x.BundleId),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for Lease.
+func (x *Lease) UnmarshalJSON(data []byte) error {
+	type Alias Lease
+	aux := &struct {
+		*Alias
+		Id              []byte `json:"id,omitempty"`
+		UserId          []byte `json:"user_id,omitempty"`
+		ResourceId      []byte `json:"resource_id,omitempty"`
+		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
+		LastTouched     int64  `json:"lastTouched,omitempty,string"`
+		CreatedAt       int64  `json:"createdAt,omitempty,string"`
+		Approver        []byte `json:"approver,omitempty"`
+		DeniedBy        []byte `json:"denied_by,omitempty"`
+		BundleId        []byte `json:"bundle_id,omitempty"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.Id = binaryToUUID(aux.Id)
+	x.UserId = binaryToUUID(aux.UserId)
+	x.ResourceId = binaryToUUID(aux.ResourceId)
+	x.DurationSeconds = time.Duration(aux.DurationSeconds) * time.Second
+	x.LastTouched = time.UnixMilli(int64(aux.LastTouched))
+	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
+	x.Approver = binaryToUUID(aux.Approver)
+	x.DeniedBy = binaryToUUID(aux.DeniedBy)
+	x.BundleId = binaryToUUID(aux.BundleId)
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *Lease) StatelyItemType() string {
+	return "Lease"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *Lease) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *Lease) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/user-:user_id/res-:resource_id/lease-:id` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *Lease) KeyPath() string {
+	return "/user-" + stately.ToKeyID([16]byte(x.GetUserId())) +
+		"/res-" + stately.ToKeyID([16]byte(x.GetResourceId())) +
+		"/lease-" + stately.ToKeyID([16]byte(x.GetId()))
+}
+
+// A record of a lease granting access, kept for access reports. It's written
+// in the transaction that approves (or breaks glass for) the lease, its
+// ends_at is updated whenever the lease is extended or revoked, and unlike
+// the lease it never expires.
+//
+// LeaseGrant items can be accessed via the following key paths:
+// * /res-:resource_id/grant-:lease_id
+// * /user-:user_id/grant-:lease_id
+type LeaseGrant struct {
+	LeaseId uuid.UUID `protobuf:"bytes,1" json:"lease_id,omitempty"`
+
+	ResourceId uuid.UUID `protobuf:"bytes,2" json:"resource_id,omitempty"`
+
+	UserId uuid.UUID `protobuf:"bytes,3" json:"user_id,omitempty"`
+
+	// Who approved the lease. Unset for break-glass leases.
+	Approver uuid.UUID `protobuf:"bytes,4" json:"approver,omitempty"`
+
+	Emergency bool `protobuf:"varint,5" json:"emergency,omitempty"`
+
+	GrantedAt time.Time `protobuf:"zigzag64,6" json:"granted_at,omitempty,string"`
+
+	// When the lease stops (or stopped) granting access. Unset if it has no
+	// duration and hasn't been revoked.
+	EndsAt time.Time `protobuf:"zigzag64,7" json:"ends_at,omitempty,string"`
+}
+
+// GetLeaseId is a nil-safe getter for field LeaseId.
+func (x *LeaseGrant) GetLeaseId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.LeaseId
+}
+
+// GetResourceId is a nil-safe getter for field ResourceId.
+func (x *LeaseGrant) GetResourceId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.ResourceId
+}
+
+// GetUserId is a nil-safe getter for field UserId.
+func (x *LeaseGrant) GetUserId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.UserId
+}
+
+// GetApprover is a nil-safe getter for field Approver.
+func (x *LeaseGrant) GetApprover() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.Approver
+}
+
+// GetEmergency is a nil-safe getter for field Emergency.
+func (x *LeaseGrant) GetEmergency() bool {
+	if x == nil {
+		return false
+	}
+	return x.Emergency
+}
+
+// GetGrantedAt is a nil-safe getter for field GrantedAt.
+func (x *LeaseGrant) GetGrantedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.GrantedAt
+}
+
+// GetEndsAt is a nil-safe getter for field EndsAt.
+func (x *LeaseGrant) GetEndsAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.EndsAt
+}
+
+// MarshalJSON implements a custom JSON marshaller for LeaseGrant.
+func (x LeaseGrant) MarshalJSON() ([]byte, error) {
+	type Alias LeaseGrant
+	aux := &struct {
+		*Alias
+		LeaseId    []byte `json:"lease_id,omitempty"`
+		ResourceId []byte `json:"resource_id,omitempty"`
+		UserId     []byte `json:"user_id,omitempty"`
+		Approver   []byte `json:"approver,omitempty"`
+		GrantedAt  int64  `json:"granted_at,omitempty,string"`
+		EndsAt     int64  `json:"ends_at,omitempty,string"`
+	}{
+		Alias:      (*Alias)(&x),
+		LeaseId:    uuidToBinary(x.LeaseId),
+		ResourceId: uuidToBinary(x.ResourceId),
+		UserId:     uuidToBinary(x.UserId),
+		Approver:   uuidToBinary(x.Approver),
+		GrantedAt:  int64(x.GrantedAt.UnixMilli()),
+		EndsAt:     int64(x.EndsAt.UnixMilli()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for LeaseGrant.
+func (x *LeaseGrant) UnmarshalJSON(data []byte) error {
+	type Alias LeaseGrant
+	aux := &struct {
+		*Alias
+		LeaseId    []byte `json:"lease_id,omitempty"`
+		ResourceId []byte `json:"resource_id,omitempty"`
+		UserId     []byte `json:"user_id,omitempty"`
+		Approver   []byte `json:"approver,omitempty"`
+		GrantedAt  int64  `json:"granted_at,omitempty,string"`
+		EndsAt     int64  `json:"ends_at,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.LeaseId = binaryToUUID(aux.LeaseId)
+	x.ResourceId = binaryToUUID(aux.ResourceId)
+	x.UserId = binaryToUUID(aux.UserId)
+	x.Approver = binaryToUUID(aux.Approver)
+	x.GrantedAt = time.UnixMilli(int64(aux.GrantedAt))
+	x.EndsAt = time.UnixMilli(int64(aux.EndsAt))
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *LeaseGrant) StatelyItemType() string {
+	return "LeaseGrant"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *LeaseGrant) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *LeaseGrant) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/res-:resource_id/grant-:lease_id` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *LeaseGrant) KeyPath() string {
+	return "/res-" + stately.ToKeyID([16]byte(x.GetResourceId())) +
+		"/grant-" + stately.ToKeyID([16]byte(x.GetLeaseId()))
+}
+
+// Lists a lease under one of the indexes lease search uses, e.g.
+// "state:pending", "approver:<id>", "expires:<hour>", "created:<day>" or
+// "reason:<word>". Entries are written and removed in the same transactions
+// as the lease, and expire with it.
+//
+// LeaseIndexEntry items can be accessed via the following key paths:
+// * /lease_index-:index/lease-:lease_id
+type LeaseIndexEntry struct {
+	Index string `protobuf:"bytes,1" json:"index,omitempty"`
+
+	LeaseId uuid.UUID `protobuf:"bytes,2" json:"lease_id,omitempty"`
+
+	DurationSeconds time.Duration `protobuf:"zigzag64,3" json:"duration_seconds,omitempty,string"`
+}
+
+// GetIndex is a nil-safe getter for field Index.
+func (x *LeaseIndexEntry) GetIndex() string {
+	if x == nil {
+		return ""
+	}
+	return x.Index
+}
+
+// GetLeaseId is a nil-safe getter for field LeaseId.
+func (x *LeaseIndexEntry) GetLeaseId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.LeaseId
+}
+
+// GetDurationSeconds is a nil-safe getter for field DurationSeconds.
+func (x *LeaseIndexEntry) GetDurationSeconds() time.Duration {
+	if x == nil {
+		return 0
+	}
+	return x.DurationSeconds
+}
+
+// MarshalJSON implements a custom JSON marshaller for LeaseIndexEntry.
+func (x LeaseIndexEntry) MarshalJSON() ([]byte, error) {
+	type Alias LeaseIndexEntry
+	aux := &struct {
+		*Alias
+		LeaseId         []byte `json:"lease_id,omitempty"`
+		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
+	}{
+		Alias:           (*Alias)(&x),
+		LeaseId:         uuidToBinary(x.LeaseId),
+		DurationSeconds: int64(x.DurationSeconds.Seconds()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for LeaseIndexEntry.
+func (x *LeaseIndexEntry) UnmarshalJSON(data []byte) error {
+	type Alias LeaseIndexEntry
+	aux := &struct {
+		*Alias
+		LeaseId         []byte `json:"lease_id,omitempty"`
+		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.LeaseId = binaryToUUID(aux.LeaseId)
+	x.DurationSeconds = time.Duration(aux.DurationSeconds) * time.Second
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *LeaseIndexEntry) StatelyItemType() string {
+	return "LeaseIndexEntry"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *LeaseIndexEntry) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *LeaseIndexEntry) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/lease_index-:index/lease-:lease_id` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *LeaseIndexEntry) KeyPath() string {
+	return "/lease_index-" + stately.ToKeyID(x.GetIndex()) +
+		"/lease-" + stately.ToKeyID([16]byte(x.GetLeaseId()))
+}
+
+// A named bundle of resources that are commonly leased together, e.g. the
+// database, logs and dashboards an on-call engineer needs. Requesting it
+// creates a lease on each resource in one transaction.
+//
+// LeaseTemplate items can be accessed via the following key paths:
+// * /template-:name
+type LeaseTemplate struct {
+	Name string `protobuf:"bytes,1" json:"name,omitempty"`
+
+	Description string `protobuf:"bytes,2" json:"description,omitempty"`
+
+	// The names of the resources to lease.
+	Resources []string `protobuf:"bytes,3,rep" json:"resources,omitempty"`
+
+	// How long each lease lasts, unless the request says otherwise.
+	DurationSeconds time.Duration `protobuf:"zigzag64,4" json:"duration_seconds,omitempty,string"`
+
+	// The reason given for each lease, unless the request says otherwise.
+	Reason string `protobuf:"bytes,5" json:"reason,omitempty"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,6" json:"createdAt,omitempty,string"`
+
+	LastModified time.Time `protobuf:"zigzag64,7" json:"lastModified,omitempty,string"`
+}
+
+// GetName is a nil-safe getter for field Name.
+func (x *LeaseTemplate) GetName() string {
+	if x == nil {
+		return ""
+	}
+	return x.Name
+}
+
+// GetDescription is a nil-safe getter for field Description.
+func (x *LeaseTemplate) GetDescription() string {
+	if x == nil {
+		return ""
+	}
+	return x.Description
+}
+
+// GetResources is a nil-safe getter for field Resources.
+func (x *LeaseTemplate) GetResources() []string {
+	if x == nil {
+		return nil
+	}
+	return x.Resources
+}
+
+// GetDurationSeconds is a nil-safe getter for field DurationSeconds.
+func (x *LeaseTemplate) GetDurationSeconds() time.Duration {
+	if x == nil {
+		return 0
+	}
+	return x.DurationSeconds
+}
+
+// GetReason is a nil-safe getter for field Reason.
+func (x *LeaseTemplate) GetReason() string {
+	if x == nil {
+		return ""
+	}
+	return x.Reason
+}
+
+// GetCreatedAt is a nil-safe getter for field CreatedAt.
+func (x *LeaseTemplate) GetCreatedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.CreatedAt
+}
+
+// GetLastModified is a nil-safe getter for field LastModified.
+func (x *LeaseTemplate) GetLastModified() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.LastModified
+}
+
+// MarshalJSON implements a custom JSON marshaller for LeaseTemplate.
+func (x LeaseTemplate) MarshalJSON() ([]byte, error) {
+	type Alias LeaseTemplate
+	aux := &struct {
+		*Alias
+		DurationSeconds int64 `json:"duration_seconds,omitempty,string"`
+		CreatedAt       int64 `json:"createdAt,omitempty,string"`
+		LastModified    int64 `json:"lastModified,omitempty,string"`
+	}{
+		Alias:           (*Alias)(&x),
+		DurationSeconds: int64(x.DurationSeconds.Seconds()),
+		CreatedAt:       int64(x.CreatedAt.UnixMilli()),
+		LastModified:    int64(x.LastModified.UnixMilli()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for LeaseTemplate.
+func (x *LeaseTemplate) UnmarshalJSON(data []byte) error {
+	type Alias LeaseTemplate
+	aux := &struct {
+		*Alias
+		DurationSeconds int64 `json:"duration_seconds,omitempty,string"`
+		CreatedAt       int64 `json:"createdAt,omitempty,string"`
+		LastModified    int64 `json:"lastModified,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.DurationSeconds = time.Duration(aux.DurationSeconds) * time.Second
+	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
+	x.LastModified = time.UnixMilli(int64(aux.LastModified))
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *LeaseTemplate) StatelyItemType() string {
+	return "LeaseTemplate"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *LeaseTemplate) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *LeaseTemplate) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/template-:name` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *LeaseTemplate) KeyPath() string {
+	return "/template-" + stately.ToKeyID(x.GetName())
+}
+
+// Indexes a lease that's waiting for approval under the owner of its
+// resource, so owners can list what's waiting for them. It's written and
+// removed in the same transactions as the lease, and expires with it.
+//
+// PendingApproval items can be accessed via the following key paths:
+// * /approver-:owner_id/pending-:lease_id
+type PendingApproval struct {
+	OwnerId uuid.UUID `protobuf:"bytes,1" json:"owner_id,omitempty"`
+
+	LeaseId uuid.UUID `protobuf:"bytes,2" json:"lease_id,omitempty"`
+
+	UserId uuid.UUID `protobuf:"bytes,3" json:"user_id,omitempty"`
+
+	ResourceId uuid.UUID `protobuf:"bytes,4" json:"resource_id,omitempty"`
+
+	DurationSeconds time.Duration `protobuf:"zigzag64,5" json:"duration_seconds,omitempty,string"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,6" json:"createdAt,omitempty,string"`
+}
+
+// GetOwnerId is a nil-safe getter for field OwnerId.
+func (x *PendingApproval) GetOwnerId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.OwnerId
+}
+
+// GetLeaseId is a nil-safe getter for field LeaseId.
+func (x *PendingApproval) GetLeaseId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.LeaseId
+}
+
+// GetUserId is a nil-safe getter for field UserId.
+func (x *PendingApproval) GetUserId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.UserId
+}
+
+// GetResourceId is a nil-safe getter for field ResourceId.
+func (x *PendingApproval) GetResourceId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.ResourceId
+}
+
+// GetDurationSeconds is a nil-safe getter for field DurationSeconds.
+func (x *PendingApproval) GetDurationSeconds() time.Duration {
+	if x == nil {
+		return 0
+	}
+	return x.DurationSeconds
+}
+
+// GetCreatedAt is a nil-safe getter for field CreatedAt.
+func (x *PendingApproval) GetCreatedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.CreatedAt
+}
+
+// MarshalJSON implements a custom JSON marshaller for PendingApproval.
+func (x PendingApproval) MarshalJSON() ([]byte, error) {
+	type Alias PendingApproval
+	aux := &struct {
+		*Alias
+		OwnerId         []byte `json:"owner_id,omitempty"`
+		LeaseId         []byte `json:"lease_id,omitempty"`
+		UserId          []byte `json:"user_id,omitempty"`
+		ResourceId      []byte `json:"resource_id,omitempty"`
+		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
+		CreatedAt       int64  `json:"createdAt,omitempty,string"`
+	}{
+		Alias:           (*Alias)(&x),
+		OwnerId:         uuidToBinary(x.OwnerId),
+		LeaseId:         uuidToBinary(x.LeaseId),
+		UserId:          uuidToBinary(x.UserId),
+		ResourceId:      uuidToBinary(x.ResourceId),
+		DurationSeconds: int64(x.DurationSeconds.Seconds()),
+		CreatedAt:       int64(x.CreatedAt.UnixMilli()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for PendingApproval.
+func (x *PendingApproval) UnmarshalJSON(data []byte) error {
+	type Alias PendingApproval
+	aux := &struct {
+		*Alias
+		OwnerId         []byte `json:"owner_id,omitempty"`
+		LeaseId         []byte `json:"lease_id,omitempty"`
+		UserId          []byte `json:"user_id,omitempty"`
+		ResourceId      []byte `json:"resource_id,omitempty"`
+		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
+		CreatedAt       int64  `json:"createdAt,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.OwnerId = binaryToUUID(aux.OwnerId)
+	x.LeaseId = binaryToUUID(aux.LeaseId)
+	x.UserId = binaryToUUID(aux.UserId)
+	x.ResourceId = binaryToUUID(aux.ResourceId)
+	x.DurationSeconds = time.Duration(aux.DurationSeconds) * time.Second
+	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *PendingApproval) StatelyItemType() string {
+	return "PendingApproval"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *PendingApproval) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *PendingApproval) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/approver-:owner_id/pending-:lease_id` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *PendingApproval) KeyPath() string {
+	return "/approver-" + stately.ToKeyID([16]byte(x.GetOwnerId())) +
+		"/pending-" + stately.ToKeyID([16]byte(x.GetLeaseId()))
+}
+
+// A system is a resource that users can access.
+//
+// Resource items can be accessed via the following key paths:
+// * /res-:id
+type Resource struct {
+	Id uuid.UUID `protobuf:"bytes,1" json:"id,omitempty"`
+
+	Name string `protobuf:"bytes,2" json:"name,omitempty"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,3" json:"createdAt,omitempty,string"`
+
+	// The user who approves leases for this resource. If unset, anyone but the lease's user can.
+	OwnerId uuid.UUID `protobuf:"bytes,4" json:"owner_id,omitempty"`
+}
+
+// GetId is a nil-safe getter for field Id.
+func (x *Resource) GetId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.Id
+}
+
+// GetName is a nil-safe getter for field Name.
+func (x *Resource) GetName() string {
+	if x == nil {
+		return ""
+	}
+	return x.Name
+}
+
+// GetCreatedAt is a nil-safe getter for field CreatedAt.
+func (x *Resource) GetCreatedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.CreatedAt
+}
+
+// GetOwnerId is a nil-safe getter for field OwnerId.
+func (x *Resource) GetOwnerId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.OwnerId
+}
+
+// MarshalJSON implements a custom JSON marshaller for Resource.
+func (x Resource) MarshalJSON() ([]byte, error) {
+	type Alias Resource
+	aux := &struct {
+		*Alias
+		Id        []byte `json:"id,omitempty"`
+		CreatedAt int64  `json:"createdAt,omitempty,string"`
+		OwnerId   []byte `json:"owner_id,omitempty"`
+	}{
+		Alias:     (*Alias)(&x),
+		Id:        uuidToBinary(x.Id),
+		CreatedAt: int64(x.CreatedAt.UnixMilli()),
+		OwnerId:   uuidToBinary(x.OwnerId),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for Resource.
+func (x *Resource) UnmarshalJSON(data []byte) error {
+	type Alias Resource
+	aux := &struct {
+		*Alias
+		Id        []byte `json:"id,omitempty"`
+		CreatedAt int64  `json:"createdAt,omitempty,string"`
+		OwnerId   []byte `json:"owner_id,omitempty"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.Id = binaryToUUID(aux.Id)
+	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
+	x.OwnerId = binaryToUUID(aux.OwnerId)
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *Resource) StatelyItemType() string {
+	return "Resource"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *Resource) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *Resource) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/res-:id` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *Resource) KeyPath() string {
+	return "/res-" + stately.ToKeyID([16]byte(x.GetId()))
+}
+
+// Claims a resource name, so that names are unique and resources can be
+// looked up by them. It's written in the same transaction as the resource.
+// Resources created before names were claimed don't have one until
+// `demo-w resource claim-names` is run.
+//
+// ResourceName items can be accessed via the following key paths:
+// * /res_name-:name
+type ResourceName struct {
+	Name string `protobuf:"bytes,1" json:"name,omitempty"`
+
+	ResourceId uuid.UUID `protobuf:"bytes,2" json:"resource_id,omitempty"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,3" json:"createdAt,omitempty,string"`
+}
+
+// GetName is a nil-safe getter for field Name.
+func (x *ResourceName) GetName() string {
+	if x == nil {
+		return ""
+	}
+	return x.Name
+}
+
+// GetResourceId is a nil-safe getter for field ResourceId.
+func (x *ResourceName) GetResourceId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.ResourceId
+}
+
+// GetCreatedAt is a nil-safe getter for field CreatedAt.
+func (x *ResourceName) GetCreatedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.CreatedAt
+}
+
+// MarshalJSON implements a custom JSON marshaller for ResourceName.
+func (x ResourceName) MarshalJSON() ([]byte, error) {
+	type Alias ResourceName
+	aux := &struct {
+		*Alias
+		ResourceId []byte `json:"resource_id,omitempty"`
+		CreatedAt  int64  `json:"createdAt,omitempty,string"`
+	}{
+		Alias:      (*Alias)(&x),
+		ResourceId: uuidToBinary(x.ResourceId),
+		CreatedAt:  int64(x.CreatedAt.UnixMilli()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for ResourceName.
+func (x *ResourceName) UnmarshalJSON(data []byte) error {
+	type Alias ResourceName
+	aux := &struct {
+		*Alias
+		ResourceId []byte `json:"resource_id,omitempty"`
+		CreatedAt  int64  `json:"createdAt,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.ResourceId = binaryToUUID(aux.ResourceId)
+	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *ResourceName) StatelyItemType() string {
+	return "ResourceName"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *ResourceName) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *ResourceName) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/res_name-:name` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *ResourceName) KeyPath() string {
+	return "/res_name-" + stately.ToKeyID(x.GetName())
+}
+
+// A lease that has been requested for a future maintenance window. It doesn't
+// grant any access by itself - once start_at passes it is converted into a real
+// Lease, which is when the lease's TTL starts counting down.
+//
+// ScheduledLease items can be accessed via the following key paths:
+// * /user-:user_id/res-:resource_id/sched-:id
+// * /res-:resource_id/sched-:id
+// * /sched-:id
+type ScheduledLease struct {
+	// The ID of the scheduled lease. The activated Lease keeps the same ID.
 	Id uuid.UUID `protobuf:"bytes,1" json:"id,omitempty"`
 
-	// The user that this lease is granted to.
+	// The user that this lease will be granted to.
 	UserId uuid.UUID `protobuf:"bytes,2" json:"user_id,omitempty"`
 
-	// The resource this lease grants access to.
+	// The resource this lease will grant access to.
 	ResourceId uuid.UUID `protobuf:"bytes,3" json:"resource_id,omitempty"`
 
-	// Allow the user to specify why they needed the lease.
 	Reason string `protobuf:"bytes,4" json:"reason,omitempty"`
 
-	// How long is this lease for? This is measured from when the lease was last modified.
-	DurationSeconds time.Duration `protobuf:"zigzag64,5" json:"duration_seconds,omitempty,string"`
+	Approver uuid.UUID `protobuf:"bytes,5" json:"approver,omitempty"`
 
-	// Last touch time allows us to extend a lease by updating it.
-	LastTouched time.Time `protobuf:"zigzag64,6" json:"lastTouched,omitempty,string"`
+	// How long the lease lasts once it has been activated.
+	DurationSeconds time.Duration `protobuf:"zigzag64,6" json:"duration_seconds,omitempty,string"`
 
-	CreatedAt time.Time `protobuf:"zigzag64,7" json:"createdAt,omitempty,string"`
+	// When the lease should become active.
+	StartAt time.Time `protobuf:"zigzag64,7" json:"start_at,omitempty,string"`
 
-	// Who has approved this? The lease is not considered valid until approved by another person.
-	Approver uuid.UUID `protobuf:"bytes,8" json:"approver,omitempty"`
+	CreatedAt time.Time `protobuf:"zigzag64,8" json:"createdAt,omitempty,string"`
 }
 
 // GetId is a nil-safe getter for field Id.
-func (x *Lease) GetId() uuid.UUID {
+func (x *ScheduledLease) GetId() uuid.UUID {
 	if x == nil {
 		return uuid.Nil
 	}
@@ -51,7 +1817,7 @@ func (x *Lease) GetId() uuid.UUID {
 }
 
 // GetUserId is a nil-safe getter for field UserId.
-func (x *Lease) GetUserId() uuid.UUID {
+func (x *ScheduledLease) GetUserId() uuid.UUID {
 	if x == nil {
 		return uuid.Nil
 	}
@@ -59,7 +1825,7 @@ func (x *Lease) GetUserId() uuid.UUID {
 }
 
 // GetResourceId is a nil-safe getter for field ResourceId.
-func (x *Lease) GetResourceId() uuid.UUID {
+func (x *ScheduledLease) GetResourceId() uuid.UUID {
 	if x == nil {
 		return uuid.Nil
 	}
@@ -67,82 +1833,82 @@ func (x *Lease) GetResourceId() uuid.UUID {
 }
 
 // GetReason is a nil-safe getter for field Reason.
-func (x *Lease) GetReason() string {
+func (x *ScheduledLease) GetReason() string {
 	if x == nil {
 		return ""
 	}
 	return x.Reason
 }
 
+// GetApprover is a nil-safe getter for field Approver.
+func (x *ScheduledLease) GetApprover() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.Approver
+}
+
 // GetDurationSeconds is a nil-safe getter for field DurationSeconds.
-func (x *Lease) GetDurationSeconds() time.Duration {
+func (x *ScheduledLease) GetDurationSeconds() time.Duration {
 	if x == nil {
 		return 0
 	}
 	return x.DurationSeconds
 }
 
-// GetLastTouched is a nil-safe getter for field LastTouched.
-func (x *Lease) GetLastTouched() time.Time {
+// GetStartAt is a nil-safe getter for field StartAt.
+func (x *ScheduledLease) GetStartAt() time.Time {
 	if x == nil {
 		return time.Time{}
 	}
-	return x.LastTouched
+	return x.StartAt
 }
 
 // GetCreatedAt is a nil-safe getter for field CreatedAt.
-func (x *Lease) GetCreatedAt() time.Time {
+func (x *ScheduledLease) GetCreatedAt() time.Time {
 	if x == nil {
 		return time.Time{}
 	}
 	return x.CreatedAt
 }
 
-// GetApprover is a nil-safe getter for field Approver.
-func (x *Lease) GetApprover() uuid.UUID {
-	if x == nil {
-		return uuid.Nil
-	}
-	return x.Approver
-}
-
-// MarshalJSON implements a custom JSON marshaller for Lease.
-func (x Lease) MarshalJSON() ([]byte, error) {
-	type Alias Lease
+// MarshalJSON implements a custom JSON marshaller for ScheduledLease.
+func (x ScheduledLease) MarshalJSON() ([]byte, error) {
+	type Alias ScheduledLease
 	aux := &struct {
 		*Alias
 		Id              []byte `json:"id,omitempty"`
 		UserId          []byte `json:"user_id,omitempty"`
 		ResourceId      []byte `json:"resource_id,omitempty"`
+		Approver        []byte `json:"approver,omitempty"`
 		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
-		LastTouched     int64  `json:"lastTouched,omitempty,string"`
+		StartAt         int64  `json:"start_at,omitempty,string"`
 		CreatedAt       int64  `json:"createdAt,omitempty,string"`
-		Approver        []byte `json:"approver,omitempty"`
 	}{
 		Alias:           (*Alias)(&x),
 		Id:              uuidToBinary(x.Id),
 		UserId:          uuidToBinary(x.UserId),
 		ResourceId:      uuidToBinary(x.ResourceId),
+		Approver:        uuidToBinary(x.Approver),
 		DurationSeconds: int64(x.DurationSeconds.Seconds()),
-		LastTouched:     int64(x.LastTouched.UnixMilli()),
+		StartAt:         int64(x.StartAt.UnixMilli()),
 		CreatedAt:       int64(x.CreatedAt.UnixMilli()),
-		Approver:        uuidToBinary(x.Approver),
 	}
 	return json.Marshal(aux)
 }
 
-// UnmarshalJSON implements json.Unmarshaler for Lease.
-func (x *Lease) UnmarshalJSON(data []byte) error {
-	type Alias Lease
+// UnmarshalJSON implements json.Unmarshaler for ScheduledLease.
+func (x *ScheduledLease) UnmarshalJSON(data []byte) error {
+	type Alias ScheduledLease
 	aux := &struct {
 		*Alias
 		Id              []byte `json:"id,omitempty"`
 		UserId          []byte `json:"user_id,omitempty"`
 		ResourceId      []byte `json:"resource_id,omitempty"`
+		Approver        []byte `json:"approver,omitempty"`
 		DurationSeconds int64  `json:"duration_seconds,omitempty,string"`
-		LastTouched     int64  `json:"lastTouched,omitempty,string"`
+		StartAt         int64  `json:"start_at,omitempty,string"`
 		CreatedAt       int64  `json:"createdAt,omitempty,string"`
-		Approver        []byte `json:"approver,omitempty"`
 	}{Alias: (*Alias)(x)}
 
 	err := json.Unmarshal(data, &aux)
@@ -152,79 +1918,90 @@ func (x *Lease) UnmarshalJSON(data []byte) error {
 	x.Id = binaryToUUID(aux.Id)
 	x.UserId = binaryToUUID(aux.UserId)
 	x.ResourceId = binaryToUUID(aux.ResourceId)
+	x.Approver = binaryToUUID(aux.Approver)
 	x.DurationSeconds = time.Duration(aux.DurationSeconds) * time.Second
-	x.LastTouched = time.UnixMilli(int64(aux.LastTouched))
+	x.StartAt = time.UnixMilli(int64(aux.StartAt))
 	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
-	x.Approver = binaryToUUID(aux.Approver)
 	return nil
 }
 
 // StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
 // For usage, please refer to the stately.Item interface documentation.
-func (x *Lease) StatelyItemType() string {
-	return "Lease"
+func (x *ScheduledLease) StatelyItemType() string {
+	return "ScheduledLease"
 }
 
 // UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
 // For usage, please refer to the stately.Item interface documentation.
-func (x *Lease) UnmarshalStately(item *db.Item) error {
+func (x *ScheduledLease) UnmarshalStately(item *db.Item) error {
 	return x.Unmarshal(item.GetProto())
 }
 
 // MarshalStately is part of the stately.Item interface which is used by the golang SDK.
 // For usage, please refer to the stately.Item interface documentation.
-func (x *Lease) MarshalStately() (*db.Item, error) {
+func (x *ScheduledLease) MarshalStately() (*db.Item, error) {
 	return marshalStatelyItem(x, x.StatelyItemType())
 }
 
 // KeyPath constructs and returns the primary key for this ItemType,
-// based on the template `/user-:user_id/res-:resource_id/lease-:id` defined in schema.
+// based on the template `/user-:user_id/res-:resource_id/sched-:id` defined in schema.
 // Note: The key constructed here will only be valid if the required key fields are set.
-func (x *Lease) KeyPath() string {
+func (x *ScheduledLease) KeyPath() string {
 	return "/user-" + stately.ToKeyID([16]byte(x.GetUserId())) +
 		"/res-" + stately.ToKeyID([16]byte(x.GetResourceId())) +
-		"/lease-" + stately.ToKeyID([16]byte(x.GetId()))
+		"/sched-" + stately.ToKeyID([16]byte(x.GetId()))
 }
 
-// A system is a resource that users can access.
+// A basic User object
 //
-// Resource items can be accessed via the following key paths:
-// * /res-:id
-type Resource struct {
+// User items can be accessed via the following key paths:
+// * /user-:id
+// * /user_email-:email
+type User struct {
 	Id uuid.UUID `protobuf:"bytes,1" json:"id,omitempty"`
 
-	Name string `protobuf:"bytes,2" json:"name,omitempty"`
+	DisplayName string `protobuf:"bytes,2" json:"displayName,omitempty"`
 
-	CreatedAt time.Time `protobuf:"zigzag64,3" json:"createdAt,omitempty,string"`
+	Email string `protobuf:"bytes,3" json:"email,omitempty"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,4" json:"createdAt,omitempty,string"`
 }
 
 // GetId is a nil-safe getter for field Id.
-func (x *Resource) GetId() uuid.UUID {
+func (x *User) GetId() uuid.UUID {
 	if x == nil {
 		return uuid.Nil
 	}
 	return x.Id
 }
 
-// GetName is a nil-safe getter for field Name.
-func (x *Resource) GetName() string {
+// GetDisplayName is a nil-safe getter for field DisplayName.
+func (x *User) GetDisplayName() string {
 	if x == nil {
 		return ""
 	}
-	return x.Name
+	return x.DisplayName
+}
+
+// GetEmail is a nil-safe getter for field Email.
+func (x *User) GetEmail() string {
+	if x == nil {
+		return ""
+	}
+	return x.Email
 }
 
 // GetCreatedAt is a nil-safe getter for field CreatedAt.
-func (x *Resource) GetCreatedAt() time.Time {
+func (x *User) GetCreatedAt() time.Time {
 	if x == nil {
 		return time.Time{}
 	}
 	return x.CreatedAt
 }
 
-// MarshalJSON implements a custom JSON marshaller for Resource.
-func (x Resource) MarshalJSON() ([]byte, error) {
-	type Alias Resource
+// MarshalJSON implements a custom JSON marshaller for User.
+func (x User) MarshalJSON() ([]byte, error) {
+	type Alias User
 	aux := &struct {
 		*Alias
 		Id        []byte `json:"id,omitempty"`
@@ -237,9 +2014,9 @@ func (x Resource) MarshalJSON() ([]byte, error) {
 	return json.Marshal(aux)
 }
 
-// UnmarshalJSON implements json.Unmarshaler for Resource.
-func (x *Resource) UnmarshalJSON(data []byte) error {
-	type Alias Resource
+// UnmarshalJSON implements json.Unmarshaler for User.
+func (x *User) UnmarshalJSON(data []byte) error {
+	type Alias User
 	aux := &struct {
 		*Alias
 		Id        []byte `json:"id,omitempty"`
@@ -257,79 +2034,242 @@ func (x *Resource) UnmarshalJSON(data []byte) error {
 
 // StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
 // For usage, please refer to the stately.Item interface documentation.
-func (x *Resource) StatelyItemType() string {
-	return "Resource"
+func (x *User) StatelyItemType() string {
+	return "User"
 }
 
 // UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
 // For usage, please refer to the stately.Item interface documentation.
-func (x *Resource) UnmarshalStately(item *db.Item) error {
+func (x *User) UnmarshalStately(item *db.Item) error {
 	return x.Unmarshal(item.GetProto())
 }
 
 // MarshalStately is part of the stately.Item interface which is used by the golang SDK.
 // For usage, please refer to the stately.Item interface documentation.
-func (x *Resource) MarshalStately() (*db.Item, error) {
+func (x *User) MarshalStately() (*db.Item, error) {
 	return marshalStatelyItem(x, x.StatelyItemType())
 }
 
 // KeyPath constructs and returns the primary key for this ItemType,
-// based on the template `/res-:id` defined in schema.
+// based on the template `/user-:id` defined in schema.
 // Note: The key constructed here will only be valid if the required key fields are set.
-func (x *Resource) KeyPath() string {
-	return "/res-" + stately.ToKeyID([16]byte(x.GetId()))
+func (x *User) KeyPath() string {
+	return "/user-" + stately.ToKeyID([16]byte(x.GetId()))
 }
 
-// A basic User object
+// A webhook delivery that still failed after every retry. It's kept so the
+// failure can be inspected and the payload replayed.
 //
-// User items can be accessed via the following key paths:
-// * /user-:id
-// * /user_email-:email
-type User struct {
+// WebhookDeadLetter items can be accessed via the following key paths:
+// * /webhook-:subscription_id/dead-:id
+type WebhookDeadLetter struct {
 	Id uuid.UUID `protobuf:"bytes,1" json:"id,omitempty"`
 
-	DisplayName string `protobuf:"bytes,2" json:"displayName,omitempty"`
+	SubscriptionId uuid.UUID `protobuf:"bytes,2" json:"subscription_id,omitempty"`
 
-	Email string `protobuf:"bytes,3" json:"email,omitempty"`
+	EventType string `protobuf:"bytes,3" json:"event_type,omitempty"`
 
-	CreatedAt time.Time `protobuf:"zigzag64,4" json:"createdAt,omitempty,string"`
+	// The exact JSON body we tried to deliver.
+	Payload string `protobuf:"bytes,4" json:"payload,omitempty"`
+
+	Attempts uint32 `protobuf:"varint,5" json:"attempts,omitempty"`
+
+	LastError string `protobuf:"bytes,6" json:"last_error,omitempty"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,7" json:"createdAt,omitempty,string"`
 }
 
 // GetId is a nil-safe getter for field Id.
-func (x *User) GetId() uuid.UUID {
+func (x *WebhookDeadLetter) GetId() uuid.UUID {
 	if x == nil {
 		return uuid.Nil
 	}
 	return x.Id
 }
 
-// GetDisplayName is a nil-safe getter for field DisplayName.
-func (x *User) GetDisplayName() string {
+// GetSubscriptionId is a nil-safe getter for field SubscriptionId.
+func (x *WebhookDeadLetter) GetSubscriptionId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.SubscriptionId
+}
+
+// GetEventType is a nil-safe getter for field EventType.
+func (x *WebhookDeadLetter) GetEventType() string {
 	if x == nil {
 		return ""
 	}
-	return x.DisplayName
+	return x.EventType
 }
 
-// GetEmail is a nil-safe getter for field Email.
-func (x *User) GetEmail() string {
+// GetPayload is a nil-safe getter for field Payload.
+func (x *WebhookDeadLetter) GetPayload() string {
 	if x == nil {
 		return ""
 	}
-	return x.Email
+	return x.Payload
+}
+
+// GetAttempts is a nil-safe getter for field Attempts.
+func (x *WebhookDeadLetter) GetAttempts() uint32 {
+	if x == nil {
+		return 0
+	}
+	return x.Attempts
+}
+
+// GetLastError is a nil-safe getter for field LastError.
+func (x *WebhookDeadLetter) GetLastError() string {
+	if x == nil {
+		return ""
+	}
+	return x.LastError
 }
 
 // GetCreatedAt is a nil-safe getter for field CreatedAt.
-func (x *User) GetCreatedAt() time.Time {
+func (x *WebhookDeadLetter) GetCreatedAt() time.Time {
 	if x == nil {
 		return time.Time{}
 	}
 	return x.CreatedAt
 }
 
-// MarshalJSON implements a custom JSON marshaller for User.
-func (x User) MarshalJSON() ([]byte, error) {
-	type Alias User
+// MarshalJSON implements a custom JSON marshaller for WebhookDeadLetter.
+func (x WebhookDeadLetter) MarshalJSON() ([]byte, error) {
+	type Alias WebhookDeadLetter
+	aux := &struct {
+		*Alias
+		Id             []byte `json:"id,omitempty"`
+		SubscriptionId []byte `json:"subscription_id,omitempty"`
+		CreatedAt      int64  `json:"createdAt,omitempty,string"`
+	}{
+		Alias:          (*Alias)(&x),
+		Id:             uuidToBinary(x.Id),
+		SubscriptionId: uuidToBinary(x.SubscriptionId),
+		CreatedAt:      int64(x.CreatedAt.UnixMilli()),
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for WebhookDeadLetter.
+func (x *WebhookDeadLetter) UnmarshalJSON(data []byte) error {
+	type Alias WebhookDeadLetter
+	aux := &struct {
+		*Alias
+		Id             []byte `json:"id,omitempty"`
+		SubscriptionId []byte `json:"subscription_id,omitempty"`
+		CreatedAt      int64  `json:"createdAt,omitempty,string"`
+	}{Alias: (*Alias)(x)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	x.Id = binaryToUUID(aux.Id)
+	x.SubscriptionId = binaryToUUID(aux.SubscriptionId)
+	x.CreatedAt = time.UnixMilli(int64(aux.CreatedAt))
+	return nil
+}
+
+// StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *WebhookDeadLetter) StatelyItemType() string {
+	return "WebhookDeadLetter"
+}
+
+// UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *WebhookDeadLetter) UnmarshalStately(item *db.Item) error {
+	return x.Unmarshal(item.GetProto())
+}
+
+// MarshalStately is part of the stately.Item interface which is used by the golang SDK.
+// For usage, please refer to the stately.Item interface documentation.
+func (x *WebhookDeadLetter) MarshalStately() (*db.Item, error) {
+	return marshalStatelyItem(x, x.StatelyItemType())
+}
+
+// KeyPath constructs and returns the primary key for this ItemType,
+// based on the template `/webhook-:subscription_id/dead-:id` defined in schema.
+// Note: The key constructed here will only be valid if the required key fields are set.
+func (x *WebhookDeadLetter) KeyPath() string {
+	return "/webhook-" + stately.ToKeyID([16]byte(x.GetSubscriptionId())) +
+		"/dead-" + stately.ToKeyID([16]byte(x.GetId()))
+}
+
+// An outbound webhook that lease lifecycle events are delivered to.
+//
+// WebhookSubscription items can be accessed via the following key paths:
+// * /webhook-:id
+type WebhookSubscription struct {
+	Id uuid.UUID `protobuf:"bytes,1" json:"id,omitempty"`
+
+	// Where events are POSTed.
+	Url string `protobuf:"bytes,2" json:"url,omitempty"`
+
+	// Shared secret used to sign each payload with HMAC-SHA256.
+	Secret string `protobuf:"bytes,3" json:"secret,omitempty"`
+
+	// Which event types to deliver, e.g. "lease.approved". Empty means every event.
+	Events []string `protobuf:"bytes,4,rep" json:"events,omitempty"`
+
+	Description string `protobuf:"bytes,5" json:"description,omitempty"`
+
+	CreatedAt time.Time `protobuf:"zigzag64,6" json:"createdAt,omitempty,string"`
+}
+
+// GetId is a nil-safe getter for field Id.
+func (x *WebhookSubscription) GetId() uuid.UUID {
+	if x == nil {
+		return uuid.Nil
+	}
+	return x.Id
+}
+
+// GetUrl is a nil-safe getter for field Url.
+func (x *WebhookSubscription) GetUrl() string {
+	if x == nil {
+		return ""
+	}
+	return x.Url
+}
+
+// GetSecret is a nil-safe getter for field Secret.
+func (x *WebhookSubscription) GetSecret() string {
+	if x == nil {
+		return ""
+	}
+	return x.Secret
+}
+
+// GetEvents is a nil-safe getter for field Events.
+func (x *WebhookSubscription) GetEvents() []string {
+	if x == nil {
+		return nil
+	}
+	return x.Events
+}
+
+// GetDescription is a nil-safe getter for field Description.
+func (x *WebhookSubscription) GetDescription() string {
+	if x == nil {
+		return ""
+	}
+	return x.Description
+}
+
+// GetCreatedAt is a nil-safe getter for field CreatedAt.
+func (x *WebhookSubscription) GetCreatedAt() time.Time {
+	if x == nil {
+		return time.Time{}
+	}
+	return x.CreatedAt
+}
+
+// MarshalJSON implements a custom JSON marshaller for WebhookSubscription.
+func (x WebhookSubscription) MarshalJSON() ([]byte, error) {
+	type Alias WebhookSubscription
 	aux := &struct {
 		*Alias
 		Id        []byte `json:"id,omitempty"`
@@ -342,9 +2282,9 @@ func (x User) MarshalJSON() ([]byte, error) {
 	return json.Marshal(aux)
 }
 
-// UnmarshalJSON implements json.Unmarshaler for User.
-func (x *User) UnmarshalJSON(data []byte) error {
-	type Alias User
+// UnmarshalJSON implements json.Unmarshaler for WebhookSubscription.
+func (x *WebhookSubscription) UnmarshalJSON(data []byte) error {
+	type Alias WebhookSubscription
 	aux := &struct {
 		*Alias
 		Id        []byte `json:"id,omitempty"`
@@ -362,27 +2302,27 @@ func (x *User) UnmarshalJSON(data []byte) error {
 
 // StatelyItemType is part of the stately.Item interface which is used by the golang SDK.
 // For usage, please refer to the stately.Item interface documentation.
-func (x *User) StatelyItemType() string {
-	return "User"
+func (x *WebhookSubscription) StatelyItemType() string {
+	return "WebhookSubscription"
 }
 
 // UnmarshalStately is part of the stately.Item interface which is used by the golang SDK.
 // For usage, please refer to the stately.Item interface documentation.
-func (x *User) UnmarshalStately(item *db.Item) error {
+func (x *WebhookSubscription) UnmarshalStately(item *db.Item) error {
 	return x.Unmarshal(item.GetProto())
 }
 
 // MarshalStately is part of the stately.Item interface which is used by the golang SDK.
 // For usage, please refer to the stately.Item interface documentation.
-func (x *User) MarshalStately() (*db.Item, error) {
+func (x *WebhookSubscription) MarshalStately() (*db.Item, error) {
 	return marshalStatelyItem(x, x.StatelyItemType())
 }
 
 // KeyPath constructs and returns the primary key for this ItemType,
-// based on the template `/user-:id` defined in schema.
+// based on the template `/webhook-:id` defined in schema.
 // Note: The key constructed here will only be valid if the required key fields are set.
-func (x *User) KeyPath() string {
-	return "/user-" + stately.ToKeyID([16]byte(x.GetId()))
+func (x *WebhookSubscription) KeyPath() string {
+	return "/webhook-" + stately.ToKeyID([16]byte(x.GetId()))
 }
 
 type marshallerIFace interface {
@@ -406,18 +2346,57 @@ func marshalStatelyItem(msg marshallerIFace, itemType string) (*db.Item, error)
 // into your SDK item types.
 //
 // Valid item types are:
+// *BundleMember
+// *Campaign
+// *CampaignItem
+// *EmergencyReview
+// *IdempotencyRecord
 // *Lease
+// *LeaseGrant
+// *LeaseIndexEntry
+// *LeaseTemplate
+// *PendingApproval
 // *Resource
+// *ResourceName
+// *ScheduledLease
 // *User
+// *WebhookDeadLetter
+// *WebhookSubscription
 func TypeMapper(item *db.Item) (stately.Item, error) {
 	var result stately.Item
 	switch item.ItemType {
+	case "BundleMember":
+		result = &BundleMember{}
+	case "Campaign":
+		result = &Campaign{}
+	case "CampaignItem":
+		result = &CampaignItem{}
+	case "EmergencyReview":
+		result = &EmergencyReview{}
+	case "IdempotencyRecord":
+		result = &IdempotencyRecord{}
 	case "Lease":
 		result = &Lease{}
+	case "LeaseGrant":
+		result = &LeaseGrant{}
+	case "LeaseIndexEntry":
+		result = &LeaseIndexEntry{}
+	case "LeaseTemplate":
+		result = &LeaseTemplate{}
+	case "PendingApproval":
+		result = &PendingApproval{}
 	case "Resource":
 		result = &Resource{}
+	case "ResourceName":
+		result = &ResourceName{}
+	case "ScheduledLease":
+		result = &ScheduledLease{}
 	case "User":
 		result = &User{}
+	case "WebhookDeadLetter":
+		result = &WebhookDeadLetter{}
+	case "WebhookSubscription":
+		result = &WebhookSubscription{}
 	default:
 		return nil, stately.UnknownItemTypeError{item.ItemType}
 	}
@@ -0,0 +1,96 @@
+// Package tracing sets up OpenTelemetry tracing for the service.
+//
+// The exporter is picked with the standard OTEL_TRACES_EXPORTER variable:
+//
+//   - "otlp" sends spans over OTLP/HTTP. The endpoint and headers come from
+//     the usual OTEL_EXPORTER_OTLP_* variables.
+//   - "stdout" prints spans as JSON, which is handy for local runs.
+//   - "none" (the default) doesn't record spans at all.
+//
+// Whatever the exporter, W3C trace context is propagated so that traces from
+// callers and callees still join up through this service.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "demo-w"
+	tracerName  = "github.com/StatelyCloud/demo-w"
+)
+
+// Attribute keys for store calls.
+const (
+	ItemTypeKey      = attribute.Key("demo_w.item_type")
+	KeyPathPrefixKey = attribute.Key("demo_w.key_path_prefix")
+	ResultCountKey   = attribute.Key("demo_w.result_count")
+)
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes any buffered spans and should be called before exiting.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name := os.Getenv("OTEL_TRACES_EXPORTER"); name {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q (want otlp, stdout or none)", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of any span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, marking it as failed if *err is set. It's meant to be
+// deferred with a pointer to a named error result.
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+// SetResultCount records how many items a call returned on the span in ctx.
+func SetResultCount(ctx context.Context, n int) {
+	trace.SpanFromContext(ctx).SetAttributes(ResultCountKey.Int(n))
+}
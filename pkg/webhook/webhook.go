@@ -0,0 +1,245 @@
+// Package webhook delivers lease events to subscribed HTTP endpoints.
+//
+// Each delivery is a POST of the JSON-encoded notify.Event, signed with the
+// subscription's secret:
+//
+//	X-Demo-W-Event:     lease.approved
+//	X-Demo-W-Delivery:  <unique ID, stable across retries>
+//	X-Demo-W-Timestamp: <unix seconds>
+//	X-Demo-W-Signature: sha256=<hex HMAC-SHA256 of "{timestamp}.{body}">
+//
+// Each subscription is delivered to independently, so one that's slow or down
+// doesn't hold up the others. Failed deliveries are retried with exponential
+// backoff. Once every attempt has failed, or if the dispatcher is stopped
+// while a delivery is still being retried, the payload is stored as a
+// WebhookDeadLetter.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/notify"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	EventHeader     = "X-Demo-W-Event"
+	DeliveryHeader  = "X-Demo-W-Delivery"
+	TimestampHeader = "X-Demo-W-Timestamp"
+	SignatureHeader = "X-Demo-W-Signature"
+)
+
+// deadLetterTimeout bounds how long writing a dead letter can hold up
+// shutdown.
+const deadLetterTimeout = 5 * time.Second
+
+var ErrQueueFull = errors.New("webhook queue is full")
+
+// Store is where subscriptions are read from and dead letters are written to.
+type Store interface {
+	ListWebhookSubscriptions(ctx context.Context) ([]*schema.WebhookSubscription, error)
+	PutWebhookDeadLetter(ctx context.Context, deadLetter *schema.WebhookDeadLetter) error
+}
+
+// Dispatcher is a notify.Notifier that queues events and delivers them to
+// every matching subscription in the background.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	queue  chan notify.Event
+
+	// MaxAttempts is how many times a delivery is tried before it's dead-lettered.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles for each retry.
+	Backoff time.Duration
+	// RefreshInterval is how long the list of subscriptions is cached for.
+	RefreshInterval time.Duration
+
+	// deliveries tracks the deliveries in progress, so Run can wait for them
+	// to finish (or dead-letter themselves) before returning.
+	deliveries sync.WaitGroup
+
+	mu          sync.Mutex
+	subs        []*schema.WebhookSubscription
+	refreshedAt time.Time
+}
+
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{
+		store:           store,
+		client:          &http.Client{Timeout: 10 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		queue:           make(chan notify.Event, 1000),
+		MaxAttempts:     5,
+		Backoff:         time.Second,
+		RefreshInterval: 30 * time.Second,
+	}
+}
+
+// Notify queues the event for delivery. It never blocks - if the queue is full
+// the event is dropped and ErrQueueFull is returned.
+func (d *Dispatcher) Notify(_ context.Context, event notify.Event) error {
+	select {
+	case d.queue <- event:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Run delivers queued events using the given number of workers, until ctx is
+// cancelled. Deliveries that are still being retried then are dead-lettered
+// before it returns.
+func (d *Dispatcher) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event := <-d.queue:
+					d.dispatch(ctx, event)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	d.deliveries.Wait()
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, event notify.Event) {
+	subs, err := d.subscriptions(ctx)
+	if err != nil {
+		log.Printf("Failed to load webhook subscriptions, dropping %s: %v", event.Type, err)
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s: %v", event.Type, err)
+		return
+	}
+	for _, sub := range subs {
+		if len(sub.Events) > 0 && !slices.Contains(sub.Events, string(event.Type)) {
+			continue
+		}
+		d.deliveries.Add(1)
+		go func() {
+			defer d.deliveries.Done()
+			d.deliver(ctx, sub, event.Type, payload)
+		}()
+	}
+}
+
+func (d *Dispatcher) subscriptions(ctx context.Context) ([]*schema.WebhookSubscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.subs != nil && time.Since(d.refreshedAt) < d.RefreshInterval {
+		return d.subs, nil
+	}
+	subs, err := d.store.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if subs == nil {
+		subs = []*schema.WebhookSubscription{}
+	}
+	d.subs = subs
+	d.refreshedAt = time.Now()
+	return subs, nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, sub *schema.WebhookSubscription, eventType notify.EventType, payload []byte) {
+	deliveryID := uuid.New()
+	backoff := d.Backoff
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		if err = d.post(ctx, sub, eventType, deliveryID, payload); err == nil {
+			return
+		}
+		if attempt >= d.MaxAttempts || !sleep(ctx, backoff) {
+			break
+		}
+		backoff *= 2
+	}
+
+	if ctx.Err() != nil {
+		err = fmt.Errorf("stopped before it could be retried: %w", err)
+	}
+	log.Printf("Webhook %s failed %d times, dead-lettering %s: %v", sub.Id, attempt, eventType, err)
+	// The dead letter is written even if we're shutting down, since
+	// that's when it's needed.
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deadLetterTimeout)
+	defer cancel()
+	if err := d.store.PutWebhookDeadLetter(storeCtx, &schema.WebhookDeadLetter{
+		SubscriptionId: sub.Id,
+		EventType:      string(eventType),
+		Payload:        string(payload),
+		Attempts:       uint32(attempt),
+		LastError:      err.Error(),
+	}); err != nil {
+		log.Printf("Failed to store dead letter for webhook %s: %v", sub.Id, err)
+	}
+}
+
+// sleep waits for delay, and reports whether it did before ctx was cancelled.
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, sub *schema.WebhookSubscription, eventType notify.EventType, deliveryID uuid.UUID, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(eventType))
+	req.Header.Set(DeliveryHeader, deliveryID.String())
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", sub.Url, resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header value for a payload. Receivers should
+// recompute it with their copy of the secret and compare with hmac.Equal.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,145 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StatelyCloud/demo-w/pkg/notify"
+	"github.com/StatelyCloud/demo-w/pkg/schema"
+	"github.com/google/uuid"
+)
+
+func TestSign(t *testing.T) {
+	const payload = `{"type":"lease.approved"}`
+	for _, tc := range []struct {
+		secret, timestamp, payload string
+		want                       string
+	}{
+		{"s3cret", "1700000000", payload, "sha256=2dbe9192a82c798839a803a3d2b7101d2c235d99b992b47610688047dce2f7bc"},
+		{"other", "1700000000", payload, "sha256=f9068e60faf427dcea9d7d2fc1beece834da2016d60c25f563484aa856958d66"},
+		{"s3cret", "1700000001", payload, "sha256=c4d9b2a51c1ce2d80183a0a33aea07163569d1061c973dfd276b3f82b3e17d5e"},
+		{"", "0", "", "sha256=b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+	} {
+		if got := Sign(tc.secret, tc.timestamp, []byte(tc.payload)); got != tc.want {
+			t.Errorf("Sign(%q, %q, %q) = %s, want %s", tc.secret, tc.timestamp, tc.payload, got, tc.want)
+		}
+	}
+}
+
+// fakeStore is a Store with a fixed list of subscriptions.
+type fakeStore struct {
+	subs []*schema.WebhookSubscription
+
+	mu          sync.Mutex
+	deadLetters []*schema.WebhookDeadLetter
+}
+
+func (s *fakeStore) ListWebhookSubscriptions(context.Context) ([]*schema.WebhookSubscription, error) {
+	return s.subs, nil
+}
+
+func (s *fakeStore) PutWebhookDeadLetter(ctx context.Context, deadLetter *schema.WebhookDeadLetter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetters = append(s.deadLetters, deadLetter)
+	return nil
+}
+
+func newEvent() notify.Event {
+	return notify.Event{Type: notify.LeaseApproved, Time: time.Now(), Lease: &schema.Lease{Id: uuid.New()}}
+}
+
+func TestDispatchSlowSubscriber(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	delivered := make(chan string, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- r.Header.Get(SignatureHeader)
+	}))
+	defer fast.Close()
+
+	// The slow subscription comes first, so the fast one only gets its
+	// event promptly if they're delivered independently.
+	d := NewDispatcher(&fakeStore{subs: []*schema.WebhookSubscription{
+		{Id: uuid.New(), Url: slow.URL, Secret: "slow"},
+		{Id: uuid.New(), Url: fast.URL, Secret: "fast"},
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx, 1)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if err := d.Notify(ctx, newEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	select {
+	case signature := <-delivered:
+		if signature == "" {
+			t.Error("delivery wasn't signed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow subscriber held up delivery to another")
+	}
+}
+
+func TestDispatchShutdownDeadLetters(t *testing.T) {
+	attempted := make(chan struct{}, 10)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempted <- struct{}{}
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	sub := &schema.WebhookSubscription{Id: uuid.New(), Url: failing.URL, Secret: "s3cret"}
+	store := &fakeStore{subs: []*schema.WebhookSubscription{sub}}
+	d := NewDispatcher(store)
+	d.Backoff = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx, 1)
+	}()
+
+	if err := d.Notify(ctx, newEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	select {
+	case <-attempted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event was never delivered")
+	}
+	// Stop while the delivery is waiting to retry.
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after ctx was cancelled")
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.deadLetters) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(store.deadLetters))
+	}
+	if dl := store.deadLetters[0]; dl.SubscriptionId != sub.Id || dl.Attempts != 1 || dl.EventType != string(notify.LeaseApproved) {
+		t.Fatalf("dead letter = %+v", dl)
+	}
+}
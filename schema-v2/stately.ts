@@ -2,12 +2,15 @@
 // Check out our documentation at https://stately.cloud.
 
 import {
+  arrayOf,
+  bool,
   durationSeconds,
   itemType,
   migrate,
   string,
   timestampMilliseconds,
   type,
+  uint32,
   uuid,
 } from '@stately-cloud/schema';
 
@@ -15,6 +18,9 @@ import {
 export const UserID = type('UserID', uuid);
 export const ResourceID = type('ResourceID', uuid);
 export const LeaseID = type('LeaseID', uuid);
+export const WebhookID = type('WebhookID', uuid);
+export const CampaignID = type('CampaignID', uuid);
+export const BundleID = type('BundleID', uuid);
 
 /**
  * A basic User object
@@ -60,6 +66,33 @@ export const Resource = itemType('Resource', {
       type: timestampMilliseconds,
       fromMetadata: 'createdAtTime',
     },
+    /** The user who approves leases for this resource. If unset, anyone but the lease's user can. */
+    owner_id: {
+      type: UserID,
+      required: false,
+    },
+  },
+});
+
+/**
+ * Claims a resource name, so that names are unique and resources can be
+ * looked up by them. It's written in the same transaction as the resource.
+ * Resources created before names were claimed don't have one until
+ * `demo-w resource claim-names` is run.
+ */
+export const ResourceName = itemType('ResourceName', {
+  keyPath: '/res_name-:name',
+  fields: {
+    name: {
+      type: string,
+    },
+    resource_id: {
+      type: ResourceID,
+    },
+    createdAt: {
+      type: timestampMilliseconds,
+      fromMetadata: 'createdAtTime',
+    },
   },
 });
 
@@ -116,6 +149,507 @@ export const Lease = itemType('Lease', {
       type: timestampMilliseconds,
       fromMetadata: 'createdAtTime',
     },
+    /** Who denied this lease, if it was denied. A denied lease never becomes valid. */
+    denied_by: {
+      type: UserID,
+      required: false,
+    },
+    /** The approver's comment when approving or denying the lease. */
+    decision_comment: {
+      type: string,
+      required: false,
+    },
+    /** Break-glass leases skip approval, and are reviewed afterwards instead. */
+    emergency: {
+      type: bool,
+      required: false,
+    },
+    /** The incident a break-glass lease was taken for. */
+    incident_ref: {
+      type: string,
+      required: false,
+    },
+    /**
+     * Set on leases requested together from a template. They share one
+     * approval: deciding any of them decides them all.
+     */
+    bundle_id: {
+      type: BundleID,
+      required: false,
+    },
+  },
+});
+
+/**
+ * Lists a lease under the bundle it was requested in, so the whole bundle can
+ * be approved or denied at once. It's written in the same transaction as the
+ * leases, and expires with its lease.
+ */
+export const BundleMember = itemType('BundleMember', {
+  keyPath: '/bundle-:bundle_id/lease-:lease_id',
+  ttl: {
+    source: 'fromLastModified',
+    field: 'duration_seconds',
+  },
+  fields: {
+    bundle_id: {
+      type: BundleID,
+    },
+    lease_id: {
+      type: LeaseID,
+    },
+    duration_seconds: {
+      type: durationSeconds,
+      required: false,
+    },
+  },
+});
+
+/**
+ * A named bundle of resources that are commonly leased together, e.g. the
+ * database, logs and dashboards an on-call engineer needs. Requesting it
+ * creates a lease on each resource in one transaction.
+ */
+export const LeaseTemplate = itemType('LeaseTemplate', {
+  keyPath: '/template-:name',
+  fields: {
+    name: {
+      type: string,
+    },
+    description: {
+      type: string,
+      required: false,
+    },
+    /** The names of the resources to lease. */
+    resources: {
+      type: arrayOf(string),
+    },
+    /** How long each lease lasts, unless the request says otherwise. */
+    duration_seconds: {
+      type: durationSeconds,
+    },
+    /** The reason given for each lease, unless the request says otherwise. */
+    reason: {
+      type: string,
+      required: false,
+    },
+    createdAt: {
+      type: timestampMilliseconds,
+      fromMetadata: 'createdAtTime',
+    },
+    lastModified: {
+      type: timestampMilliseconds,
+      fromMetadata: 'lastModifiedAtTime',
+    },
+  },
+});
+
+/**
+ * Lists a lease under one of the indexes lease search uses, e.g.
+ * "state:pending", "approver:<id>", "expires:<hour>", "created:<day>" or
+ * "reason:<word>". Entries are written and removed in the same transactions
+ * as the lease, and expire with it.
+ */
+export const LeaseIndexEntry = itemType('LeaseIndexEntry', {
+  keyPath: '/lease_index-:index/lease-:lease_id',
+  ttl: {
+    source: 'fromLastModified',
+    field: 'duration_seconds',
+  },
+  fields: {
+    index: {
+      type: string,
+    },
+    lease_id: {
+      type: LeaseID,
+    },
+    duration_seconds: {
+      type: durationSeconds,
+      required: false,
+    },
+  },
+});
+
+/**
+ * Indexes a lease that's waiting for approval under the owner of its
+ * resource, so owners can list what's waiting for them. It's written and
+ * removed in the same transactions as the lease, and expires with it.
+ */
+export const PendingApproval = itemType('PendingApproval', {
+  keyPath: '/approver-:owner_id/pending-:lease_id',
+  ttl: {
+    source: 'fromLastModified',
+    field: 'duration_seconds',
+  },
+  fields: {
+    owner_id: {
+      type: UserID,
+    },
+    lease_id: {
+      type: LeaseID,
+    },
+    user_id: {
+      type: UserID,
+    },
+    resource_id: {
+      type: ResourceID,
+    },
+    duration_seconds: {
+      type: durationSeconds,
+      required: false,
+    },
+    createdAt: {
+      type: timestampMilliseconds,
+      fromMetadata: 'createdAtTime',
+    },
+  },
+});
+
+/**
+ * A review of a break-glass lease, which a resource owner has to acknowledge
+ * after the fact. It's created along with the lease, and unlike the lease it
+ * doesn't expire, so there's a record of every emergency.
+ */
+export const EmergencyReview = itemType('EmergencyReview', {
+  keyPath: [
+    '/review-:lease_id',
+    '/res-:resource_id/review-:lease_id',
+  ],
+  fields: {
+    lease_id: {
+      type: LeaseID,
+    },
+    resource_id: {
+      type: ResourceID,
+    },
+    /** The user who took the lease. */
+    user_id: {
+      type: UserID,
+    },
+    reason: {
+      type: string,
+    },
+    incident_ref: {
+      type: string,
+    },
+    duration_seconds: {
+      type: durationSeconds,
+    },
+    /** Who acknowledged the review. Unset until someone has. */
+    acknowledged_by: {
+      type: UserID,
+      required: false,
+    },
+    acknowledged_at: {
+      type: timestampMilliseconds,
+      required: false,
+    },
+    comment: {
+      type: string,
+      required: false,
+    },
+    createdAt: {
+      type: timestampMilliseconds,
+      fromMetadata: 'createdAtTime',
+    },
+  },
+});
+
+/**
+ * A record of a lease granting access, kept for access reports. It's written
+ * in the transaction that approves (or breaks glass for) the lease, its
+ * ends_at is updated whenever the lease is extended or revoked, and unlike
+ * the lease it never expires.
+ */
+export const LeaseGrant = itemType('LeaseGrant', {
+  keyPath: [
+    '/res-:resource_id/grant-:lease_id',
+    '/user-:user_id/grant-:lease_id',
+  ],
+  fields: {
+    lease_id: {
+      type: LeaseID,
+    },
+    resource_id: {
+      type: ResourceID,
+    },
+    user_id: {
+      type: UserID,
+    },
+    /** Who approved the lease. Unset for break-glass leases. */
+    approver: {
+      type: UserID,
+      required: false,
+    },
+    emergency: {
+      type: bool,
+      required: false,
+    },
+    granted_at: {
+      type: timestampMilliseconds,
+    },
+    /**
+     * When the lease stops (or stopped) granting access. Unset if it has no
+     * duration and hasn't been revoked.
+     */
+    ends_at: {
+      type: timestampMilliseconds,
+      required: false,
+    },
+  },
+});
+
+/**
+ * A lease that has been requested for a future maintenance window. It doesn't
+ * grant any access by itself - once start_at passes it is converted into a real
+ * Lease, which is when the lease's TTL starts counting down.
+ */
+export const ScheduledLease = itemType('ScheduledLease', {
+  keyPath: [
+    '/user-:user_id/res-:resource_id/sched-:id',
+    '/res-:resource_id/sched-:id',
+    '/sched-:id',
+  ],
+  fields: {
+    /** The ID of the scheduled lease. The activated Lease keeps the same ID. */
+    id: {
+      type: LeaseID,
+      initialValue: 'uuid',
+    },
+    /** The user that this lease will be granted to. */
+    user_id: {
+      type: UserID,
+    },
+    /** The resource this lease will grant access to. */
+    resource_id: {
+      type: ResourceID,
+    },
+    reason: {
+      type: string,
+      required: false,
+    },
+    approver: {
+      type: UserID,
+      required: false,
+    },
+    /** How long the lease lasts once it has been activated. */
+    duration_seconds: {
+      type: durationSeconds,
+    },
+    /** When the lease should become active. */
+    start_at: {
+      type: timestampMilliseconds,
+    },
+    createdAt: {
+      type: timestampMilliseconds,
+      fromMetadata: 'createdAtTime',
+    },
+  },
+});
+
+/**
+ * A recertification campaign, in which resource owners reconfirm each standing
+ * lease on their resources before closes_at. Leases that haven't been
+ * confirmed by then are revoked when the campaign closes.
+ */
+export const Campaign = itemType('Campaign', {
+  keyPath: '/campaign-:id',
+  fields: {
+    id: {
+      type: CampaignID,
+      initialValue: 'uuid',
+    },
+    name: {
+      type: string,
+    },
+    /**
+     * The shortest lease the campaign covers. Leases without a duration are
+     * always covered.
+     */
+    min_duration_seconds: {
+      type: durationSeconds,
+      required: false,
+    },
+    closes_at: {
+      type: timestampMilliseconds,
+    },
+    /** When the campaign was closed. Unset while it's open. */
+    closed_at: {
+      type: timestampMilliseconds,
+      required: false,
+    },
+    /** When owners were last reminded about leases they haven't confirmed. */
+    reminded_at: {
+      type: timestampMilliseconds,
+      required: false,
+    },
+    createdAt: {
+      type: timestampMilliseconds,
+      fromMetadata: 'createdAtTime',
+    },
+  },
+});
+
+/**
+ * Tracks one lease through a campaign. Items are listed under the campaign
+ * for its progress, and under the resource's owner for their to-do list.
+ */
+export const CampaignItem = itemType('CampaignItem', {
+  keyPath: [
+    '/campaign-:campaign_id/item-:lease_id',
+    '/owner-:owner_id/campaign-:campaign_id/item-:lease_id',
+  ],
+  fields: {
+    campaign_id: {
+      type: CampaignID,
+    },
+    lease_id: {
+      type: LeaseID,
+    },
+    user_id: {
+      type: UserID,
+    },
+    resource_id: {
+      type: ResourceID,
+    },
+    /** Who has to confirm the lease. Unset if the resource has no owner. */
+    owner_id: {
+      type: UserID,
+      required: false,
+    },
+    /** pending, confirmed, revoked, or gone if the lease ended by itself. */
+    status: {
+      type: string,
+    },
+    decided_by: {
+      type: UserID,
+      required: false,
+    },
+    decided_at: {
+      type: timestampMilliseconds,
+      required: false,
+    },
+    comment: {
+      type: string,
+      required: false,
+    },
+    createdAt: {
+      type: timestampMilliseconds,
+      fromMetadata: 'createdAtTime',
+    },
+  },
+});
+
+/**
+ * An outbound webhook that lease lifecycle events are delivered to.
+ */
+export const WebhookSubscription = itemType('WebhookSubscription', {
+  keyPath: '/webhook-:id',
+  fields: {
+    id: {
+      type: WebhookID,
+      initialValue: 'uuid',
+    },
+    /** Where events are POSTed. */
+    url: {
+      type: string,
+    },
+    /** Shared secret used to sign each payload with HMAC-SHA256. */
+    secret: {
+      type: string,
+    },
+    /** Which event types to deliver, e.g. "lease.approved". Empty means every event. */
+    events: {
+      type: arrayOf(string),
+      required: false,
+    },
+    description: {
+      type: string,
+      required: false,
+    },
+    createdAt: {
+      type: timestampMilliseconds,
+      fromMetadata: 'createdAtTime',
+    },
+  },
+});
+
+/**
+ * A webhook delivery that still failed after every retry. It's kept so the
+ * failure can be inspected and the payload replayed.
+ */
+export const WebhookDeadLetter = itemType('WebhookDeadLetter', {
+  keyPath: '/webhook-:subscription_id/dead-:id',
+  fields: {
+    id: {
+      type: uuid,
+      initialValue: 'uuid',
+    },
+    subscription_id: {
+      type: WebhookID,
+    },
+    event_type: {
+      type: string,
+    },
+    /** The exact JSON body we tried to deliver. */
+    payload: {
+      type: string,
+    },
+    attempts: {
+      type: uint32,
+    },
+    last_error: {
+      type: string,
+      required: false,
+    },
+    createdAt: {
+      type: timestampMilliseconds,
+      fromMetadata: 'createdAtTime',
+    },
+  },
+});
+
+/**
+ * The response to a create request sent with an Idempotency-Key header, so
+ * that a retry of the same request gets the same response instead of creating
+ * something twice. While the first request is still running the record has no
+ * status, and it's only kept for a short time either way.
+ */
+export const IdempotencyRecord = itemType('IdempotencyRecord', {
+  keyPath: '/idem-:key',
+  ttl: {
+    source: 'fromLastModified',
+    field: 'ttl_seconds',
+  },
+  fields: {
+    /** The endpoint and API version the key was used with, and the key itself. */
+    key: {
+      type: string,
+    },
+    /** A hash of the request body, so a key can't be reused for a different request. */
+    request_hash: {
+      type: string,
+    },
+    /** The HTTP status of the original response, or 0 while it's in progress. */
+    status: {
+      type: uint32,
+      required: false,
+    },
+    content_type: {
+      type: string,
+      required: false,
+    },
+    body: {
+      type: string,
+      required: false,
+    },
+    ttl_seconds: {
+      type: durationSeconds,
+    },
+    createdAt: {
+      type: timestampMilliseconds,
+      fromMetadata: 'createdAtTime',
+    },
   },
 });
 
@@ -131,4 +665,61 @@ export const ReasonNotRequired = migrate(2, "Make reason not required", (m) => {
   m.changeType('Lease', (t) => {
     t.markFieldAsNotRequired('reason', 'No reason given');
   })
+});
+
+export const AddScheduledLease = migrate(3, "Add scheduled leases", (m) => {
+  m.addType('ScheduledLease');
+});
+
+export const AddWebhooks = migrate(4, "Add webhook subscriptions and dead letters", (m) => {
+  m.addType('WebhookSubscription');
+  m.addType('WebhookDeadLetter');
+});
+
+export const AddIdempotencyRecords = migrate(5, "Add idempotency records", (m) => {
+  m.addType('IdempotencyRecord');
+});
+
+export const AddApprovalInbox = migrate(6, "Add resource owners, lease denials and the approval inbox", (m) => {
+  m.changeType('Resource', (t) => {
+    t.addField('owner_id');
+  });
+  m.changeType('Lease', (t) => {
+    t.addField('denied_by');
+    t.addField('decision_comment');
+  });
+  m.addType('PendingApproval');
+});
+
+export const AddEmergencyLeases = migrate(7, "Add break-glass leases and their reviews", (m) => {
+  m.changeType('Lease', (t) => {
+    t.addField('emergency');
+    t.addField('incident_ref');
+  });
+  m.addType('EmergencyReview');
+});
+
+export const AddResourceNames = migrate(8, "Add unique resource names", (m) => {
+  m.addType('ResourceName');
+});
+
+export const AddLeaseSearch = migrate(9, "Add the lease search index", (m) => {
+  m.addType('LeaseIndexEntry');
+});
+
+export const AddLeaseGrants = migrate(10, "Add lease grants for access reports", (m) => {
+  m.addType('LeaseGrant');
+});
+
+export const AddCampaigns = migrate(11, "Add recertification campaigns", (m) => {
+  m.addType('Campaign');
+  m.addType('CampaignItem');
+});
+
+export const AddLeaseTemplates = migrate(12, "Add lease templates and bundles", (m) => {
+  m.changeType('Lease', (t) => {
+    t.addField('bundle_id');
+  });
+  m.addType('BundleMember');
+  m.addType('LeaseTemplate');
 });
\ No newline at end of file